@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrContentTypeMismatch is returned when a strict Accept is set and the
+// response's Content-Type doesn't match it
+var ErrContentTypeMismatch = errors.New("dl: content type mismatch")
+
+// WithAccept sets the Accept header sent with every request and warns when a
+// response comes back with a Content-Type that doesn't match it
+func WithAccept(mediaType string) Option {
+	return func(d *Downloader) {
+		d.SetDefaultHeader("Accept", mediaType)
+		d.accept = mediaType
+		d.strictAccept = false
+	}
+}
+
+// WithStrictAccept is like WithAccept, but a mismatched Content-Type fails
+// the request with ErrContentTypeMismatch
+func WithStrictAccept(mediaType string) Option {
+	return func(d *Downloader) {
+		d.SetDefaultHeader("Accept", mediaType)
+		d.accept = mediaType
+		d.strictAccept = true
+	}
+}
+
+// checkAccept compares a successful response's Content-Type against the
+// Downloader's Accept header
+func (d *Downloader) checkAccept(resp *http.Response) error {
+	accept := resp.Request.Header.Get("Accept")
+	if d.accept == "" || accept == "" || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if acceptable(accept, contentType) {
+		return nil
+	}
+
+	if d.strictAccept {
+		return fmt.Errorf("%w: got %q, want %q", ErrContentTypeMismatch, contentType, accept)
+	}
+	d.log.Warnf("%s returned %q, wanted %q\n", resp.Request.URL, contentType, accept)
+	return nil
+}
+
+// acceptable reports whether contentType satisfies the Accept header value accept
+func acceptable(accept, contentType string) bool {
+	got, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, r := range strings.Split(accept, ",") {
+		want, _, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case want == "*/*", want == got:
+			return true
+		case strings.HasSuffix(want, "/*") && strings.HasPrefix(got, strings.TrimSuffix(want, "*")):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestAccept(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "application/json" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/data")
+	dir := t.TempDir()
+
+	// The server honors the Accept header
+	if _, err := New(WithStrictAccept("application/json")).DownloadFile(filepath.Join(dir, "a"), u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// It doesn't know application/xml and sends HTML
+	_, err := New(WithStrictAccept("application/xml")).DownloadFile(filepath.Join(dir, "b"), u, nil, nil)
+	if !errors.Is(err, ErrContentTypeMismatch) {
+		t.Fatalf("got %v, want ErrContentTypeMismatch", err)
+	}
+	if FileExists(filepath.Join(dir, "b")) {
+		t.Fatal("mismatched response was written")
+	}
+
+	// Without strict it's only a warning
+	d := New(WithLogger(quietLogger()), WithAccept("application/xml"))
+	if _, err := d.DownloadFile(filepath.Join(dir, "c"), u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcceptable(t *testing.T) {
+	for _, tt := range []struct {
+		accept, contentType string
+		ok                  bool
+	}{
+		{"application/json", "application/json", true},
+		{"application/json", "application/json; charset=utf-8", true},
+		{"application/json", "text/html", false},
+		{"text/*", "text/plain", true},
+		{"*/*", "image/png", true},
+		{"image/png, image/jpeg;q=0.9", "image/jpeg", true},
+		{"application/json", "", false},
+	} {
+		if got := acceptable(tt.accept, tt.contentType); got != tt.ok {
+			t.Errorf("acceptable(%q, %q) = %v, want %v", tt.accept, tt.contentType, got, tt.ok)
+		}
+	}
+}
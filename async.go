@@ -0,0 +1,190 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultWorkers is the number of downloads a Downloader runs at once in the background
+const DefaultWorkers = 4
+
+// Outcome is what a download did
+type Outcome int
+
+const (
+	// Downloaded means the file was downloaded
+	Downloaded Outcome = iota
+	// SkippedSameSize means the file on disk was already the size of the
+	// response, or a skip func set with WithSkipFunc said it was up to date,
+	// so it wasn't downloaded again
+	SkippedSameSize
+	// SkippedDuplicate means the same download came earlier in a batch
+	SkippedDuplicate
+	// LinkedFromStore means the file was already in the Downloader's Store,
+	// and was linked from there instead of downloaded
+	LinkedFromStore
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Downloaded:
+		return "downloaded"
+	case SkippedSameSize:
+		return "skipped, same size"
+	case SkippedDuplicate:
+		return "skipped, duplicate"
+	case LinkedFromStore:
+		return "linked from store"
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+// DownloadResult describes a finished download
+type DownloadResult struct {
+	URL  *url.URL
+	Path string
+	// Written is how many bytes were written to Path, zero when skipped
+	Written int64
+	// Size is the size of the file at Path when the download finished
+	Size     int64
+	Duration time.Duration
+	Outcome  Outcome
+	// Proto is the protocol the file was served over, such as "HTTP/2.0"
+	Proto string
+	// StatusCode, Header and Cookies are from the response the file was
+	// served in, or the last response if the download failed. Header is a
+	// copy, and Cookies are the ones it set. They are empty if the file was
+	// skipped.
+	StatusCode int
+	Header     http.Header
+	Cookies    []*http.Cookie
+	// Filename is the file name the server suggested in a
+	// Content-Disposition header, or empty if it didn't
+	Filename string
+	// Digest is the hex encoded digest the file was verified against, using
+	// DigestAlgorithm from the DigestHeader response header. They are empty
+	// if the server didn't send one.
+	Digest          string
+	DigestAlgorithm string
+	DigestHeader    string
+	// TransferEncoding is the Content-Encoding the file was served with, such
+	// as "gzip". CompressedBytes is how much was received and
+	// UncompressedBytes what it decompressed to, when the Downloader
+	// decompressed it. Both are zero if it wasn't compressed, or if it was
+	// decompressed by a client transport the Downloader can't count.
+	TransferEncoding  string
+	CompressedBytes   int64
+	UncompressedBytes int64
+	// Meta is the RequestSpec's Meta
+	Meta interface{}
+}
+
+// AverageSpeed returns the average speed of the download in bytes per second
+func (r DownloadResult) AverageSpeed() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Written) / r.Duration.Seconds()
+}
+
+// Future is a handle to a download running in the background
+type Future struct {
+	done   chan struct{}
+	result DownloadResult
+	err    error
+}
+
+// Done returns a channel that is closed when the download has finished
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits for the download to finish and returns its outcome
+func (f *Future) Result() (DownloadResult, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// WithWorkers sets how many background downloads a Downloader runs at once
+func WithWorkers(n int) Option {
+	return func(d *Downloader) {
+		if n < 1 {
+			n = 1
+		}
+		d.workers = make(chan struct{}, n)
+	}
+}
+
+// DownloadFileAsync will download the url to fileloc in the background
+func DownloadFileAsync(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie, cb func(DownloadResult, error)) *Future {
+	return std.DownloadFileAsync(fileloc, u, headers, cookies, cb)
+}
+
+// DownloadFileAsync will download the url to fileloc on the Downloader's
+// worker pool. cb, if not nil, is called exactly once when the download
+// finishes, whether or not it succeeded. It is called before the Future's
+// Done channel is closed, so it must not wait on the Future. A panic in the
+// download is returned as its error.
+func (d *Downloader) DownloadFileAsync(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie, cb func(DownloadResult, error)) *Future {
+	f := &Future{done: make(chan struct{})}
+
+	go func() {
+		d.workers <- struct{}{}
+		defer func() { <-d.workers }()
+
+		defer close(f.done)
+
+		f.result, f.err = d.downloadAsync(fileloc, newSpec(u, headers, cookies))
+		if cb != nil {
+			d.callback(cb, f.result, f.err)
+		}
+	}()
+
+	return f
+}
+
+// downloadAsync runs Download, turning a panic into an error so the Future still
+// finishes
+func (d *Downloader) downloadAsync(fileloc string, spec *RequestSpec) (res DownloadResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.log.Errorf("Recovered from panic downloading %s: %v\n", spec.URL.Redacted(), r)
+			err = fmt.Errorf("dl: panic downloading %s: %v", spec.URL.Redacted(), r)
+		}
+	}()
+
+	return d.Download(fileloc, spec)
+}
+
+// callback runs cb, recovering from any panic so it can't take down the worker
+func (d *Downloader) callback(cb func(DownloadResult, error), res DownloadResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.log.Errorf("Recovered from panic in callback for %s: %v\n", res.Path, r)
+		}
+	}()
+
+	cb(res, err)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadFileAsync(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("async"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+
+	var f *Future
+	ready := make(chan struct{})
+	calls := 0
+	f = New().DownloadFileAsync(filepath.Join(t.TempDir(), "file"), u, nil, nil, func(res DownloadResult, err error) {
+		<-ready
+		calls++
+		select {
+		case <-f.Done():
+			t.Error("Done closed before the callback ran")
+		default:
+		}
+		if err != nil || res.Written != 5 {
+			t.Errorf("callback got %d, %v", res.Written, err)
+		}
+	})
+	close(ready)
+
+	res, err := f.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadFile(res.Path); string(body) != "async" {
+		t.Fatalf("got %q", body)
+	}
+	if calls != 1 {
+		t.Fatalf("callback called %d times", calls)
+	}
+}
+
+func TestDownloadFileAsyncPanic(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+
+	d := New(WithLogger(quietLogger()), WithRequestHook(func(*http.Request) error {
+		panic("hook")
+	}))
+
+	var cbErr error
+	f := d.DownloadFileAsync(filepath.Join(t.TempDir(), "file"), u, nil, nil, func(res DownloadResult, err error) {
+		cbErr = err
+	})
+	_, err := f.Result()
+	if err == nil || !strings.Contains(err.Error(), "panic") {
+		t.Fatalf("got %v, want the panic", err)
+	}
+	if cbErr != err {
+		t.Fatalf("callback got %v", cbErr)
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBatchByteLimit is returned for the jobs of a batch that weren't started
+// because the batch had already downloaded its MaxTotalBytes
+var ErrBatchByteLimit = errors.New("dl: batch byte limit reached")
+
+// Job is a single download in a batch
+type Job struct {
+	RequestSpec
+	// Dest is where the file is downloaded to
+	Dest string
+	// SHA256, if set, is the hex encoded SHA-256 the downloaded file must
+	// have. A file that doesn't match is removed.
+	SHA256 string
+	// Checksum, if set, is the hex encoded checksum the downloaded file must
+	// have with the hash registered as ChecksumAlgorithm, checked the same
+	// way as SHA256
+	Checksum          string
+	ChecksumAlgorithm string
+}
+
+// BatchOptions controls how a batch of jobs is downloaded
+type BatchOptions struct {
+	// Concurrency is how many jobs are downloaded at once, DefaultWorkers if zero
+	Concurrency int
+	// Attempts is how many attempts each job gets, one if zero
+	Attempts int
+	// MaxTotalBytes stops new jobs from starting once the batch has
+	// downloaded this many bytes, zero means no limit
+	MaxTotalBytes int64
+	// RetryBudget limits how many times the jobs of the batch are retried
+	// between them, and BackoffBudget how long they spend waiting to retry.
+	// Once either is spent, jobs fail on their first error instead of
+	// retrying. Zero means no limit beyond Attempts.
+	RetryBudget   int
+	BackoffBudget time.Duration
+	// AllowSameDest lets more than one job have the same destination. Jobs
+	// repeating an earlier job's URL and destination are only downloaded
+	// once, and different URLs for the same destination are downloaded one
+	// after another so the last one wins. Without it, a batch with clashing
+	// destinations fails with a DestConflictError before anything starts.
+	AllowSameDest bool
+	// Resume keeps the part file of a job that fails in a way that can be
+	// resumed, and carries on from it when the job is run again, the same
+	// way as ResumeDownloadProgress
+	Resume bool
+}
+
+// DestConflictError is returned for a batch with jobs that would write to the
+// same file
+type DestConflictError struct {
+	// Conflicts maps each clashing destination to the indexes of its jobs
+	Conflicts map[string][]int
+}
+
+func (e *DestConflictError) Error() string {
+	var dests []string
+	for dest := range e.Conflicts {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+
+	msgs := make([]string, len(dests))
+	for i, dest := range dests {
+		jobs := make([]string, len(e.Conflicts[dest]))
+		for j, n := range e.Conflicts[dest] {
+			jobs[j] = fmt.Sprint(n)
+		}
+		msgs[i] = fmt.Sprintf("%s (jobs %s)", dest, strings.Join(jobs, ", "))
+	}
+	return fmt.Sprintf("dl: %d destinations are used by more than one job: %s", len(dests), strings.Join(msgs, "; "))
+}
+
+// JobResult is the outcome of a single job in a batch
+type JobResult struct {
+	Job    *Job
+	Result DownloadResult
+	Err    error
+}
+
+// BatchReport is the outcome of a batch, with a result for every job in the
+// order they were given
+type BatchReport struct {
+	Results []JobResult
+	Failed  int
+	Written int64
+	// Retries is how many retries the jobs made, Backoff how long they
+	// waited before them, and RetriesDenied how many retries were refused
+	// because the batch's retry budget was spent
+	Retries       int
+	Backoff       time.Duration
+	RetriesDenied int
+}
+
+// DownloadAll will download every job, see Downloader.DownloadAll
+func DownloadAll(jobs []Job, opts BatchOptions) (*BatchReport, error) {
+	return std.DownloadAll(jobs, opts)
+}
+
+// DownloadAll will download every job, skipping files that are already up to
+// date. Unless the batch is refused with a DestConflictError, the report has
+// a result for every job, and the error is non nil if any of them failed.
+func (d *Downloader) DownloadAll(jobs []Job, opts BatchOptions) (*BatchReport, error) {
+	runs, dups, err := planBatch(jobs, opts.AllowSameDest)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultWorkers
+	}
+	attempts := opts.Attempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	report := &BatchReport{Results: make([]JobResult, len(jobs))}
+	var written int64
+	budget := &retryBudget{maxRetries: opts.RetryBudget, maxBackoff: opts.BackoffBudget}
+
+	next := make(chan []int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range next {
+				for _, i := range run {
+					d.runJob(&jobs[i], &report.Results[i], &opts, attempts, &written, budget)
+				}
+			}
+		}()
+	}
+
+	for _, run := range runs {
+		next <- run
+	}
+	close(next)
+	wg.Wait()
+	report.Retries = budget.retries
+	report.Backoff = budget.backoff
+	report.RetriesDenied = budget.denied
+
+	for i, first := range dups {
+		res := &report.Results[i]
+		*res = report.Results[first]
+		res.Job = &jobs[i]
+		res.Result.Meta = jobs[i].Meta
+		res.Result.Written = 0
+		res.Result.Outcome = SkippedDuplicate
+		atomic.AddInt64(&d.stats.downloadsSkipped, 1)
+	}
+
+	for _, res := range report.Results {
+		if res.Err != nil {
+			report.Failed++
+		}
+		report.Written += res.Result.Written
+	}
+
+	if report.Failed > 0 {
+		return report, fmt.Errorf("dl: %d of %d downloads failed", report.Failed, len(jobs))
+	}
+	return report, nil
+}
+
+// runJob downloads a single job of a batch into res
+func (d *Downloader) runJob(job *Job, res *JobResult, opts *BatchOptions, attempts int, written *int64, budget *retryBudget) {
+	res.Job = job
+	res.Result = DownloadResult{URL: job.URL, Path: job.Dest, Meta: job.Meta}
+
+	if opts.MaxTotalBytes > 0 && atomic.LoadInt64(written) >= opts.MaxTotalBytes {
+		res.Err = ErrBatchByteLimit
+		return
+	}
+
+	sum := job.SHA256
+	if sum == "" && job.ChecksumAlgorithm == "sha256" {
+		sum = job.Checksum
+	}
+	if d.linkFromStore(strings.ToLower(sum), job.Dest) {
+		res.Result.Outcome = LinkedFromStore
+		atomic.AddInt64(&d.stats.downloadsSkipped, 1)
+		if info, err := d.fs.Stat(job.Dest); err == nil {
+			res.Result.Size = info.Size()
+		}
+		return
+	}
+
+	// The checksums are checked before the file is given a sidecar,
+	// deduplicated or stored
+	t := newTransfer(job.Dest, &job.RequestSpec)
+	t.budget = budget
+	if opts.Resume {
+		t.keep = true
+		d.loadResumeState(t)
+	}
+	if job.SHA256 != "" {
+		t.checksums = append(t.checksums, [2]string{"sha256", job.SHA256})
+	}
+	if job.Checksum != "" {
+		t.checksums = append(t.checksums, [2]string{job.ChecksumAlgorithm, job.Checksum})
+	}
+
+	res.Result, res.Err = d.fetchTransfer(t, attempts)
+	atomic.AddInt64(written, res.Result.Written)
+}
+
+// planBatch groups the jobs of a batch into runs that are each downloaded in
+// order by a single worker, so that jobs sharing a destination never run at
+// the same time. dups maps each job that repeats an earlier one to it.
+func planBatch(jobs []Job, allowSameDest bool) (runs [][]int, dups map[int]int, err error) {
+	byDest := make(map[string][]int)
+	var order []string
+	for i := range jobs {
+		key := destKey(jobs[i].Dest)
+		if _, ok := byDest[key]; !ok {
+			order = append(order, key)
+		}
+		byDest[key] = append(byDest[key], i)
+	}
+
+	conflicts := make(map[string][]int)
+	dups = make(map[int]int)
+	for _, key := range order {
+		group := byDest[key]
+		if len(group) > 1 && !allowSameDest {
+			conflicts[jobs[group[0]].Dest] = group
+			continue
+		}
+
+		var run []int
+		seen := make(map[string]int)
+		for _, i := range group {
+			id := jobs[i].method() + " " + jobs[i].URL.String()
+			if first, ok := seen[id]; ok {
+				dups[i] = first
+				continue
+			}
+			seen[id] = i
+			run = append(run, i)
+		}
+		runs = append(runs, run)
+	}
+
+	if len(conflicts) > 0 {
+		return nil, nil, &DestConflictError{Conflicts: conflicts}
+	}
+	return runs, dups, nil
+}
+
+// destKey returns the key two destinations share if they are the same file
+func destKey(dest string) string {
+	key := filepath.Clean(dest)
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		// These filesystems are case insensitive by default
+		key = strings.ToLower(key)
+	}
+	return key
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadAllResume(t *testing.T) {
+	body := testBody(10000)
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"v1"`)
+		if first {
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", "10000")
+			w.Write(body[:4000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "f", time.Time{}, bytes.NewReader(body))
+	}))
+	srv.Config.ErrorLog = discardLogger()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	fileloc := filepath.Join(t.TempDir(), "f")
+	jobs := []Job{{RequestSpec: RequestSpec{URL: u}, Dest: fileloc}}
+	if _, err := New().DownloadAll(jobs, BatchOptions{Resume: true}); err == nil {
+		t.Fatal("dropped download succeeded")
+	}
+	if info, err := os.Stat(fileloc + partSuffix); err != nil || info.Size() != 4000 {
+		t.Fatalf("part file wasn't kept: %v", err)
+	}
+
+	// Another run carries on from the part file
+	if _, err := New().DownloadAll(jobs, BatchOptions{Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(fileloc); !bytes.Equal(got, body) {
+		t.Fatal("resumed file doesn't match")
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes=4000-" {
+		t.Fatalf("got ranges %q, want a resume from 4000", ranges)
+	}
+	if _, err := os.Stat(fileloc + partSuffix + stateSuffix); !os.IsNotExist(err) {
+		t.Fatal("state was left behind")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DownloadFileVerifyBlocks will download the url to fileloc, checking each
+// block against a list of SHA-256 checksums, see Downloader.DownloadFileVerifyBlocks
+func DownloadFileVerifyBlocks(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie, blockSize int, blockHashes []string) (int64, error) {
+	return std.DownloadFileVerifyBlocks(fileloc, u, headers, cookies, blockSize, blockHashes)
+}
+
+// DownloadFileVerifyBlocks will download the url to fileloc, checking each
+// blockSize bytes of it against the hex encoded SHA-256 in blockHashes as
+// soon as the block has arrived, the last of which may be short. The first
+// block that doesn't match stops the download with a ChecksumMismatchError
+// and removes the partial file, without waiting for the rest of it. A file
+// with more or fewer blocks than there are checksums fails the same way.
+// A dropped connection is retried up to MaxReconnects times, and blocks that
+// were checked before it aren't downloaded or checked again when the download
+// resumes. A file already at fileloc is always downloaded again, as its blocks
+// haven't been checked.
+func (d *Downloader) DownloadFileVerifyBlocks(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie, blockSize int, blockHashes []string) (int64, error) {
+	if blockSize <= 0 {
+		return 0, fmt.Errorf("dl: block size %d isn't positive", blockSize)
+	}
+	for i, sum := range blockHashes {
+		if b, err := hex.DecodeString(sum); err != nil || len(b) != 32 {
+			return 0, fmt.Errorf("dl: malformed sha256 checksum %q for block %d", sum, i)
+		}
+	}
+
+	t := newTransfer(fileloc, newSpec(u, headers, cookies))
+	t.blocks = newBlockVerifier(fileloc, int64(blockSize), blockHashes)
+	t.fresh = true
+	res, err := d.fetchTransfer(t, 1+MaxReconnects)
+	return res.Written, err
+}
+
+// blockVerifier checks a download block by block as it is written
+type blockVerifier struct {
+	path      string
+	blockSize int64
+	hashes    []string
+
+	h hash.Hash
+	// block is the index of the block being written and n how much of it
+	// has been written
+	block int
+	n     int64
+}
+
+func newBlockVerifier(path string, blockSize int64, hashes []string) *blockVerifier {
+	h, _ := newHash("sha256")
+	return &blockVerifier{path: path, blockSize: blockSize, hashes: hashes, h: h}
+}
+
+// reset starts checking from the first block again
+func (b *blockVerifier) reset() {
+	b.h.Reset()
+	b.block, b.n = 0, 0
+}
+
+func (b *blockVerifier) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if b.block >= len(b.hashes) {
+			return written, fmt.Errorf("dl: %s is longer than its %d blocks", b.path, len(b.hashes))
+		}
+
+		chunk := p
+		if left := b.blockSize - b.n; int64(len(chunk)) > left {
+			chunk = chunk[:left]
+		}
+		b.h.Write(chunk)
+		b.n += int64(len(chunk))
+		written += len(chunk)
+		p = p[len(chunk):]
+
+		if b.n == b.blockSize {
+			if err := b.check(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// check compares the block that has just been finished with its checksum and
+// moves on to the next one
+func (b *blockVerifier) check() error {
+	got := hex.EncodeToString(b.h.Sum(nil))
+	if want := b.hashes[b.block]; !strings.EqualFold(got, want) {
+		return &ChecksumMismatchError{
+			Path:      fmt.Sprintf("block %d of %s", b.block, b.path),
+			Algorithm: "sha256",
+			Expected:  want,
+			Actual:    got,
+		}
+	}
+	b.h.Reset()
+	b.block++
+	b.n = 0
+	return nil
+}
+
+// finish checks the last, short block and that every block was written
+func (b *blockVerifier) finish() error {
+	if b.n > 0 {
+		if b.block >= len(b.hashes) {
+			return fmt.Errorf("dl: %s is longer than its %d blocks", b.path, len(b.hashes))
+		}
+		if err := b.check(); err != nil {
+			return err
+		}
+	}
+	if b.block != len(b.hashes) {
+		return fmt.Errorf("dl: %s ended after %d of its %d blocks", b.path, b.block, len(b.hashes))
+	}
+	return nil
+}
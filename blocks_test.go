@@ -0,0 +1,164 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBody returns n bytes that don't repeat in any block size a test uses
+func testBody(n int) []byte {
+	body := make([]byte, n)
+	for i := range body {
+		body[i] = byte(i*7 + i/251)
+	}
+	return body
+}
+
+func blockHashes(body []byte, blockSize int) []string {
+	var hashes []string
+	for len(body) > 0 {
+		n := blockSize
+		if n > len(body) {
+			n = len(body)
+		}
+		sum := sha256.Sum256(body[:n])
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+		body = body[n:]
+	}
+	return hashes
+}
+
+func TestDownloadFileVerifyBlocks(t *testing.T) {
+	body := testBody(10000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	fileloc := filepath.Join(t.TempDir(), "f")
+	n, err := New().DownloadFileVerifyBlocks(fileloc, u, nil, nil, 1024, blockHashes(body, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadFile(fileloc)
+	if n != int64(len(body)) || !bytes.Equal(got, body) {
+		t.Fatalf("wrote %d bytes, want %d", n, len(body))
+	}
+
+	// A file that is already there is checked too, even if it is the same size
+	ioutil.WriteFile(fileloc, make([]byte, len(body)), 0644)
+	if _, err := New().DownloadFileVerifyBlocks(fileloc, u, nil, nil, 1024, blockHashes(body, 1024)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(fileloc); !bytes.Equal(got, body) {
+		t.Fatal("file already there was skipped")
+	}
+}
+
+func TestDownloadFileVerifyBlocksMismatch(t *testing.T) {
+	const blockSize = 64 << 10
+	body := testBody(16 * blockSize)
+	aborted := make(chan bool, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1048576")
+		w.Write(body[:2*blockSize])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			aborted <- true
+			return
+		case <-time.After(5 * time.Second):
+			aborted <- false
+		}
+		w.Write(body[2*blockSize:])
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	hashes := blockHashes(body, blockSize)
+	hashes[1] = hashes[0]
+	fileloc := filepath.Join(t.TempDir(), "f")
+	_, err := New().DownloadFileVerifyBlocks(fileloc, u, nil, nil, blockSize, hashes)
+	var mismatch *ChecksumMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("got %v, want a ChecksumMismatchError", err)
+	}
+	if !<-aborted {
+		t.Fatal("the download went on after the bad block")
+	}
+	for _, path := range []string{fileloc, fileloc + partSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s was left behind", path)
+		}
+	}
+}
+
+func TestDownloadFileVerifyBlocksResume(t *testing.T) {
+	body := testBody(10000)
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"v1"`)
+		if first {
+			// Send the first three blocks and drop the connection
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", "10000")
+			w.Write(body[:3072])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "f", time.Time{}, bytes.NewReader(body))
+	}))
+	srv.Config.ErrorLog = discardLogger()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	fileloc := filepath.Join(t.TempDir(), "f")
+	d := New(WithBackoff(ConstantBackoff(time.Millisecond)))
+	if _, err := d.DownloadFileVerifyBlocks(fileloc, u, nil, nil, 1024, blockHashes(body, 1024)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(fileloc); !bytes.Equal(got, body) {
+		t.Fatal("resumed file doesn't match")
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes=3072-" {
+		t.Fatalf("got ranges %q, want a resume from 3072", ranges)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a request is refused because its host has
+// failed too many times in a row
+var ErrCircuitOpen = errors.New("dl: circuit open")
+
+// CircuitState is the state of the circuit for a single host
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through as normal
+	CircuitClosed CircuitState = iota
+	// CircuitOpen refuses requests until the cooldown has passed
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe request through
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker tracks consecutive failures per host and refuses requests to
+// hosts that keep failing
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failures that opens the circuit
+	Threshold int
+	// Window is how close together the failures must be to count as
+	// consecutive, zero means any distance
+	Window time.Duration
+	// Cooldown is how long the circuit stays open before a probe is allowed
+	Cooldown time.Duration
+	// OnStateChange, if set, is called whenever a host changes state. It is
+	// called with the breaker locked, so it must not call back into it
+	OnStateChange func(host string, from, to CircuitState)
+
+	mu    sync.Mutex
+	hosts map[string]*hostCircuit
+}
+
+type hostCircuit struct {
+	state        CircuitState
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+}
+
+// NewCircuitBreaker returns a CircuitBreaker that opens after threshold
+// failures within window and stays open for cooldown
+func NewCircuitBreaker(threshold int, window, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Threshold: threshold,
+		Window:    window,
+		Cooldown:  cooldown,
+	}
+}
+
+// SetCircuitBreaker sets the circuit breaker used by the dl package, nil disables it
+func SetCircuitBreaker(cb *CircuitBreaker) {
+	WithCircuitBreaker(cb)(std)
+}
+
+// State returns the current state of the circuit for host
+func (cb *CircuitBreaker) State(host string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if h, ok := cb.hosts[host]; ok {
+		return h.state
+	}
+	return CircuitClosed
+}
+
+// allow returns ErrCircuitOpen if a request to host should not be made
+func (cb *CircuitBreaker) allow(log *logrus.Logger, host string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	h := cb.host(host)
+	switch h.state {
+	case CircuitOpen:
+		if time.Since(h.openedAt) < cb.Cooldown {
+			return fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+		}
+		cb.transition(log, host, h, CircuitHalfOpen)
+		h.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if h.probing {
+			return fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+		}
+		h.probing = true
+	}
+	return nil
+}
+
+// record updates the circuit for host with the outcome of a request
+func (cb *CircuitBreaker) record(log *logrus.Logger, host string, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	h := cb.host(host)
+	h.probing = false
+
+	if !failed {
+		h.failures = 0
+		if h.state != CircuitClosed {
+			cb.transition(log, host, h, CircuitClosed)
+		}
+		return
+	}
+
+	now := time.Now()
+	if h.failures == 0 || (cb.Window > 0 && now.Sub(h.firstFailure) > cb.Window) {
+		h.failures = 0
+		h.firstFailure = now
+	}
+	h.failures++
+
+	if h.state == CircuitHalfOpen || (h.state == CircuitClosed && h.failures >= cb.Threshold) {
+		h.openedAt = now
+		cb.transition(log, host, h, CircuitOpen)
+	}
+}
+
+// release lets another probe through to host after a request whose outcome
+// says nothing about the host, such as one the caller cancelled
+func (cb *CircuitBreaker) release(host string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.host(host).probing = false
+}
+
+func (cb *CircuitBreaker) host(host string) *hostCircuit {
+	if cb.hosts == nil {
+		cb.hosts = make(map[string]*hostCircuit)
+	}
+	h, ok := cb.hosts[host]
+	if !ok {
+		h = &hostCircuit{}
+		cb.hosts[host] = h
+	}
+	return h
+}
+
+func (cb *CircuitBreaker) transition(log *logrus.Logger, host string, h *hostCircuit, to CircuitState) {
+	from := h.state
+	h.state = to
+
+	if to == CircuitOpen {
+		log.Warnf("Circuit for %s is %s after %d failures\n", host, to, h.failures)
+	} else {
+		log.Infof("Circuit for %s is %s\n", host, to)
+	}
+	if cb.OnStateChange != nil {
+		cb.OnStateChange(host, from, to)
+	}
+}
+
+// failed reports whether the outcome of a request made with ctx counts
+// against its host, which only server errors and failures to reach the host
+// do, including timing out connecting or waiting for a response. Requests
+// the caller cancelled or ran out of time for, or that were refused before
+// being sent, don't count.
+func failed(ctx context.Context, resp *http.Response, err error) bool {
+	if err == nil {
+		return resp.StatusCode >= 500
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ErrHostNotAllowed) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
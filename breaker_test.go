@@ -0,0 +1,160 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	cb := NewCircuitBreaker(2, 0, 50*time.Millisecond)
+	d := New(WithCircuitBreaker(cb))
+	for i := 0; i < 2; i++ {
+		if _, err := d.GetBodyFromURL(u, nil, nil); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if s := cb.State(u.Host); s != CircuitOpen {
+		t.Fatalf("circuit is %s", s)
+	}
+	if _, err := d.GetBodyFromURL(u, nil, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	atomic.StoreInt32(&failing, 0)
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s := cb.State(u.Host); s != CircuitClosed {
+		t.Fatalf("circuit is %s after the probe", s)
+	}
+}
+
+func TestCircuitBreakerCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	cb := NewCircuitBreaker(1, 0, time.Hour)
+	d := New(WithCircuitBreaker(cb))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		if _, err := d.send(req.WithContext(ctx)); !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	}
+	if s := cb.State(srv.Listener.Addr().String()); s != CircuitClosed {
+		t.Fatalf("circuit is %s after cancelled requests", s)
+	}
+}
+
+func TestCircuitBreakerTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	// A host that hangs trips the breaker whichever timeout gives up on it
+	for _, opt := range []Option{
+		WithResponseHeaderTimeout(20 * time.Millisecond),
+		WithClient(&http.Client{Timeout: 20 * time.Millisecond}),
+	} {
+		cb := NewCircuitBreaker(2, 0, time.Hour)
+		d := New(opt, WithCircuitBreaker(cb))
+		for i := 0; i < 2; i++ {
+			if _, err := d.GetBodyFromURL(u, nil, nil); err == nil {
+				t.Fatal("expected a timeout")
+			}
+		}
+		if s := cb.State(u.Host); s != CircuitOpen {
+			t.Errorf("circuit is %s after timeouts", s)
+		}
+	}
+
+	// Running out of the caller's time isn't the host's fault
+	cb := NewCircuitBreaker(1, 0, time.Hour)
+	d := New(WithCircuitBreaker(cb))
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		_, err := d.send(req.WithContext(ctx))
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want context.DeadlineExceeded", err)
+		}
+	}
+	if s := cb.State(u.Host); s != CircuitClosed {
+		t.Errorf("circuit is %s after the caller's deadlines", s)
+	}
+}
+
+func TestFailed(t *testing.T) {
+	done, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tt := range []struct {
+		ctx    context.Context
+		status int
+		err    error
+		failed bool
+	}{
+		{context.Background(), http.StatusOK, nil, false},
+		{context.Background(), http.StatusNotFound, nil, false},
+		{context.Background(), http.StatusServiceUnavailable, nil, true},
+		{context.Background(), 0, &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{context.Background(), 0, &url.Error{Op: "Get", Err: io.ErrUnexpectedEOF}, true},
+		{context.Background(), 0, &url.Error{Op: "Get", Err: context.DeadlineExceeded}, true},
+		{done, 0, &url.Error{Op: "Get", Err: context.Canceled}, false},
+		{done, 0, &url.Error{Op: "Get", Err: io.ErrUnexpectedEOF}, false},
+		{context.Background(), 0, &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: fmt.Errorf("%w: 10.0.0.1", ErrHostNotAllowed)}}, false},
+		{context.Background(), 0, fmt.Errorf("%w for example.com", ErrCircuitOpen), false},
+		{context.Background(), 0, errors.New("redirect refused"), false},
+	} {
+		var resp *http.Response
+		if tt.err == nil {
+			resp = &http.Response{StatusCode: tt.status}
+		}
+		if got := failed(tt.ctx, resp, tt.err); got != tt.failed {
+			t.Errorf("failed(%d, %v) with the context %v = %v, want %v", tt.status, tt.err, tt.ctx.Err(), got, tt.failed)
+		}
+	}
+}
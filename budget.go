@@ -0,0 +1,74 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"sync"
+	"time"
+)
+
+// retryBudget is shared by the jobs of a batch to limit how much retrying
+// they do between them
+type retryBudget struct {
+	maxRetries int
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	retries int
+	backoff time.Duration
+	// denied is how many retries were refused because the budget was spent
+	denied int
+}
+
+// take reports whether there is enough of the budget left for a retry after
+// waiting for wait, and takes it if so. A nil budget is unlimited.
+func (b *retryBudget) take(wait time.Duration) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if (b.maxRetries > 0 && b.retries >= b.maxRetries) || (b.maxBackoff > 0 && b.backoff+wait > b.maxBackoff) {
+		b.denied++
+		return false
+	}
+	b.retries++
+	b.backoff += wait
+	return true
+}
+
+// retry waits before retrying t after attempt failed with err, reporting
+// false without waiting if t's retry budget is spent
+func (d *Downloader) retry(t *transfer, what string, attempt int, err error) bool {
+	wait := d.retryDelay(attempt)
+	if !t.budget.take(wait) {
+		d.log.Warnf("Not retrying %s, the retry budget is spent: %v\n", what, err)
+		return false
+	}
+
+	d.log.Warnf("Retrying %s in %s: %v\n", what, wait, err)
+	if d.onRetry != nil {
+		d.onRetry(t.spec.URL, attempt, wait, err)
+	}
+	d.clock.Sleep(t.ctx, wait)
+	return true
+}
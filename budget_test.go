@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetryBudgetTake(t *testing.T) {
+	var unlimited *retryBudget
+	for i := 0; i < 100; i++ {
+		if !unlimited.take(time.Hour) {
+			t.Fatal("a nil budget ran out")
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		b     *retryBudget
+		waits []time.Duration
+		want  []bool
+	}{
+		{"retries", &retryBudget{maxRetries: 2}, []time.Duration{time.Hour, time.Hour, time.Second, 0}, []bool{true, true, false, false}},
+		{"backoff", &retryBudget{maxBackoff: 3 * time.Second}, []time.Duration{time.Second, 2 * time.Second, time.Millisecond}, []bool{true, true, false}},
+		{"too long a wait leaves the rest", &retryBudget{maxBackoff: 3 * time.Second}, []time.Duration{2 * time.Second, 2 * time.Second, time.Second}, []bool{true, false, true}},
+		{"both", &retryBudget{maxRetries: 2, maxBackoff: time.Minute}, []time.Duration{time.Second, time.Minute, time.Second, time.Second}, []bool{true, false, true, false}},
+		{"no limits", &retryBudget{}, []time.Duration{time.Hour, time.Hour}, []bool{true, true}},
+	} {
+		var denied int
+		for i, wait := range tc.waits {
+			if got := tc.b.take(wait); got != tc.want[i] {
+				t.Errorf("%s: retry %d after %v: got %v, want %v", tc.name, i, wait, got, tc.want[i])
+			}
+			if !tc.want[i] {
+				denied++
+			}
+		}
+		if tc.b.denied != denied {
+			t.Errorf("%s: %d denied, want %d", tc.name, tc.b.denied, denied)
+		}
+	}
+}
+
+func TestBatchRetryBudget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	var jobs []Job
+	for i := 0; i < 10; i++ {
+		u, _ := url.Parse(fmt.Sprintf("%s/%d", srv.URL, i))
+		jobs = append(jobs, Job{RequestSpec: RequestSpec{URL: u}, Dest: filepath.Join(dir, fmt.Sprint(i))})
+	}
+
+	for _, tc := range []struct {
+		name            string
+		opts            BatchOptions
+		retries, denied int
+		backoff         time.Duration
+	}{
+		// Every job would retry twice, but only four retries are allowed,
+		// and a job that is denied one fails there
+		{"out of retries", BatchOptions{Attempts: 3, RetryBudget: 4}, 4, 8, 4 * time.Second},
+		// Or only as many as fit in the backoff time
+		{"out of backoff", BatchOptions{Attempts: 3, BackoffBudget: 3500 * time.Millisecond}, 3, 9, 3 * time.Second},
+		{"unlimited", BatchOptions{Attempts: 3}, 20, 0, 20 * time.Second},
+	} {
+		c := &fakeClock{now: time.Unix(0, 0)}
+		d := New(WithLogger(quietLogger()), WithRetryBackoff(time.Second, time.Second, 1))
+		d.clock = c
+		tc.opts.Concurrency = 1
+
+		report, err := d.DownloadAll(jobs, tc.opts)
+		if err == nil || report.Failed != len(jobs) {
+			t.Fatalf("%s: got %v with %d failed", tc.name, err, report.Failed)
+		}
+		if report.Retries != tc.retries || report.RetriesDenied != tc.denied || report.Backoff != tc.backoff {
+			t.Errorf("%s: %d retries, %d denied and %v of backoff, want %d, %d and %v", tc.name, report.Retries, report.RetriesDenied, report.Backoff, tc.retries, tc.denied, tc.backoff)
+		}
+		if len(c.sleeps) != tc.retries {
+			t.Errorf("%s: slept %d times", tc.name, len(c.sleeps))
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io"
+)
+
+// defaultBufferSize matches the buffer io.Copy allocates
+const defaultBufferSize = 32 * 1024
+
+// SetCopyBufferSize sets the size of the buffer used to copy downloads to disk
+func SetCopyBufferSize(n int) {
+	WithCopyBufferSize(n)(std)
+}
+
+// WithCopyBufferSize sets the size of the buffer used to copy downloads to
+// disk, zero or less uses the default of 32KiB
+func WithCopyBufferSize(n int) Option {
+	return func(d *Downloader) {
+		if n <= 0 {
+			n = defaultBufferSize
+		}
+		d.mu.Lock()
+		d.bufferSize = n
+		d.mu.Unlock()
+	}
+}
+
+// getBuffer returns a copy buffer from the pool, buffers left over from
+// before the size changed are dropped
+func (d *Downloader) getBuffer() *[]byte {
+	d.mu.RLock()
+	size := d.bufferSize
+	d.mu.RUnlock()
+
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+
+	if buf, ok := d.buffers.Get().(*[]byte); ok && len(*buf) == size {
+		return buf
+	}
+	buf := make([]byte, size)
+	return &buf
+}
+
+func (d *Downloader) putBuffer(buf *[]byte) {
+	d.buffers.Put(buf)
+}
+
+// copyBuffer is io.CopyBuffer, but always copies through buf even when src or
+// dst would let io.CopyBuffer skip it
+func copyBuffer(dst io.Writer, src io.Reader, buf []byte) (int64, error) {
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, buf)
+}
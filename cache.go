@@ -0,0 +1,293 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheEntry is a cached response body along with what is needed to revalidate it
+type CacheEntry struct {
+	Body []byte
+	// Header is the header of the response, which the Downloader's
+	// validators see again when the entry is used
+	Header       http.Header
+	ETag         string
+	LastModified string
+	// Expires is when the entry stops being fresh, after which it has to be
+	// revalidated with the server
+	Expires time.Time
+	// Vary is the request headers named by the response's Vary header. An
+	// entry with Vary stored under a URL's own key only points to the
+	// entries for each combination of their values, see cacheKey.
+	Vary []string `json:",omitempty"`
+}
+
+// Cache stores response bodies for GetBodyFromURL
+type Cache interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, e *CacheEntry)
+}
+
+// SetCache sets the cache used by GetBodyFromURL, nil disables caching
+func SetCache(c Cache) {
+	WithCache(c)(std)
+}
+
+// newCacheEntry builds a CacheEntry for a response, returning nil if the
+// response shouldn't or can't usefully be cached
+func newCacheEntry(h http.Header, body []byte) *CacheEntry {
+	e := &CacheEntry{
+		Body:         body,
+		Header:       h,
+		ETag:         h.Get("ETag"),
+		LastModified: h.Get("Last-Modified"),
+	}
+
+	fresh, ok := freshUntil(h)
+	if !ok {
+		return nil
+	}
+	e.Expires = fresh
+
+	for _, v := range h["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "*" {
+				// Varies on something that can't be known
+				return nil
+			} else if name != "" {
+				e.Vary = append(e.Vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(e.Vary)
+
+	if e.ETag == "" && e.LastModified == "" && !time.Now().Before(e.Expires) {
+		// Nothing to revalidate with and already stale
+		return nil
+	}
+	return e
+}
+
+// uncachedHeaders are request headers whose responses aren't cached: ranges
+// aren't the whole body, and the caller's own conditions have to reach the
+// server
+var uncachedHeaders = []string{"Authorization", "Cookie", "Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
+// cacheable reports whether the response to req can be shared through the
+// cache, which it can't be if it depends on credentials or cookies, or is
+// for part of the body or a conditional request
+func (d *Downloader) cacheable(req *http.Request) bool {
+	if d.cache == nil || req.URL.User != nil {
+		return false
+	}
+	for _, name := range uncachedHeaders {
+		if req.Header.Get(name) != "" {
+			return false
+		}
+	}
+
+	d.mu.RLock()
+	auth := d.digestAuth
+	d.mu.RUnlock()
+	if auth != nil {
+		return false
+	}
+
+	if jar := d.client.Jar; jar != nil && len(jar.Cookies(req.URL)) > 0 {
+		return false
+	}
+	return true
+}
+
+// cacheKey returns the key req's response is cached under. It is the URL
+// and the Accept header, which the Downloader sets itself for GetJSON and
+// WithAccept, and the values of the request headers in vary, the Vary of
+// the entry stored under the key without them.
+func cacheKey(req *http.Request, vary []string) string {
+	key := req.URL.String()
+	for _, name := range append([]string{"Accept"}, vary...) {
+		if v := req.Header.Get(name); v != "" || name != "Accept" {
+			key += "\n" + name + ": " + v
+		}
+	}
+	return key
+}
+
+// cacheGet returns the entry cached for req and the key it is under
+func (d *Downloader) cacheGet(req *http.Request) (*CacheEntry, string, bool) {
+	key := cacheKey(req, nil)
+	e, ok := d.cache.Get(key)
+	if ok && len(e.Vary) > 0 {
+		key = cacheKey(req, e.Vary)
+		e, ok = d.cache.Get(key)
+	}
+	return e, key, ok
+}
+
+// cacheSet stores e as the entry for req. One with a Vary is stored under
+// the key for its values, and the key without them points to it.
+func (d *Downloader) cacheSet(req *http.Request, e *CacheEntry) {
+	key := cacheKey(req, nil)
+	if len(e.Vary) > 0 {
+		d.cache.Set(key, &CacheEntry{Vary: e.Vary})
+		key = cacheKey(req, e.Vary)
+	}
+	d.cache.Set(key, e)
+}
+
+// cachedResponse builds a response to req from e so it can be validated like
+// one from the server
+func cachedResponse(req *http.Request, e *CacheEntry) *http.Response {
+	h := e.Header
+	if h == nil {
+		h = make(http.Header)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// redactKey returns key with any password in its URL masked, for logging
+func redactKey(key string) string {
+	raw, rest := key, ""
+	if i := strings.IndexByte(key, '\n'); i >= 0 {
+		raw, rest = key[:i], strings.Replace(key[i:], "\n", " ", -1)
+	}
+	if u, err := url.Parse(raw); err == nil {
+		return u.Redacted() + rest
+	}
+	return key
+}
+
+// freshUntil returns when a response stops being fresh according to its
+// Cache-Control and Expires headers, ok is false if it must not be stored
+func freshUntil(h http.Header) (t time.Time, ok bool) {
+	now := time.Now()
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store":
+			return time.Time{}, false
+		case directive == "no-cache":
+			return now, true
+		case strings.HasPrefix(directive, "max-age="):
+			secs, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil {
+				return now.Add(time.Duration(secs) * time.Second), true
+			}
+		}
+	}
+
+	if exp, err := http.ParseTime(h.Get("Expires")); err == nil {
+		return exp, true
+	}
+	return now, true
+}
+
+// FileCache is a Cache that stores each entry as a file in a directory
+type FileCache struct {
+	Dir string
+	// Logger is where problems with the cache are logged, the dl package's
+	// logger if it is nil
+	Logger *logrus.Logger
+}
+
+// NewFileCache returns a FileCache storing entries in dir
+func NewFileCache(dir string) *FileCache {
+	return &FileCache{Dir: dir}
+}
+
+func (c *FileCache) logger() *logrus.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return std.log
+}
+
+func (c *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the entry stored for key
+func (c *FileCache) Get(key string) (*CacheEntry, bool) {
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	e := &CacheEntry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		c.logger().Warnf("Ignoring corrupt cache entry for %s: %v\n", redactKey(key), err)
+		return nil, false
+	}
+	return e, true
+}
+
+// Set stores e for key
+func (c *FileCache) Set(key string, e *CacheEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		c.logger().Warnf("Could not cache %s: %v\n", redactKey(key), err)
+		return
+	}
+
+	os.MkdirAll(c.Dir, os.FileMode(0775))
+	tmp, err := ioutil.TempFile(c.Dir, ".tmp-")
+	if err != nil {
+		c.logger().Warnf("Could not cache %s: %v\n", redactKey(key), err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		c.logger().Warnf("Could not cache %s: %v\n", redactKey(key), err)
+	}
+}
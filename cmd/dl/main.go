@@ -0,0 +1,258 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command dl downloads files with the dl package.
+//
+//	dl get [flags] URL
+//	dl batch [flags] manifest.json
+//
+// Logs and progress go to stderr, so stdout only has what was asked for, like
+// the JSON batch report.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/HenrySlawniak/dl"
+	"github.com/HenrySlawniak/dl/dlprogress"
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// headerFlags collects repeated --header flags
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	return fmt.Sprint(map[string]string(h))
+}
+
+func (h headerFlags) Set(v string) error {
+	i := strings.IndexByte(v, ':')
+	if i < 0 {
+		return fmt.Errorf("header %q is not in key:value form", v)
+	}
+	h[strings.TrimSpace(v[:i])] = strings.TrimSpace(v[i+1:])
+	return nil
+}
+
+// manifestJob is a job in a batch manifest
+type manifestJob struct {
+	URL     string            `json:"url"`
+	Dest    string            `json:"dest"`
+	SHA256  string            `json:"sha256"`
+	Headers map[string]string `json:"headers"`
+}
+
+// jobReport is a job's line in the JSON batch report
+type jobReport struct {
+	URL     string  `json:"url"`
+	Dest    string  `json:"dest"`
+	Outcome string  `json:"outcome"`
+	Written int64   `json:"written"`
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"`
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "get":
+		err = get(os.Args[2:])
+	case "batch":
+		err = batch(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dl get [flags] URL")
+	fmt.Fprintln(os.Stderr, "       dl batch [flags] manifest.json")
+	os.Exit(2)
+}
+
+// commonFlags are the flags both commands take
+type commonFlags struct {
+	retries      int
+	limitRate    string
+	quiet        bool
+	jsonProgress bool
+	headers      headerFlags
+}
+
+func (c *commonFlags) register(fs *flag.FlagSet) {
+	c.headers = headerFlags{}
+	fs.IntVar(&c.retries, "retries", 0, "retry failed downloads `N` times, resuming where possible")
+	fs.StringVar(&c.limitRate, "limit-rate", "", "limit all downloads together to `size` bytes a second, like 500K or 2M")
+	fs.BoolVar(&c.quiet, "quiet", false, "only log warnings and errors")
+	fs.BoolVar(&c.jsonProgress, "json-progress", false, "write progress to stderr as JSON lines, once a second per download")
+	fs.Var(c.headers, "header", "send a `key:value` header, can be repeated")
+}
+
+// downloader returns the Downloader the flags describe
+func (c *commonFlags) downloader() (*dl.Downloader, error) {
+	log := logrus.New()
+	log.Out = os.Stderr
+	if c.quiet {
+		log.Level = logrus.WarnLevel
+	}
+
+	opts := []dl.Option{dl.WithLogger(log), dl.WithDefaultHeaders(c.headers)}
+	switch {
+	case c.jsonProgress:
+		opts = append(opts, dl.WithProgress(dl.NewJSONLinesReporter(os.Stderr, time.Second)))
+	case !c.quiet:
+		opts = append(opts, dl.WithProgress(dlprogress.New(os.Stderr).Update))
+	}
+	if c.limitRate != "" {
+		rate, err := humanize.ParseBytes(c.limitRate)
+		if err != nil || rate == 0 {
+			return nil, fmt.Errorf("invalid -limit-rate %q", c.limitRate)
+		}
+		opts = append(opts, dl.WithSharedLimiter(dl.NewRateLimiter(int64(rate))))
+	}
+	return dl.New(opts...), nil
+}
+
+// defaultDest returns the name a download from u is saved as when it isn't
+// given one
+func defaultDest(u *url.URL) string {
+	dest := path.Base(u.Path)
+	if dest == "/" || dest == "." {
+		dest = "index.html"
+	}
+	return dest
+}
+
+func get(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	var c commonFlags
+	c.register(fs)
+	out := fs.String("o", "", "save to `path`, named after the URL by default")
+	sum := fs.String("sha256", "", "fail unless the file has the SHA-256 `hex`")
+	resume := fs.Bool("resume", false, "keep the partial file of a failed or interrupted download and resume it next time")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+	u, err := url.Parse(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	dest := *out
+	if dest == "" {
+		dest = defaultDest(u)
+	}
+	d, err := c.downloader()
+	if err != nil {
+		return err
+	}
+
+	job := dl.Job{Dest: dest, SHA256: *sum}
+	job.URL = u
+	_, err = d.DownloadAll([]dl.Job{job}, dl.BatchOptions{Attempts: c.retries + 1, Resume: *resume})
+	return err
+}
+
+func batch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	var c commonFlags
+	c.register(fs)
+	concurrency := fs.Int("concurrency", dl.DefaultWorkers, "download `N` files at once")
+	asJSON := fs.Bool("json", false, "write the batch report to stdout as JSON")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var manifest []manifestJob
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("reading %s: %v", fs.Arg(0), err)
+	}
+
+	jobs := make([]dl.Job, len(manifest))
+	for i, m := range manifest {
+		u, err := url.Parse(m.URL)
+		if err != nil {
+			return fmt.Errorf("job %d: %v", i, err)
+		}
+		dest := m.Dest
+		if dest == "" {
+			dest = defaultDest(u)
+		}
+		jobs[i] = dl.Job{Dest: dest, SHA256: m.SHA256}
+		jobs[i].URL = u
+		jobs[i].Headers = m.Headers
+	}
+
+	d, err := c.downloader()
+	if err != nil {
+		return err
+	}
+	report, err := d.DownloadAll(jobs, dl.BatchOptions{
+		Concurrency: *concurrency,
+		Attempts:    c.retries + 1,
+	})
+	if report != nil && *asJSON {
+		lines := make([]jobReport, len(report.Results))
+		for i, res := range report.Results {
+			lines[i] = jobReport{
+				URL:     res.Job.URL.Redacted(),
+				Dest:    res.Job.Dest,
+				Outcome: res.Result.Outcome.String(),
+				Written: res.Result.Written,
+				Seconds: res.Result.Duration.Seconds(),
+			}
+			if res.Err != nil {
+				lines[i].Error = res.Err.Error()
+			}
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if eerr := enc.Encode(lines); eerr != nil && err == nil {
+			err = eerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHeaderFlags(t *testing.T) {
+	h := headerFlags{}
+	for _, v := range []string{"Accept: text/plain", "X-Empty:", " X-Spaced :  a: b "} {
+		if err := h.Set(v); err != nil {
+			t.Errorf("Set(%q): %v", v, err)
+		}
+	}
+	want := headerFlags{"Accept": "text/plain", "X-Empty": "", "X-Spaced": "a: b"}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("got %v, want %v", h, want)
+	}
+	if err := h.Set("no colon"); err == nil {
+		t.Error("a header without a colon was accepted")
+	}
+}
+
+func TestCommonFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	var c commonFlags
+	c.register(fs)
+	err := fs.Parse([]string{"-retries", "3", "--limit-rate", "2M", "-quiet", "-header", "A: 1", "-header", "B:2", "http://example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.retries != 3 || c.limitRate != "2M" || !c.quiet || c.jsonProgress {
+		t.Errorf("parsed %+v", c)
+	}
+	if want := (headerFlags{"A": "1", "B": "2"}); !reflect.DeepEqual(c.headers, want) {
+		t.Errorf("headers = %v, want %v", c.headers, want)
+	}
+	if fs.NArg() != 1 || fs.Arg(0) != "http://example.com/" {
+		t.Errorf("args = %v", fs.Args())
+	}
+	if _, err := c.downloader(); err != nil {
+		t.Error(err)
+	}
+
+	for _, rate := range []string{"fast", "0"} {
+		c := commonFlags{quiet: true, limitRate: rate}
+		if _, err := c.downloader(); err == nil {
+			t.Errorf("-limit-rate %s was accepted", rate)
+		}
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	c.register(fs)
+	if err := fs.Parse([]string{"-header", "bad"}); err == nil {
+		t.Error("a bad -header was accepted")
+	}
+}
+
+func TestDefaultDest(t *testing.T) {
+	for _, tc := range []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/a/file.txt", "file.txt"},
+		{"http://example.com/a/dir/", "dir"},
+		{"http://example.com/", "index.html"},
+		{"http://example.com", "index.html"},
+	} {
+		u, _ := url.Parse(tc.url)
+		if got := defaultDest(u); got != tc.want {
+			t.Errorf("defaultDest(%s) = %q, want %q", tc.url, got, tc.want)
+		}
+	}
+}
+
+// newFileServer serves "hello\n" at every path but /missing
+func newFileServer(t *testing.T) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestGet(t *testing.T) {
+	base := newFileServer(t)
+	dest := filepath.Join(t.TempDir(), "out")
+
+	if err := get([]string{"-quiet", "-o", dest, base + "/file"}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(dest); string(b) != "hello\n" {
+		t.Errorf("got %q", b)
+	}
+
+	if err := get([]string{"-quiet", "-o", dest + "2", "-sha256", "00", base + "/file"}); err == nil {
+		t.Error("a download with the wrong SHA-256 succeeded")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	base := newFileServer(t)
+	dir := t.TempDir()
+	manifest, _ := json.Marshal([]manifestJob{
+		{URL: base + "/a", Dest: filepath.Join(dir, "a")},
+		{URL: base + "/missing", Dest: filepath.Join(dir, "missing")},
+	})
+	mpath := filepath.Join(dir, "manifest.json")
+	ioutil.WriteFile(mpath, manifest, 0644)
+
+	// The JSON report goes to stdout
+	out, err := os.Create(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	err = batch([]string{"-quiet", "-json", "-concurrency", "1", mpath})
+	os.Stdout = stdout
+	if err == nil {
+		t.Error("a batch with a 404 succeeded")
+	}
+
+	var report []jobReport
+	data, _ := ioutil.ReadFile(out.Name())
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err, string(data))
+	}
+	if len(report) != 2 {
+		t.Fatalf("report has %d jobs: %s", len(report), data)
+	}
+	if r := report[0]; r.URL != base+"/a" || r.Outcome != "downloaded" || r.Written != 6 || r.Error != "" {
+		t.Errorf("first job: %+v", r)
+	}
+	if r := report[1]; r.URL != base+"/missing" || r.Error == "" {
+		t.Errorf("second job: %+v", r)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "a")); string(b) != "hello\n" {
+		t.Errorf("got %q", b)
+	}
+}
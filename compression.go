@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// compression counts the bytes of a download's compressed responses as they
+// arrive and once they are decompressed
+type compression struct {
+	encoding     atomic.Value
+	compressed   int64
+	uncompressed int64
+}
+
+// compressionKey is the context key for the compression of a download
+type compressionKey struct{}
+
+// withCompression returns a context that counts the compressed responses to
+// requests made with it in c
+func withCompression(ctx context.Context, c *compression) context.Context {
+	return context.WithValue(ctx, compressionKey{}, c)
+}
+
+// gzipTransport does what http.Transport does to transparently ask for and
+// decompress gzip responses, but counts the bytes before and after
+// decompression. The transport it wraps must have compression disabled or
+// be given requests with an Accept-Encoding, so it doesn't do it too.
+type gzipTransport struct {
+	base http.RoundTripper
+}
+
+func (t *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The same requests http.Transport leaves alone
+	if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" || req.Method == "HEAD" {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Header.Get("Content-Encoding") != "gzip" {
+		return resp, err
+	}
+
+	c, _ := req.Context().Value(compressionKey{}).(*compression)
+	if c != nil {
+		c.encoding.Store("gzip")
+	}
+	resp.Body = &gzipBody{body: resp.Body, c: c}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// gzipBody decompresses a response body, counting the bytes read from it
+// and the bytes they decompress to
+type gzipBody struct {
+	body io.ReadCloser
+	c    *compression
+	gz   *gzip.Reader
+	err  error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.gz == nil {
+		b.gz, b.err = gzip.NewReader(compressedReader{b})
+		if b.err != nil {
+			return 0, b.err
+		}
+	}
+
+	n, err := b.gz.Read(p)
+	if b.c != nil {
+		atomic.AddInt64(&b.c.uncompressed, int64(n))
+	}
+	return n, err
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
+
+// compressedReader reads the compressed body of a gzipBody
+type compressedReader struct {
+	b *gzipBody
+}
+
+func (r compressedReader) Read(p []byte) (int, error) {
+	n, err := r.b.body.Read(p)
+	if r.b.c != nil {
+		atomic.AddInt64(&r.b.c.compressed, int64(n))
+	}
+	return n, err
+}
+
+// countsGzip returns whether the Downloader should decompress the responses
+// of rt with a gzipTransport, which is when rt is an http.Transport that
+// would otherwise do it
+func countsGzip(rt http.RoundTripper) bool {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	return ok && !t.DisableCompression
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressionCounts(t *testing.T) {
+	plain := strings.Repeat("compressible ", 1000)
+	gz := gzipped(plain)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" || r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write([]byte(plain))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gz)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	d := New(WithLogger(quietLogger()))
+
+	u, _ := url.Parse(srv.URL + "/gzip")
+	dest := filepath.Join(dir, "gzip")
+	res, err := d.Download(dest, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); string(got) != plain {
+		t.Fatalf("got %d bytes, want %d decompressed", len(got), len(plain))
+	}
+	if res.TransferEncoding != "gzip" || res.CompressedBytes != int64(len(gz)) || res.UncompressedBytes != int64(len(plain)) {
+		t.Errorf("got %q %d -> %d, want gzip %d -> %d", res.TransferEncoding, res.CompressedBytes, res.UncompressedBytes, len(gz), len(plain))
+	}
+
+	u, _ = url.Parse(srv.URL + "/plain")
+	res, err = d.Download(filepath.Join(dir, "plain"), &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TransferEncoding != "" || res.CompressedBytes != 0 || res.UncompressedBytes != 0 {
+		t.Errorf("uncompressed: got %q %d -> %d", res.TransferEncoding, res.CompressedBytes, res.UncompressedBytes)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpOnlyPrefix marks HttpOnly cookies in a cookies.txt file
+const httpOnlyPrefix = "#HttpOnly_"
+
+// LoadCookiesFile reads cookies from a Netscape cookies.txt file, the format
+// curl and most browser extensions export
+func LoadCookiesFile(path string) ([]*http.Cookie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		if httpOnly {
+			line = strings.TrimPrefix(line, httpOnlyPrefix)
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// domain, include subdomains, path, secure, expiry, name, value
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			// Cookies with no value drop the last field
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("dl: %s:%d: expected 7 tab separated fields, got %d", path, n, len(fields))
+		}
+
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("dl: %s:%d: bad expiry %q", path, n, fields[4])
+		}
+
+		c := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expiry > 0 {
+			c.Expires = time.Unix(expiry, 0)
+		}
+		cookies = append(cookies, c)
+	}
+
+	return cookies, scanner.Err()
+}
+
+// SaveCookies writes cookies to a Netscape cookies.txt file that can be read
+// back with LoadCookiesFile
+func SaveCookies(path string, cookies []*http.Cookie) error {
+	var b strings.Builder
+	b.WriteString("# Netscape HTTP Cookie File\n")
+
+	for _, c := range cookies {
+		if c.HttpOnly {
+			b.WriteString(httpOnlyPrefix)
+		}
+
+		cookiePath := c.Path
+		if cookiePath == "" {
+			cookiePath = "/"
+		}
+		var expiry int64
+		if !c.Expires.IsZero() {
+			expiry = c.Expires.Unix()
+		}
+
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			c.Domain, netscapeBool(strings.HasPrefix(c.Domain, ".")), cookiePath,
+			netscapeBool(c.Secure), expiry, c.Name, c.Value)
+	}
+
+	return ioutil.WriteFile(path, []byte(b.String()), os.FileMode(0600))
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// overrideJar hides the jar's cookies that a request already sets itself, so
+// a cookie passed to a call wins over the jar's cookie of the same name
+type overrideJar struct {
+	http.CookieJar
+	names map[string]bool
+}
+
+func (j *overrideJar) Cookies(u *url.URL) []*http.Cookie {
+	var cookies []*http.Cookie
+	for _, c := range j.CookieJar.Cookies(u) {
+		if !j.names[c.Name] {
+			cookies = append(cookies, c)
+		}
+	}
+	return cookies
+}
+
+// addCookies adds cookies to req, with later cookies replacing earlier ones of the same name
+func addCookies(req *http.Request, cookies []*http.Cookie) {
+	last := make(map[string]int)
+	for i, c := range cookies {
+		last[c.Name] = i
+	}
+	for i, c := range cookies {
+		if last[c.Name] == i {
+			req.AddCookie(c)
+		}
+	}
+}
+
+// jarFor returns jar wrapped so it doesn't add cookies req already has
+func jarFor(jar http.CookieJar, req *http.Request) http.CookieJar {
+	own := req.Cookies()
+	if jar == nil || len(own) == 0 {
+		return jar
+	}
+
+	names := make(map[string]bool)
+	for _, c := range own {
+		names[c.Name] = true
+	}
+	return &overrideJar{CookieJar: jar, names: names}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCookieOverride(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Values("Cookie")
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "A"}, {Name: "theme", Value: "dark"}})
+	d := New(WithClient(&http.Client{Jar: jar}))
+
+	if _, err := d.GetBodyFromURL(u, nil, &[]*http.Cookie{{Name: "session", Value: "B"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "session=B; theme=dark" {
+		t.Fatalf("sent %q", got)
+	}
+
+	// The jar still has its own cookie for calls without one
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "session=A; theme=dark" {
+		t.Fatalf("sent %q", got)
+	}
+}
+
+const sampleCookiesFile = `# Netscape HTTP Cookie File
+# https://curl.se/docs/http-cookies.html
+
+.example.com	TRUE	/	TRUE	2000000000	session	abc123
+#HttpOnly_example.com	FALSE	/account	FALSE	0	csrf	x=y
+example.org	FALSE	/	FALSE	0	empty
+`
+
+func TestLoadCookiesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := ioutil.WriteFile(path, []byte(sampleCookiesFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies, err := LoadCookiesFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*http.Cookie{
+		{Domain: ".example.com", Path: "/", Secure: true, Expires: time.Unix(2000000000, 0), Name: "session", Value: "abc123"},
+		{Domain: "example.com", Path: "/account", HttpOnly: true, Name: "csrf", Value: "x=y"},
+		{Domain: "example.org", Path: "/", Name: "empty"},
+	}
+	if len(cookies) != len(want) {
+		t.Fatalf("got %d cookies, want %d", len(cookies), len(want))
+	}
+	for i, c := range cookies {
+		w := want[i]
+		if c.Domain != w.Domain || c.Path != w.Path || c.Secure != w.Secure || c.HttpOnly != w.HttpOnly ||
+			!c.Expires.Equal(w.Expires) || c.Name != w.Name || c.Value != w.Value {
+			t.Errorf("cookie %d is %+v, want %+v", i, c, w)
+		}
+	}
+}
+
+func TestLoadCookiesFileMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	ioutil.WriteFile(path, []byte(".example.com\tTRUE\t/\tTRUE\tsoon\tsession\tabc\n"), 0600)
+	if _, err := LoadCookiesFile(path); err == nil {
+		t.Fatal("expected an error for a bad expiry")
+	}
+
+	ioutil.WriteFile(path, []byte("not a cookie\n"), 0600)
+	if _, err := LoadCookiesFile(path); err == nil {
+		t.Fatal("expected an error for a line without tabs")
+	}
+}
+
+func TestSaveCookies(t *testing.T) {
+	in := []*http.Cookie{
+		{Name: "session", Value: "abc123", Domain: ".example.com", Path: "/", Secure: true, HttpOnly: true, Expires: time.Unix(2000000000, 0)},
+		{Name: "empty", Value: "", Domain: "example.org", Path: "/x"},
+	}
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := SaveCookies(path, in); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := LoadCookiesFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got %+v %+v", out[0], out[1])
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parseDataURL decodes a data URL into its media type and payload
+func parseDataURL(u *url.URL) (string, []byte, error) {
+	raw := u.Opaque
+	if raw == "" {
+		raw = strings.TrimPrefix(u.String(), "data:")
+	}
+
+	comma := strings.IndexByte(raw, ',')
+	if comma < 0 {
+		return "", nil, fmt.Errorf("dl: invalid data URL %q: missing comma", dataPrefix(raw))
+	}
+	meta, payload := raw[:comma], raw[comma+1:]
+
+	isBase64 := false
+	if strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		isBase64 = true
+		meta = meta[:len(meta)-len(";base64")]
+	}
+
+	mediaType := meta
+	switch {
+	case mediaType == "":
+		mediaType = "text/plain;charset=US-ASCII"
+	case strings.HasPrefix(mediaType, ";"):
+		mediaType = "text/plain" + mediaType
+	}
+
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("dl: invalid data URL %q: %v", dataPrefix(raw), err)
+	}
+	if !isBase64 {
+		return mediaType, []byte(data), nil
+	}
+
+	// Base64 payloads are often wrapped across lines, which isn't part of the data
+	data = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			return -1
+		}
+		return r
+	}, data)
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("dl: invalid data URL %q: bad base64: %v", dataPrefix(raw), err)
+	}
+	return mediaType, decoded, nil
+}
+
+// dataPrefix returns the start of a data URL for error messages
+func dataPrefix(raw string) string {
+	const max = 32
+	if len(raw) > max {
+		raw = raw[:max] + "..."
+	}
+	return "data:" + raw
+}
+
+// dataRoundTrip answers a request for a data URL with its decoded payload
+func dataRoundTrip(req *http.Request) (*http.Response, error) {
+	mediaType, data, err := parseDataURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &http.Response{
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}
+	fileStatus(resp, http.StatusOK)
+	resp.Header.Set("Content-Type", mediaType)
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+
+	if req.Method == "HEAD" {
+		resp.Body = http.NoBody
+	}
+	return resp, nil
+}
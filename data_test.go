@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestDataURL(t *testing.T) {
+	dir := t.TempDir()
+	for i, tt := range []struct {
+		url, want string
+	}{
+		{"data:text/plain;base64,SGVsbG8sIFdvcmxkIQ==", "Hello, World!"},
+		{"data:,A%20brief%20note", "A brief note"},
+		{"data:text/plain;base64,aGVs%0AbG8g%20d29y%0D%0AbGQ=", "hello world"},
+	} {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(dir, strconv.Itoa(i))
+		n, err := New().DownloadFile(dest, u, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		if got, _ := ioutil.ReadFile(dest); string(got) != tt.want || n != int64(len(tt.want)) {
+			t.Errorf("%s: wrote %d bytes %q, want %q", tt.url, n, got, tt.want)
+		}
+	}
+}
+
+func TestDataURLMalformed(t *testing.T) {
+	for _, raw := range []string{
+		"data:text/plain;base64",
+		"data:text/plain;base64,not*base64",
+	} {
+		u, _ := url.Parse(raw)
+		if _, err := New().GetBodyFromURL(u, nil, nil); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SetDedupDir sets the directory the dl package indexes downloads by content
+// in, see WithDedupDir
+func SetDedupDir(dir string) {
+	WithDedupDir(dir)(std)
+}
+
+// WithDedupDir deduplicates downloads by their content. Every downloaded file
+// is hardlinked into dir under its SHA-256, and a download whose content is
+// already there is replaced with a link to the existing copy, a symlink if a
+// hardlink isn't possible. dir should be on the same filesystem as the
+// downloads for hardlinks to work. It only applies to downloads written with
+// OSFS, and an empty dir turns it off.
+func WithDedupDir(dir string) Option {
+	return func(d *Downloader) {
+		d.dedupDir = dir
+	}
+}
+
+// dedup links the file at fileloc with any identical file in the dedup directory
+func (d *Downloader) dedup(fileloc string) {
+	if _, ok := d.fs.(OSFS); !ok {
+		return
+	}
+
+	sum, err := d.fileHash(fileloc, "sha256")
+	if err != nil {
+		d.log.Warnf("Could not deduplicate %s: %v\n", fileloc, err)
+		return
+	}
+	stored := filepath.Join(d.dedupDir, sum[:2], sum)
+
+	os.MkdirAll(filepath.Dir(stored), os.FileMode(0775))
+	err = os.Link(fileloc, stored)
+	if err == nil {
+		return
+	}
+	if !os.IsExist(err) {
+		d.log.Warnf("Could not deduplicate %s: %v\n", fileloc, err)
+		return
+	}
+
+	// Something with the same content was downloaded before
+	a, err := os.Stat(fileloc)
+	if err != nil {
+		return
+	}
+	b, err := os.Stat(stored)
+	if err != nil || os.SameFile(a, b) || a.Size() != b.Size() {
+		return
+	}
+
+	tmp := fileloc + ".dedup"
+	os.Remove(tmp)
+	if err := os.Link(stored, tmp); err != nil {
+		abs, aerr := filepath.Abs(stored)
+		if aerr != nil {
+			d.log.Warnf("Could not deduplicate %s: %v\n", fileloc, aerr)
+			return
+		}
+		if err := os.Symlink(abs, tmp); err != nil {
+			d.log.Warnf("Could not deduplicate %s: %v\n", fileloc, err)
+			return
+		}
+	}
+	if err := os.Rename(tmp, fileloc); err != nil {
+		os.Remove(tmp)
+		d.log.Warnf("Could not deduplicate %s: %v\n", fileloc, err)
+		return
+	}
+
+	d.log.Infof("Linked %s to an identical earlier download\n", filepath.Base(fileloc))
+}
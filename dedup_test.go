@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupDir(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/other" {
+			w.Write([]byte("different content"))
+			return
+		}
+		w.Write([]byte("same content"))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	d := New(WithDedupDir(filepath.Join(dir, "store")))
+
+	for _, name := range []string{"first", "second", "other"} {
+		path := "/" + name
+		if name != "other" {
+			path = "/same/" + name
+		}
+		u, _ := url.Parse(srv.URL + path)
+		if _, err := d.DownloadFile(filepath.Join(dir, name), u, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, _ := os.Stat(filepath.Join(dir, "first"))
+	second, _ := os.Stat(filepath.Join(dir, "second"))
+	other, _ := os.Stat(filepath.Join(dir, "other"))
+	if !os.SameFile(first, second) {
+		t.Fatal("second download isn't a link to the first")
+	}
+	if os.SameFile(first, other) {
+		t.Fatal("different content was linked")
+	}
+	if body, _ := ioutil.ReadFile(filepath.Join(dir, "second")); string(body) != "same content" {
+		t.Fatalf("got %q", body)
+	}
+}
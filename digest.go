@@ -0,0 +1,183 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// ChecksumMismatchError is returned when a file doesn't have the checksum it
+// is supposed to. It matches ErrChecksumMismatch with errors.Is.
+type ChecksumMismatchError struct {
+	Path      string
+	Algorithm string
+	// Expected and Actual are hex encoded
+	Expected string
+	Actual   string
+	// Source is where the expected checksum came from, such as the header
+	// that held it
+	Source string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	msg := fmt.Sprintf("dl: %s has %s %s, expected %s", e.Path, e.Algorithm, e.Actual, e.Expected)
+	if e.Source != "" {
+		msg += " from " + e.Source
+	}
+	return msg
+}
+
+// Is makes a ChecksumMismatchError match ErrChecksumMismatch
+func (e *ChecksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// httpDigests are the algorithms digest headers are checked with, strongest first
+var httpDigests = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha-512", sha512.New},
+	{"sha-256", sha256.New},
+	{"md5", md5.New},
+}
+
+// digestHeaders are the headers that can hold the digest of a response, in
+// the order they are preferred
+var digestHeaders = []string{"Repr-Digest", "Content-Digest", "Digest", "Content-MD5"}
+
+// SetVerifyDigests sets whether the dl package checks downloads against
+// digest headers, see WithVerifyDigests
+func SetVerifyDigests(verify bool) {
+	WithVerifyDigests(verify)(std)
+}
+
+// WithVerifyDigests sets whether downloads are checked against the digest a
+// server sends in a Repr-Digest, Content-Digest, Digest or Content-MD5
+// header, failing with a ChecksumMismatchError if they don't match. It is on
+// by default. Compressed and partial responses aren't checked, since their
+// digest can describe different bytes than were received, except that a
+// download made in segments is checked against the Repr-Digest of the file.
+func WithVerifyDigests(verify bool) Option {
+	return func(d *Downloader) {
+		d.skipDigests = !verify
+	}
+}
+
+// digestCheck hashes a response body to compare it with a digest header
+type digestCheck struct {
+	header    string
+	algorithm string
+	want      []byte
+	hash      hash.Hash
+}
+
+// newDigestCheck returns the check for the strongest digest resp has a header
+// for, or nil if it has none that can be checked
+func (d *Downloader) newDigestCheck(resp *http.Response) *digestCheck {
+	if d.skipDigests || resp.StatusCode == http.StatusPartialContent || resp.Uncompressed {
+		return nil
+	}
+	return digestCheckFor(resp.Header, digestHeaders)
+}
+
+// reprDigestCheck returns the check for the Repr-Digest in h, which is the
+// digest of the whole file even in a partial response, or nil if it has none
+// that can be checked
+func (d *Downloader) reprDigestCheck(h http.Header) *digestCheck {
+	if d.skipDigests {
+		return nil
+	}
+	return digestCheckFor(h, []string{"Repr-Digest"})
+}
+
+// digestCheckFor returns the check for the strongest digest in the first of
+// headers that h has one in, or nil if there is none or the body is encoded
+func digestCheckFor(h http.Header, headers []string) *digestCheck {
+	if enc := h.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		return nil
+	}
+
+	for _, header := range headers {
+		v := h.Get(header)
+		if v == "" {
+			continue
+		}
+
+		sums := map[string]string{"md5": v}
+		if header != "Content-MD5" {
+			sums = parseDigests(v)
+		}
+		for _, alg := range httpDigests {
+			want, err := base64.StdEncoding.DecodeString(sums[alg.name])
+			if err != nil || len(want) == 0 {
+				continue
+			}
+			return &digestCheck{header: header, algorithm: alg.name, want: want, hash: alg.new()}
+		}
+	}
+	return nil
+}
+
+// parseDigests parses the algorithm=value pairs of a digest header, lower
+// casing the algorithms and stripping the colons structured fields wrap the
+// values in
+func parseDigests(v string) map[string]string {
+	sums := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		i := strings.IndexByte(pair, '=')
+		if i < 0 {
+			continue
+		}
+		alg := strings.ToLower(strings.TrimSpace(pair[:i]))
+		sums[alg] = strings.Trim(strings.TrimSpace(pair[i+1:]), ":")
+	}
+	return sums
+}
+
+// Write hashes p
+func (c *digestCheck) Write(p []byte) (int, error) {
+	return c.hash.Write(p)
+}
+
+// verify compares what was hashed with the digest, path names the file in the error
+func (c *digestCheck) verify(path string) error {
+	got := c.hash.Sum(nil)
+	if !bytes.Equal(got, c.want) {
+		return &ChecksumMismatchError{
+			Path:      path,
+			Algorithm: c.algorithm,
+			Expected:  hex.EncodeToString(c.want),
+			Actual:    hex.EncodeToString(got),
+			Source:    c.header,
+		}
+	}
+	return nil
+}
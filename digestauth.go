@@ -0,0 +1,314 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SetDigestAuth answers HTTP Digest authentication challenges for the dl
+// package, see WithDigestAuth
+func SetDigestAuth(user, pass string, hosts ...string) {
+	WithDigestAuth(user, pass, hosts...)(std)
+}
+
+// WithDigestAuth answers HTTP Digest authentication challenges (RFC 7616)
+// with user and pass. A request that is answered with a challenge is sent
+// again with the answer, and later requests to the same host answer the last
+// challenge up front, counting up its nonce, until the server sends a fresh
+// one. MD5 and SHA-256 with qop=auth are supported. An empty user turns it
+// off.
+//
+// Only challenges from hosts matching one of hosts, patterns like
+// WithAllowedHosts takes, are answered, or from any host a download is
+// started from if there are none. Like netrc credentials, challenges are
+// never answered once a request has been redirected to another host.
+func WithDigestAuth(user, pass string, hosts ...string) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if user == "" {
+			d.digestAuth = nil
+			return
+		}
+		d.digestAuth = &digestAuth{user: user, pass: pass, hosts: lowerAll(hosts), challenges: make(map[string]*digestChallenge)}
+	}
+}
+
+// digestAuth holds the credentials and the last challenge from each host
+type digestAuth struct {
+	user, pass string
+	// hosts are the patterns of the hosts the credentials are for, any host
+	// if empty
+	hosts []string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+// digestChallenge is a parsed WWW-Authenticate: Digest header
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	// stale is set when the server refused an answer for using an old nonce
+	stale bool
+	// nc is how many times the nonce has been used
+	nc int
+}
+
+// digestTransport answers digest challenges to requests sent through base
+type digestTransport struct {
+	base http.RoundTripper
+	auth *digestAuth
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.auth.answers(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	host := req.URL.Host
+	sent := false
+	r := req
+	if header, ok := t.auth.answer(host, req); ok {
+		r = req.Clone(req.Context())
+		r.Header.Set("Authorization", header)
+		sent = true
+	}
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	c := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if c == nil || (sent && !c.stale) {
+		// Not a digest challenge, or the answer was refused
+		return resp, nil
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	t.auth.mu.Lock()
+	t.auth.challenges[host] = c
+	t.auth.mu.Unlock()
+
+	header, ok := t.auth.answer(host, req)
+	if !ok {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body.Close()
+
+	r = req.Clone(req.Context())
+	if req.GetBody != nil {
+		if r.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	r.Header.Set("Authorization", header)
+	return t.base.RoundTrip(r)
+}
+
+// answers reports whether the credentials are for req's host, and req
+// hasn't been redirected there from another host
+func (a *digestAuth) answers(req *http.Request) bool {
+	host := strings.ToLower(req.URL.Hostname())
+	if len(a.hosts) > 0 && !hostMatches(a.hosts, host) {
+		return false
+	}
+	for r := req; r.Response != nil && r.Response.Request != nil; {
+		r = r.Response.Request
+		if !strings.EqualFold(r.URL.Hostname(), host) {
+			return false
+		}
+	}
+	return true
+}
+
+// answer returns the Authorization header answering the last challenge from
+// host for req, if there was one
+func (a *digestAuth) answer(host string, req *http.Request) (string, bool) {
+	a.mu.Lock()
+	c, ok := a.challenges[host]
+	var nc int
+	if ok {
+		c.nc++
+		nc = c.nc
+	}
+	a.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+
+	newHash := md5.New
+	algo := strings.ToUpper(c.algorithm)
+	if strings.HasPrefix(algo, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		sum := newHash()
+		io.WriteString(sum, s)
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	cnonce := make([]byte, 16)
+	rand.Read(cnonce)
+	cn := hex.EncodeToString(cnonce)
+	ncs := fmt.Sprintf("%08x", nc)
+	uri := req.URL.RequestURI()
+
+	ha1 := h(a.user + ":" + c.realm + ":" + a.pass)
+	if strings.HasSuffix(algo, "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cn)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	var response string
+	if c.qop != "" {
+		response = h(ha1 + ":" + c.nonce + ":" + ncs + ":" + cn + ":" + c.qop + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+
+	parts := []string{
+		"username=" + quoteString(a.user),
+		"realm=" + quoteString(c.realm),
+		"nonce=" + quoteString(c.nonce),
+		"uri=" + quoteString(uri),
+		"response=" + quoteString(response),
+	}
+	if c.algorithm != "" {
+		parts = append(parts, "algorithm="+c.algorithm)
+	}
+	if c.opaque != "" {
+		parts = append(parts, "opaque="+quoteString(c.opaque))
+	}
+	if c.qop != "" {
+		parts = append(parts, "qop="+c.qop, "nc="+ncs, "cnonce="+quoteString(cn))
+	}
+	return "Digest " + strings.Join(parts, ", "), true
+}
+
+// quoteEscaper escapes the characters of an HTTP quoted-string that need it
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quoteString returns s as an HTTP quoted-string (RFC 7230 section 3.2.6)
+func quoteString(s string) string {
+	return `"` + quoteEscaper.Replace(s) + `"`
+}
+
+// parseDigestChallenge returns the best digest challenge in the
+// WWW-Authenticate headers, preferring SHA-256 to MD5, or nil if there isn't
+// one this can answer
+func parseDigestChallenge(headers []string) *digestChallenge {
+	var best *digestChallenge
+	for _, header := range headers {
+		if len(header) < 7 || !strings.EqualFold(header[:7], "Digest ") {
+			continue
+		}
+		params := parseAuthParams(header[7:])
+
+		c := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+		}
+		if c.nonce == "" {
+			continue
+		}
+		c.stale = strings.EqualFold(params["stale"], "true")
+
+		if qop, ok := params["qop"]; ok {
+			for _, q := range strings.Split(qop, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					c.qop = "auth"
+				}
+			}
+			if c.qop == "" {
+				// Only auth-int is offered, which needs the body hashed
+				continue
+			}
+		}
+
+		switch strings.ToUpper(c.algorithm) {
+		case "", "MD5", "MD5-SESS":
+			if best == nil {
+				best = c
+			}
+		case "SHA-256", "SHA-256-SESS":
+			best = c
+		}
+	}
+	return best
+}
+
+// parseAuthParams parses the comma separated key=value and key="value"
+// parameters of an authentication challenge
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var val strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				val.WriteByte(s[i])
+			}
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			val.WriteString(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+		params[key] = val.String()
+	}
+}
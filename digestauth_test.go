@@ -0,0 +1,248 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// digestServer is a server behind digest authentication that records the
+// Authorization headers it gets
+type digestServer struct {
+	*httptest.Server
+	user, pass string
+	// challenges are the WWW-Authenticate headers it sends
+	challenges []string
+
+	mu    sync.Mutex
+	nonce string
+	auths []string
+}
+
+func newDigestServer(t *testing.T, user, pass string, challenges ...string) *digestServer {
+	t.Helper()
+	s := &digestServer{user: user, pass: pass, challenges: challenges, nonce: "n1"}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	auth := r.Header.Get("Authorization")
+	s.auths = append(s.auths, auth)
+
+	challenge := func(stale bool) {
+		for _, c := range s.challenges {
+			c = strings.Replace(c, "NONCE", s.nonce, 1)
+			if stale {
+				c += ", stale=true"
+			}
+			w.Header().Add("WWW-Authenticate", c)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	if !strings.HasPrefix(auth, "Digest ") {
+		challenge(false)
+		return
+	}
+
+	p := parseAuthParams(auth[7:])
+	newHash := md5.New
+	if p["algorithm"] == "SHA-256" {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		sum := newHash()
+		io.WriteString(sum, s)
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+	ha1 := h(s.user + ":" + p["realm"] + ":" + s.pass)
+	ha2 := h(r.Method + ":" + r.URL.RequestURI())
+	want := h(ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":" + p["qop"] + ":" + ha2)
+	switch {
+	case p["username"] != s.user || p["uri"] != r.URL.RequestURI() || p["response"] != want || p["opaque"] != "o":
+		challenge(false)
+	case p["nonce"] != s.nonce:
+		challenge(true)
+	default:
+		io.WriteString(w, p["algorithm"]+" "+p["nc"])
+	}
+}
+
+// authorizations returns the Authorization headers the server got and forgets
+// them
+func (s *digestServer) authorizations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	auths := s.auths
+	s.auths = nil
+	return auths
+}
+
+func TestDigestAuth(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		challenges []string
+		want       string
+	}{
+		{"MD5", []string{`Digest realm="r", nonce="NONCE", qop="auth,auth-int", algorithm=MD5, opaque="o"`}, "MD5"},
+		{"SHA-256", []string{`Digest realm="r", nonce="NONCE", qop="auth", algorithm=SHA-256, opaque="o"`}, "SHA-256"},
+		{"prefers SHA-256", []string{
+			`Basic realm="r"`,
+			`Digest realm="r", nonce="NONCE", qop="auth", algorithm=MD5, opaque="o"`,
+			`Digest realm="r", nonce="NONCE", qop="auth", algorithm=SHA-256, opaque="o"`,
+		}, "SHA-256"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newDigestServer(t, "user", "pass", tc.challenges...)
+			u, _ := url.Parse(srv.URL + "/f?x=1")
+			d := New(WithLogger(quietLogger()), WithDigestAuth("user", "pass"))
+
+			// The challenge is answered by sending the request again
+			body, err := d.GetBodyFromURL(u, nil, nil)
+			if err != nil || string(body) != tc.want+" 00000001" {
+				t.Fatalf("got %q, %v", body, err)
+			}
+			if auths := srv.authorizations(); len(auths) != 2 || auths[0] != "" {
+				t.Fatalf("sent %q", auths)
+			}
+
+			// Later requests answer it up front, counting up the nonce
+			for _, nc := range []string{"00000002", "00000003"} {
+				body, err = d.GetBodyFromURL(u, nil, nil)
+				if err != nil || string(body) != tc.want+" "+nc {
+					t.Fatalf("got %q, %v, want nc %s", body, err, nc)
+				}
+			}
+			if auths := srv.authorizations(); len(auths) != 2 {
+				t.Fatalf("sent %q, want answers up front", auths)
+			}
+		})
+	}
+}
+
+func TestDigestAuthStale(t *testing.T) {
+	srv := newDigestServer(t, "user", "pass", `Digest realm="r", nonce="NONCE", qop="auth", opaque="o"`)
+	u, _ := url.Parse(srv.URL)
+	d := New(WithLogger(quietLogger()), WithDigestAuth("user", "pass"))
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	srv.authorizations()
+
+	// The old nonce is refused as stale, so the fresh one is answered from
+	// the start of its count
+	srv.mu.Lock()
+	srv.nonce = "n2"
+	srv.mu.Unlock()
+	body, err := d.GetBodyFromURL(u, nil, nil)
+	if err != nil || string(body) != " 00000001" {
+		t.Fatalf("got %q, %v", body, err)
+	}
+	auths := srv.authorizations()
+	if len(auths) != 2 || !strings.Contains(auths[0], `nonce="n1"`) || !strings.Contains(auths[1], `nonce="n2"`) {
+		t.Fatalf("sent %q", auths)
+	}
+
+	// A wrong password is refused without asking again
+	d = New(WithLogger(quietLogger()), WithDigestAuth("user", "wrong"))
+	if _, err := d.GetBodyFromURL(u, nil, nil); err == nil {
+		t.Fatal("wrong password was accepted")
+	}
+	if auths := srv.authorizations(); len(auths) != 2 {
+		t.Fatalf("sent %q", auths)
+	}
+}
+
+func TestDigestAuthQuoting(t *testing.T) {
+	user := `do"main\user`
+	srv := newDigestServer(t, user, "pass", `Digest realm="r", nonce="NONCE", qop="auth", opaque="o"`)
+	u, _ := url.Parse(srv.URL + `/a%22b`)
+	d := New(WithLogger(quietLogger()), WithDigestAuth(user, "pass"))
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	auths := srv.authorizations()
+	if len(auths) != 2 || !strings.Contains(auths[1], `username="do\"main\\user"`) {
+		t.Fatalf("sent %q", auths)
+	}
+
+	for s, want := range map[string]string{
+		"plain":   `"plain"`,
+		`a"b`:     `"a\"b"`,
+		`a\b`:     `"a\\b"`,
+		`\x00`:    `"\\x00"`,
+		"unicodé": `"unicodé"`,
+	} {
+		if got := quoteString(s); got != want {
+			t.Errorf("quoteString(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestDigestAuthHosts(t *testing.T) {
+	challenge := `Digest realm="r", nonce="NONCE", qop="auth", opaque="o"`
+	srv := newDigestServer(t, "user", "pass", challenge)
+	u, _ := url.Parse(srv.URL)
+
+	// Credentials for another host aren't used
+	d := New(WithLogger(quietLogger()), WithDigestAuth("user", "pass", "*.example.com"))
+	if _, err := d.GetBodyFromURL(u, nil, nil); err == nil {
+		t.Fatal("answered a challenge from another host")
+	}
+	if auths := srv.authorizations(); len(auths) != 1 || auths[0] != "" {
+		t.Fatalf("sent %q", auths)
+	}
+	WithDigestAuth("user", "pass", "127.0.0.*")(d)
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	srv.authorizations()
+
+	// Nor after being redirected to another host, even one they are for
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		to := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+		http.Redirect(w, r, to+"/f", http.StatusFound)
+	}))
+	defer redirect.Close()
+	from, _ := url.Parse(redirect.URL)
+	d = New(WithLogger(quietLogger()), WithDigestAuth("user", "pass"))
+	_, err := d.GetBodyFromURL(from, nil, nil)
+	var status *HTTPError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %v, want a 401", err)
+	}
+	if auths := srv.authorizations(); len(auths) != 1 || auths[0] != "" {
+		t.Fatalf("sent %q", auths)
+	}
+}
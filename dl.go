@@ -21,36 +21,39 @@
 package dl
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
 	"github.com/dustin/go-humanize"
 	"github.com/sirupsen/logrus"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sync/atomic"
+	"time"
 )
 
-var (
-	userAgent = "dl v0.0.1"
-	client    = &http.Client{}
-	log       = logrus.New()
-)
+// std is the Downloader used by the package level functions
+var std = New()
 
-// SetUserAgent will set the user agent to use with the http download client
+// SetUserAgent will set the user agent to use with the http download client.
+// A single call can use another one with a User-Agent header or
+// RequestSpec.UserAgent without changing this.
 func SetUserAgent(ua string) {
-	userAgent = ua
+	WithUserAgent(ua)(std)
 }
 
 // SetClient sets the http client used by the dl package
 func SetClient(c *http.Client) {
-	client = c
+	WithClient(c)(std)
 }
 
 // SetLogger sets the logger used by the dl package
 func SetLogger(l *logrus.Logger) {
-	log = l
+	std.log = l
 }
 
 // FileExists checks if the file already exists on disk
@@ -63,154 +66,340 @@ func FileExists(filename string) bool {
 
 // GetBodyFromURL will return the body of the url
 func GetBodyFromURL(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) ([]byte, error) {
-	req, err := http.NewRequest("GET", u.String(), nil)
+	return std.GetBodyFromURL(u, headers, cookies)
+}
+
+// GetReaderFromURL will return a seekable reader over the body of the url and its length
+func GetReaderFromURL(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (*bytes.Reader, int64, error) {
+	return std.GetReaderFromURL(u, headers, cookies)
+}
+
+// GetRespFromURL will return the http.Response to a url
+func GetRespFromURL(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (*http.Response, error) {
+	return std.GetRespFromURL(u, headers, cookies)
+}
+
+// DownloadFile will download the url to fileloc
+func DownloadFile(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	return std.DownloadFile(fileloc, u, headers, cookies)
+}
+
+// DownloadFileRequest will download the response to spec to fileloc
+func DownloadFileRequest(fileloc string, spec *RequestSpec) (int64, error) {
+	return std.DownloadFileRequest(fileloc, spec)
+}
+
+// Download will download the response to spec to fileloc, see Downloader.Download
+func Download(fileloc string, spec *RequestSpec) (DownloadResult, error) {
+	return std.Download(fileloc, spec)
+}
+
+// GetBodyFromURL will return the body of the url
+func (d *Downloader) GetBodyFromURL(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) ([]byte, error) {
+	req, err := d.newRequest(newSpec(u, headers, cookies))
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", userAgent)
-	for _, c := range *cookies {
-		req.AddCookie(c)
-	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	cache := d.cacheable(req)
+	var cached *CacheEntry
+	if cache {
+		if e, _, ok := d.cacheGet(req); ok {
+			if time.Now().Before(e.Expires) {
+				if err := d.validate(cachedResponse(req, e)); err != nil {
+					return nil, err
+				}
+				return e.Body, nil
+			}
+
+			cached = e
+			if e.ETag != "" {
+				req.Header.Set("If-None-Match", e.ETag)
+			}
+			if e.LastModified != "" {
+				req.Header.Set("If-Modified-Since", e.LastModified)
+			}
+		}
 	}
 
-	resp, err := client.Do(req)
+	resp, err := d.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return ioutil.ReadAll(resp.Body)
-}
-
-// GetRespFromURL will return the http.Response to a url
-func GetRespFromURL(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (*http.Response, error) {
-	req, err := http.NewRequest("GET", u.String(), nil)
-	if err != nil {
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		if err := d.validate(cachedResponse(req, cached)); err != nil {
+			return nil, err
+		}
+		if fresh, ok := freshUntil(resp.Header); ok {
+			cached.Expires = fresh
+			d.cacheSet(req, cached)
+		}
+		return cached.Body, nil
+	}
 
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	if err := d.validate(resp); err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", userAgent)
-	for _, c := range *cookies {
-		req.AddCookie(c)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
 	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
+
+	if cache && resp.StatusCode == http.StatusOK {
+		if e := newCacheEntry(resp.Header, body); e != nil {
+			d.cacheSet(req, e)
+		}
 	}
 
-	return client.Do(req)
+	return body, nil
 }
 
-// DownloadFile will download the url to fileloc
-func DownloadFile(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
-	req, err := http.NewRequest("GET", u.String(), nil)
+// GetReaderFromURL will return a seekable reader over the body of the url and its length
+func (d *Downloader) GetReaderFromURL(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (*bytes.Reader, int64, error) {
+	body, err := d.GetBodyFromURL(u, headers, cookies)
 	if err != nil {
-
-		return 0, err
+		return nil, 0, err
 	}
 
-	req.Header.Set("User-Agent", userAgent)
-	for _, c := range *cookies {
-		req.AddCookie(c)
-	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
+	return bytes.NewReader(body), int64(len(body)), nil
+}
 
-	if !FileExists(fileloc) {
-		// File isn't there, don't bother trying to avoid clobber
-		return writeToFileFromURL(fileloc, u, headers, cookies)
+// GetRespFromURL will return the http.Response to a url
+func (d *Downloader) GetRespFromURL(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (*http.Response, error) {
+	req, err := d.newRequest(newSpec(u, headers, cookies))
+	if err != nil {
+		return nil, err
 	}
 
-	head, err := client.Do(req)
-	if err != nil {
+	return d.do(req)
+}
 
-		return 0, err
-	}
-	head.Body.Close()
+// DownloadFile will download the url to fileloc
+func (d *Downloader) DownloadFile(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	return d.DownloadFileRequest(fileloc, newSpec(u, headers, cookies))
+}
 
-	if head.Header.Get("Content-Length") == "" {
-		// We didn't get the content length in the response
-		return writeToFileFromURL(fileloc, u, headers, cookies)
-	}
+// DownloadFileRequest will download the response to spec to fileloc. A file
+// that was skipped because it was already up to date returns 0, use Download
+// to tell that apart from an empty file.
+func (d *Downloader) DownloadFileRequest(fileloc string, spec *RequestSpec) (int64, error) {
+	return d.download(fileloc, spec, 1)
+}
+
+// Download will download the response to spec to fileloc, unless the file is
+// already up to date. The result's Outcome says which happened.
+func (d *Downloader) Download(fileloc string, spec *RequestSpec) (DownloadResult, error) {
+	return d.fetch(fileloc, spec, 1)
+}
+
+// download will download the response to spec to fileloc unless the file on
+// disk is already up to date, making up to attempts attempts
+func (d *Downloader) download(fileloc string, spec *RequestSpec, attempts int) (int64, error) {
+	res, err := d.fetch(fileloc, spec, attempts)
+	return res.Written, err
+}
 
-	length, err := strconv.ParseInt(head.Header.Get("Content-Length"), 10, 0)
+// fetch does the work of download, describing what it did in the result
+func (d *Downloader) fetch(fileloc string, spec *RequestSpec, attempts int) (DownloadResult, error) {
+	return d.fetchTransfer(newTransfer(fileloc, spec), attempts)
+}
+
+// fetchTransfer does the work of fetch for t
+func (d *Downloader) fetchTransfer(t *transfer, attempts int) (res DownloadResult, err error) {
+	fileloc, spec := t.fileloc, t.spec
+	release := acquireSlot()
+	defer release()
+	defer func() { d.reportFinished(t, res, err) }()
+
+	ctx, end := d.startSpan(fileloc, spec)
+	defer func() { end(res, err) }()
+	ctx, timedOut := d.withDownloadTimeout(ctx)
+	defer func() { err = timedOut(err) }()
+
+	start := d.clock.Now()
+	res = DownloadResult{URL: spec.URL, Path: fileloc, Meta: spec.Meta}
+	ctx, stopped, err := d.track(ctx)
 	if err != nil {
-		// content length can't be parsed, force dl
-		return writeToFileFromURL(fileloc, u, headers, cookies)
+		return res, err
 	}
+	defer func() { err = stopped(err) }()
 
-	f, err := os.Open(fileloc)
+	var size int64
+	var skip bool
+	if !t.fresh {
+		size, skip, err = d.upToDate(ctx, fileloc, spec)
+	}
 	if err != nil {
+		atomic.AddInt64(&d.stats.downloadsFailed, 1)
+		return res, err
+	}
+	if skip && t.verify != nil {
+		if verr := t.verify(fileloc); verr != nil {
+			d.log.Warnf("Downloading %s again: %v\n", filepath.Base(fileloc), verr)
+			skip = false
+		}
+	}
+	if skip {
+		atomic.AddInt64(&d.stats.downloadsSkipped, 1)
+		res.Size = size
+		res.Outcome = SkippedSameSize
+		res.Duration = d.clock.Now().Sub(start)
+		if err := d.verifyChecksums(t); err != nil {
+			atomic.AddInt64(&d.stats.downloadsFailed, 1)
+			return res, err
+		}
+		return res, nil
+	}
 
-		return 0, err
+	atomic.AddInt64(&d.stats.downloadsStarted, 1)
+	atomic.AddInt64(&d.stats.activeDownloads, 1)
+	t.ctx = ctx
+	err = errNotSegmentable
+	if d.segmentable(t) {
+		err = d.downloadSegmented(t, attempts)
+	}
+	if err == errNotSegmentable {
+		err = d.writeToFileFromURL(t, attempts)
+	}
+	atomic.AddInt64(&d.stats.activeDownloads, -1)
+	res.Path = t.fileloc
+	if err == nil {
+		err = d.verifyChecksums(t)
+	}
+	if err == nil && d.sidecar != "" {
+		err = d.writeSidecar(t.fileloc)
+	}
+	if err == nil && d.dedupDir != "" {
+		d.dedup(t.fileloc)
+	}
+	if err == nil && d.store != nil {
+		d.storeResult(t.fileloc)
+	}
+	// A resumed segmented download only transferred what was missing, so the
+	// size comes from the file
+	res.Written = t.offset
+	res.Size = t.offset
+	if err == nil {
+		if stat, serr := d.fs.Stat(t.fileloc); serr == nil {
+			res.Size = stat.Size()
+		}
 	}
+	res.Proto = t.proto
+	res.StatusCode = t.status
+	if t.header != nil {
+		res.Header = t.header
+		res.Cookies = (&http.Response{Header: t.header}).Cookies()
+		res.Filename = dispositionFilename(t.header)
+		res.TransferEncoding = t.header.Get("Content-Encoding")
+	}
+	if enc, ok := t.compression.encoding.Load().(string); ok {
+		res.TransferEncoding = enc
+		res.CompressedBytes = atomic.LoadInt64(&t.compression.compressed)
+		res.UncompressedBytes = atomic.LoadInt64(&t.compression.uncompressed)
+	}
+	if t.digest != nil {
+		res.Digest = hex.EncodeToString(t.digest.want)
+		res.DigestAlgorithm = t.digest.algorithm
+		res.DigestHeader = t.digest.header
+	}
+	res.Duration = d.clock.Now().Sub(start)
+
+	atomic.AddInt64(&d.stats.bytesDownloaded, res.Written)
+	if err != nil {
+		atomic.AddInt64(&d.stats.downloadsFailed, 1)
+	}
+	return res, err
+}
 
-	stat, err := f.Stat()
+// upToDate checks whether the file at fileloc is the same size as the
+// response to spec, or whatever the skip func checks, in which case it
+// doesn't need to be downloaded again, and returns its size
+func (d *Downloader) upToDate(ctx context.Context, fileloc string, spec *RequestSpec) (int64, bool, error) {
+	req, err := d.newRequest(spec)
 	if err != nil {
+		return 0, false, err
+	}
+	req = req.WithContext(ctx)
 
-		return 0, err
+	if !d.exists(fileloc) {
+		// File isn't there, don't bother trying to avoid clobber
+		return 0, false, nil
 	}
-	f.Close()
 
-	if stat.Size() == length {
-		log.Infof("Skipping %s (%s)\n", filepath.Base(fileloc), humanize.Bytes(uint64(length)))
-		return 0, nil
+	if req.Method != "GET" {
+		// Repeating the request to compare sizes isn't safe
+		return 0, false, nil
 	}
 
-	return writeToFileFromURL(fileloc, u, headers, cookies)
-}
+	if req.Header.Get("Range") != "" {
+		// The caller asked for part of the file, the sizes can't be compared
+		return 0, false, nil
+	}
 
-func writeToFileFromURL(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
-	req, err := http.NewRequest("GET", u.String(), nil)
+	head, err := d.do(req)
 	if err != nil {
 
-		return 0, err
+		return 0, false, err
 	}
+	head.Body.Close()
 
-	req.Header.Set("User-Agent", userAgent)
-	for _, c := range *cookies {
-		req.AddCookie(c)
+	if head.StatusCode < 200 || head.StatusCode > 299 {
+		// The length of an error page says nothing about the file
+		return 0, false, nil
 	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
+
+	length := d.contentLength(head.Header)
+	if spec.ExpectedSize > 0 && length >= 0 && length != spec.ExpectedSize {
+		return 0, false, fmt.Errorf("%w: %s is %d bytes, expected %d", ErrSizeMismatch, spec.URL.Redacted(), length, spec.ExpectedSize)
 	}
 
-	resp, err := client.Do(req)
+	stat, err := d.fs.Stat(fileloc)
 	if err != nil {
 
-		return 0, err
+		return 0, false, err
 	}
-	defer resp.Body.Close()
 
-	length, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 0)
-	if err != nil {
-		log.Warnf("No Content-Length Header for %s", u.String())
+	skip := d.sameSize
+	if d.skipFunc != nil {
+		skip = d.skipFunc
+	}
+	if skip(fileloc, stat, head) {
+		d.log.Infof("Skipping %s (%s)\n", filepath.Base(fileloc), humanize.Bytes(uint64(stat.Size())))
+		return stat.Size(), true, nil
 	}
 
-	var out *os.File
-
-	if FileExists(fileloc) {
-		out, err = os.OpenFile(fileloc, os.O_RDWR, os.FileMode(int(0775)))
-		if err != nil {
+	return 0, false, nil
+}
 
-			return 0, err
-		}
-		defer out.Close()
-	} else {
-		os.MkdirAll(filepath.Dir(fileloc), os.FileMode(0775))
-		out, err = os.Create(fileloc)
-		if err != nil {
+// SetSkipFunc sets how the dl package decides a file doesn't need to be
+// downloaded again, see WithSkipFunc
+func SetSkipFunc(skip func(fileloc string, localStat os.FileInfo, resp *http.Response) bool) {
+	WithSkipFunc(skip)(std)
+}
 
-			return 0, err
-		}
-		defer out.Close()
+// WithSkipFunc replaces how the Downloader decides that a file already on
+// disk doesn't need to be downloaded again, which by default is when it is
+// the same size as the Content-Length of the response. skip is called with
+// the file's location and info and the response to the request for it,
+// whose body has already been closed, and the download is skipped if it
+// returns true. It is only called for GET requests without a Range that
+// got a 2xx response. nil restores the default.
+func WithSkipFunc(skip func(fileloc string, localStat os.FileInfo, resp *http.Response) bool) Option {
+	return func(d *Downloader) {
+		d.skipFunc = skip
 	}
+}
 
-	log.Infof("Downloading %s (%s)\n", filepath.Base(fileloc), humanize.Bytes(uint64(length)))
-
-	return io.Copy(out, resp.Body)
+// sameSize is the default skip func, skipping files that are the size of
+// the response
+func (d *Downloader) sameSize(fileloc string, localStat os.FileInfo, resp *http.Response) bool {
+	length := d.contentLength(resp.Header)
+	// Without a usable content length the download is forced
+	return length >= 0 && localStat.Size() == length
 }
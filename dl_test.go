@@ -0,0 +1,100 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const rangeBody = "0123456789abcdefghij"
+
+func TestDownloadFileRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ignores" {
+			w.Write([]byte(rangeBody))
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(rangeBody))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	d := New(WithLogger(quietLogger()))
+
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{"/file", "56789"},
+		{"/ignores", rangeBody},
+	} {
+		u, _ := url.Parse(srv.URL + tt.path)
+		dest := filepath.Join(dir, filepath.Base(tt.path))
+		n, err := d.DownloadFile(dest, u, map[string]string{"Range": "bytes=5-9"}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		body, _ := ioutil.ReadFile(dest)
+		if string(body) != tt.want || n != int64(len(tt.want)) {
+			t.Errorf("%s: wrote %d bytes %q, want %q", tt.path, n, body, tt.want)
+		}
+	}
+}
+
+func TestGetReaderFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rangeBody))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	r, n, err := New().GetReaderFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(rangeBody)) {
+		t.Fatalf("length %d", n)
+	}
+
+	all, _ := ioutil.ReadAll(r)
+	if string(all) != rangeBody {
+		t.Fatalf("got %q", all)
+	}
+	if _, err := r.Seek(-5, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail, _ := ioutil.ReadAll(r)
+	if string(tail) != "fghij" {
+		t.Fatalf("after seeking got %q", tail)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ = ioutil.ReadAll(r); string(all) != rangeBody {
+		t.Fatalf("after rewinding got %q", all)
+	}
+}
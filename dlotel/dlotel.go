@@ -0,0 +1,78 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package dlotel traces downloads made with the dl package with
+// OpenTelemetry. It is kept out of the dl package so that only programs that
+// use it depend on OpenTelemetry.
+//
+//	d := dl.New(
+//		dl.WithSpanHooks(dlotel.SpanHooks(otel.Tracer("dl"))),
+//		dl.WithRequestHook(dlotel.InjectHeaders),
+//	)
+package dlotel
+
+import (
+	"context"
+	"github.com/HenrySlawniak/dl"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// SpanHooks returns hooks for dl.WithSpanHooks that start a client span named
+// "dl.download" with tracer for every download
+func SpanHooks(tracer trace.Tracer) dl.SpanHooks {
+	return func(ctx context.Context, info dl.SpanInfo) (context.Context, func(dl.DownloadResult, error)) {
+		ctx, span := tracer.Start(ctx, "dl.download",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("url.full", info.URL.Redacted()),
+				attribute.String("dl.path", info.Path),
+			),
+		)
+
+		return ctx, func(res dl.DownloadResult, err error) {
+			span.SetAttributes(
+				attribute.String("dl.outcome", res.Outcome.String()),
+				attribute.Int64("dl.bytes_written", res.Written),
+				attribute.Int64("dl.size", res.Size),
+			)
+			if res.Proto != "" {
+				span.SetAttributes(attribute.String("dl.proto", res.Proto))
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+}
+
+// InjectHeaders is a request hook for dl.WithRequestHook that adds the trace
+// context of the request, such as a traceparent header, with the global
+// propagator
+func InjectHeaders(req *http.Request) error {
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return nil
+}
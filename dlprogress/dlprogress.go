@@ -0,0 +1,210 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package dlprogress draws the progress of downloads made with the dl package
+// in a terminal.
+//
+//	r := dlprogress.New(os.Stderr)
+//	d := dl.New(dl.WithProgress(r.Update))
+package dlprogress
+
+import (
+	"fmt"
+	"github.com/HenrySlawniak/dl"
+	"github.com/dustin/go-humanize"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// barWidth is how many cells wide a progress bar is
+	barWidth = 30
+	// plainInterval is how often a download gets a line when not on a terminal
+	plainInterval = 5 * time.Second
+)
+
+var spinner = []string{"|", "/", "-", "\\"}
+
+// Renderer draws download progress, one bar per active download and a line
+// with the totals underneath. When its writer isn't a terminal it writes a
+// plain line for each download every few seconds instead.
+type Renderer struct {
+	mu     sync.Mutex
+	out    io.Writer
+	tty    bool
+	active map[string]*download
+	order  []string
+	// drawn is how many lines were drawn last time, to move back over
+	drawn int
+	spin  int
+}
+
+type download struct {
+	progress dl.Progress
+	// printed is when a plain line was last written
+	printed time.Time
+}
+
+// New returns a Renderer writing to w
+func New(w io.Writer) *Renderer {
+	return &Renderer{
+		out:    w,
+		tty:    isTerminal(w),
+		active: make(map[string]*download),
+	}
+}
+
+// isTerminal reports whether w is a character device
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Update takes a progress event, it is meant to be passed to dl.WithProgress
+func (r *Renderer) Update(p dl.Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.active[p.Path]
+	if p.Finished && !ok {
+		// The end of its last attempt has already been drawn, or it never
+		// got as far as a body
+		return
+	}
+	if !ok {
+		st = &download{}
+		r.active[p.Path] = st
+		r.order = append(r.order, p.Path)
+	}
+	st.progress = p
+
+	if !r.tty {
+		if p.Done || time.Since(st.printed) >= plainInterval {
+			st.printed = time.Now()
+			fmt.Fprintln(r.out, line(p, ""))
+		}
+	} else {
+		r.draw(p)
+	}
+
+	if p.Done {
+		delete(r.active, p.Path)
+		for i, path := range r.order {
+			if path == p.Path {
+				r.order = append(r.order[:i], r.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// draw redraws the bars, leaving a finished download's line above them
+func (r *Renderer) draw(last dl.Progress) {
+	var b strings.Builder
+	if r.drawn > 0 {
+		fmt.Fprintf(&b, "\033[%dA", r.drawn)
+	}
+	b.WriteString("\r\033[J")
+
+	r.spin = (r.spin + 1) % len(spinner)
+	if last.Done {
+		b.WriteString(line(last, bar(last, "")) + "\n")
+	}
+
+	var written, total int64
+	var speed float64
+	r.drawn = 0
+	for _, path := range r.order {
+		p := r.active[path].progress
+		if p.Done {
+			continue
+		}
+		written += p.Written
+		speed += p.CurrentSpeed
+		if total >= 0 && p.Total >= 0 {
+			total += p.Total
+		} else {
+			total = -1
+		}
+		b.WriteString(line(p, bar(p, spinner[r.spin])) + "\n")
+		r.drawn++
+	}
+
+	if r.drawn > 0 {
+		fmt.Fprintf(&b, "%d active, %s", r.drawn, humanize.Bytes(uint64(written)))
+		if total > 0 {
+			fmt.Fprintf(&b, " of %s", humanize.Bytes(uint64(total)))
+		}
+		fmt.Fprintf(&b, " at %s/s\n", humanize.Bytes(uint64(speed)))
+		r.drawn++
+	}
+
+	io.WriteString(r.out, b.String())
+}
+
+// bar draws a progress bar, or the spinner if the size isn't known
+func bar(p dl.Progress, spin string) string {
+	if p.Total <= 0 {
+		if p.Done {
+			return "[" + strings.Repeat("=", barWidth) + "]"
+		}
+		return "[" + spin + strings.Repeat(" ", barWidth-1) + "]"
+	}
+
+	filled := int(p.Written * barWidth / p.Total)
+	if filled > barWidth {
+		filled = barWidth
+	}
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled) + "]"
+}
+
+// line describes a download's progress after its bar
+func line(p dl.Progress, bar string) string {
+	var b strings.Builder
+	b.WriteString(filepath.Base(p.Path))
+	if bar != "" {
+		b.WriteString(" " + bar)
+	}
+
+	if p.Total > 0 {
+		fmt.Fprintf(&b, " %3d%% %s of %s", p.Written*100/p.Total, humanize.Bytes(uint64(p.Written)), humanize.Bytes(uint64(p.Total)))
+	} else {
+		fmt.Fprintf(&b, " %s", humanize.Bytes(uint64(p.Written)))
+	}
+
+	if p.Done {
+		fmt.Fprintf(&b, " at %s/s", humanize.Bytes(uint64(p.AverageSpeed)))
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, " %s/s", humanize.Bytes(uint64(p.CurrentSpeed)))
+	if p.ETA >= 0 {
+		fmt.Fprintf(&b, " eta %s", p.ETA.Truncate(time.Second))
+	}
+	return b.String()
+}
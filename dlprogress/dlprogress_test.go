@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dlprogress
+
+import (
+	"bytes"
+	"github.com/HenrySlawniak/dl"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBar(t *testing.T) {
+	for _, tc := range []struct {
+		p    dl.Progress
+		want string
+	}{
+		{dl.Progress{Written: 0, Total: 100}, "[" + strings.Repeat(" ", 30) + "]"},
+		{dl.Progress{Written: 50, Total: 100}, "[" + strings.Repeat("=", 15) + strings.Repeat(" ", 15) + "]"},
+		{dl.Progress{Written: 150, Total: 100}, "[" + strings.Repeat("=", 30) + "]"},
+		{dl.Progress{Written: 50, Total: -1}, "[/" + strings.Repeat(" ", 29) + "]"},
+		{dl.Progress{Written: 50, Total: -1, Done: true}, "[" + strings.Repeat("=", 30) + "]"},
+	} {
+		if got := bar(tc.p, "/"); got != tc.want {
+			t.Errorf("bar(%+v) = %q, want %q", tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestLine(t *testing.T) {
+	for _, tc := range []struct {
+		p    dl.Progress
+		bar  string
+		want string
+	}{
+		{dl.Progress{Path: "/tmp/file", Written: 250, Total: 500, CurrentSpeed: 100, ETA: 5500 * time.Millisecond}, "[]", "file []  50% 250 B of 500 B 100 B/s eta 5s"},
+		{dl.Progress{Path: "file", Written: 500, Total: -1, CurrentSpeed: 100, ETA: -1}, "", "file 500 B 100 B/s"},
+		{dl.Progress{Path: "file", Written: 500, Total: 500, AverageSpeed: 200, Done: true}, "", "file 100% 500 B of 500 B at 200 B/s"},
+	} {
+		if got := line(tc.p, tc.bar); got != tc.want {
+			t.Errorf("line(%+v) = %q, want %q", tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestRendererPlain(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(&buf)
+	if r.tty {
+		t.Fatal("a buffer is taken as a terminal")
+	}
+
+	r.Update(dl.Progress{Path: "a", Written: 10, Total: 100, ETA: -1})
+	// Too soon after the last line for another
+	r.Update(dl.Progress{Path: "a", Written: 20, Total: 100, ETA: -1})
+	r.Update(dl.Progress{Path: "a", Written: 100, Total: 100, Done: true})
+	// The final report of a download already drawn as done
+	r.Update(dl.Progress{Path: "a", Written: 100, Total: 100, Done: true, Finished: true})
+	// A download that failed before it had a body
+	r.Update(dl.Progress{Path: "b", Total: -1, Done: true, Finished: true})
+
+	want := "a  10% 10 B of 100 B 0 B/s\n" +
+		"a 100% 100 B of 100 B at 0 B/s\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	if len(r.active) != 0 || len(r.order) != 0 {
+		t.Errorf("downloads still active: %v", r.order)
+	}
+}
+
+func TestRendererTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(&buf)
+	r.tty = true
+
+	r.Update(dl.Progress{Path: "a", Written: 10, Total: 100, CurrentSpeed: 5, ETA: -1})
+	want := "\r\033[J" +
+		"a [===                           ]  10% 10 B of 100 B 5 B/s\n" +
+		"1 active, 10 B of 100 B at 5 B/s\n"
+	if got := buf.String(); got != want {
+		t.Errorf("first draw %q, want %q", got, want)
+	}
+
+	// A download of unknown size leaves the total out
+	buf.Reset()
+	r.Update(dl.Progress{Path: "b", Written: 20, Total: -1, CurrentSpeed: 5, ETA: -1})
+	want = "\033[2A\r\033[J" +
+		"a [===                           ]  10% 10 B of 100 B 5 B/s\n" +
+		"b [-                             ] 20 B 5 B/s\n" +
+		"2 active, 30 B at 10 B/s\n"
+	if got := buf.String(); got != want {
+		t.Errorf("second draw %q, want %q", got, want)
+	}
+
+	// A finished download's line stays above the bars, and it is left out
+	// of the totals
+	buf.Reset()
+	r.Update(dl.Progress{Path: "a", Written: 100, Total: 100, AverageSpeed: 50, Done: true})
+	want = "\033[3A\r\033[J" +
+		"a [==============================] 100% 100 B of 100 B at 50 B/s\n" +
+		"b [\\                             ] 20 B 5 B/s\n" +
+		"1 active, 20 B at 5 B/s\n"
+	if got := buf.String(); got != want {
+		t.Errorf("third draw %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	r.Update(dl.Progress{Path: "b", Written: 40, Total: -1, AverageSpeed: 8, Done: true})
+	want = "\033[2A\r\033[J" +
+		"b [==============================] 40 B at 8 B/s\n"
+	if got := buf.String(); got != want {
+		t.Errorf("last draw %q, want %q", got, want)
+	}
+	if r.drawn != 0 {
+		t.Errorf("drawn = %d after the last download", r.drawn)
+	}
+}
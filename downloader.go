@@ -0,0 +1,431 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Downloader makes requests and downloads files with its own client and
+// settings. The package level functions use a default Downloader that is
+// configured with the Set functions.
+type Downloader struct {
+	// mu guards the settings that can be changed while requests are in flight
+	mu sync.RWMutex
+
+	userAgent  string
+	userAgents []string
+	// uaNext counts requests to rotate through userAgents
+	uaNext        uint32
+	client        *http.Client
+	log           *logrus.Logger
+	breaker       *CircuitBreaker
+	cache         Cache
+	requestHooks  []func(*http.Request) error
+	responseHooks []func(*http.Response) error
+	validators    []func(*http.Response) error
+	accept        string
+	strictAccept  bool
+	workers       chan struct{}
+
+	defaultHeaders map[string]string
+	bufferSize     int
+	buffers        sync.Pool
+
+	autoReferer     bool
+	insecureReferer bool
+	refererPages    map[string]string
+
+	httpVersion HTTPVersion
+	http1       *http.Transport
+
+	sshConfig *ssh.ClientConfig
+
+	progress    func(Progress)
+	minSpeed    int64
+	speedWindow time.Duration
+	speedGrace  time.Duration
+
+	fs FS
+
+	metaRefresh bool
+
+	maxPlausibleSize int64
+
+	onRedirect func(from, to *url.URL, status int)
+
+	sidecar string
+
+	skipDigests bool
+
+	dedupDir string
+	store    *Store
+
+	backoff      backoff
+	retryBackoff Backoff
+	retryPolicy  RetryPolicy
+	onRetry      func(u *url.URL, attempt int, delay time.Duration, err error)
+	clock        clock
+
+	maxLineLength int
+
+	stats *stats
+
+	spanHooks SpanHooks
+
+	resolver         *net.Resolver
+	resolveOverrides map[string]string
+	unixSockets      map[string]string
+
+	digestAuth *digestAuth
+	netrc      *netrc
+
+	limiter Limiter
+
+	segments         int
+	adaptiveSegments bool
+
+	transcript *transcript
+
+	dialTimeout     time.Duration
+	downloadTimeout time.Duration
+
+	skipFunc func(fileloc string, localStat os.FileInfo, resp *http.Response) bool
+	pathFunc func(orig string, resp *http.Response) string
+
+	active activeDownloads
+
+	httpsOnly      bool
+	downgradeHosts map[string]bool
+
+	allowedHosts []string
+	deniedHosts  []string
+	blockPrivate bool
+	// guarded is the transport installDialer last set up
+	guarded *http.Transport
+}
+
+// maxRedirects is how many redirects are followed when the client doesn't
+// have its own CheckRedirect, the same as the http package's default
+const maxRedirects = 10
+
+// Option configures a Downloader
+type Option func(*Downloader)
+
+// New returns a Downloader configured with opts
+func New(opts ...Option) *Downloader {
+	d := &Downloader{
+		userAgent: "dl v0.0.1",
+		client:    &http.Client{Transport: newTransport()},
+		log:       logrus.New(),
+		workers:   make(chan struct{}, DefaultWorkers),
+		fs:        OSFS{},
+
+		maxPlausibleSize: DefaultMaxPlausibleSize,
+		backoff:          defaultBackoff,
+		clock:            realClock{},
+		stats:            &stats{},
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// WithUserAgent sets the user agent sent with every request
+func WithUserAgent(ua string) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.userAgent = ua
+		d.userAgents = nil
+	}
+}
+
+// WithClient sets the http client used to make requests. If private networks
+// are blocked, its transport is set up to check the addresses it connects to.
+func WithClient(c *http.Client) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		d.client = c
+		d.http1 = nil
+		block := d.blockPrivate
+		d.mu.Unlock()
+		if block {
+			d.installDialer()
+		}
+	}
+}
+
+// WithLogger sets the logger used by the Downloader
+func WithLogger(l *logrus.Logger) Option {
+	return func(d *Downloader) {
+		d.log = l
+	}
+}
+
+// WithCircuitBreaker sets the circuit breaker consulted before every request
+func WithCircuitBreaker(cb *CircuitBreaker) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		d.breaker = cb
+		d.mu.Unlock()
+	}
+}
+
+// WithCache sets the cache used by GetBodyFromURL. Responses to requests
+// with credentials, cookies, a Range or conditions of their own aren't
+// cached, and ones with a Vary header are cached for each value of the
+// request headers it names.
+func WithCache(c Cache) Option {
+	return func(d *Downloader) {
+		d.cache = c
+	}
+}
+
+// WithRequestHook adds a hook that is run on every request before it is sent,
+// including the ones made to follow a meta refresh. Hooks run in the order
+// they were added, and an error aborts the request.
+func WithRequestHook(hook func(*http.Request) error) Option {
+	return func(d *Downloader) {
+		d.requestHooks = append(d.requestHooks, hook)
+	}
+}
+
+// WithResponseHook adds a hook that is run on every response as soon as it is
+// received. Hooks run in the order they were added, and an error aborts the
+// request.
+func WithResponseHook(hook func(*http.Response) error) Option {
+	return func(d *Downloader) {
+		d.responseHooks = append(d.responseHooks, hook)
+	}
+}
+
+// WithResponseValidator adds a check that is run on the response of every
+// download attempt before anything is written to disk. An error aborts the
+// download.
+func WithResponseValidator(validate func(*http.Response) error) Option {
+	return func(d *Downloader) {
+		d.validators = append(d.validators, validate)
+	}
+}
+
+// do sends req, running the hooks around it. File, data, FTP and SFTP URLs
+// are answered without the http client.
+func (d *Downloader) do(req *http.Request) (*http.Response, error) {
+	if err := d.checkHTTPS(req.URL); err != nil {
+		return nil, err
+	}
+	if err := d.checkHost(req.URL); err != nil {
+		return nil, err
+	}
+
+	if err := d.runRequestHooks(req); err != nil {
+		return nil, err
+	}
+
+	var resp *http.Response
+	var err error
+	switch req.URL.Scheme {
+	case "file":
+		resp, err = fileRoundTrip(req)
+	case "data":
+		resp, err = dataRoundTrip(req)
+	case "ftp", "ftps":
+		resp, err = d.ftpRoundTrip(req)
+	case "sftp":
+		resp, err = d.sftpRoundTrip(req)
+	default:
+		resp, err = d.send(req)
+		if err == nil && d.metaRefresh {
+			resp, err = d.followMetaRefresh(req, resp)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range d.responseHooks {
+		if err := hook(resp); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("dl: response hook: %w", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// runRequestHooks runs the request hooks on req
+func (d *Downloader) runRequestHooks(req *http.Request) error {
+	for _, hook := range d.requestHooks {
+		if err := hook(req); err != nil {
+			return fmt.Errorf("dl: request hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// send sends req with the Downloader's client, honoring the circuit breaker
+func (d *Downloader) send(req *http.Request) (*http.Response, error) {
+	if err := d.checkGuard(req); err != nil {
+		return nil, err
+	}
+
+	host := req.URL.Host
+	d.mu.RLock()
+	breaker := d.breaker
+	d.mu.RUnlock()
+	if breaker != nil {
+		if err := breaker.allow(d.log, host); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := d.httpClient(req).Do(req)
+	if err != nil && d.fallBack(req, err) && (req.Body == nil || req.GetBody != nil) {
+		d.log.Warnf("Retrying %s over HTTP/1.1: %v\n", req.URL, err)
+		req = req.WithContext(withHTTP1(req.Context()))
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		resp, err = d.httpClient(req).Do(req)
+	}
+	if breaker != nil {
+		if fail := failed(req.Context(), resp, err); err != nil && !fail {
+			breaker.release(host)
+		} else {
+			breaker.record(d.log, host, fail)
+		}
+	}
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+
+	if err := d.checkHTTPVersion(resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// validate runs the response validators on resp, closing the body if any of them fail
+func (d *Downloader) validate(resp *http.Response) error {
+	if err := d.checkAccept(resp); err != nil {
+		resp.Body.Close()
+		return err
+	}
+
+	for _, validate := range d.validators {
+		if err := validate(resp); err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("dl: invalid response from %s: %w", resp.Request.URL, err)
+		}
+	}
+	return nil
+}
+
+// httpClient returns a copy of the Downloader's client for req that runs the
+// Downloader's checks on every redirect before the client's own
+func (d *Downloader) httpClient(req *http.Request) *http.Client {
+	c := *d.client
+	c.Jar = jarFor(c.Jar, req)
+	if req.Context().Value(http1Key{}) != nil {
+		d.http1Client(&c)
+	}
+
+	d.mu.RLock()
+	auth := d.digestAuth
+	transcript := d.transcript
+	gzip := countsGzip(c.Transport)
+	d.mu.RUnlock()
+	if c.Transport == nil && (auth != nil || transcript != nil || gzip) {
+		c.Transport = http.DefaultTransport
+	}
+	if gzip {
+		c.Transport = &gzipTransport{base: c.Transport}
+	}
+	if transcript != nil {
+		c.Transport = &transcriptTransport{base: c.Transport, transcript: transcript}
+	}
+	if auth != nil {
+		c.Transport = &digestTransport{base: c.Transport, auth: auth}
+	}
+
+	checkRedirect := c.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := d.checkRedirect(req, via); err != nil {
+			return err
+		}
+		if checkRedirect != nil {
+			if err := checkRedirect(req, via); err != nil {
+				return err
+			}
+		} else if len(via) >= maxRedirects {
+			return errors.New("stopped after 10 redirects")
+		}
+
+		if d.onRedirect != nil && req.Response != nil {
+			d.onRedirect(via[len(via)-1].URL, req.URL, req.Response.StatusCode)
+		}
+		return nil
+	}
+	return &c
+}
+
+// SetOnRedirect sets a function the dl package calls for every redirect it
+// follows, see WithOnRedirect
+func SetOnRedirect(fn func(from, to *url.URL, status int)) {
+	WithOnRedirect(fn)(std)
+}
+
+// WithOnRedirect sets a function that is called for every redirect that is
+// followed, with the status of the response that redirected. Followed meta
+// refreshes are reported too, with the status of the page they were on.
+func WithOnRedirect(fn func(from, to *url.URL, status int)) Option {
+	return func(d *Downloader) {
+		d.onRedirect = fn
+	}
+}
+
+// checkRedirect runs on every redirect the Downloader follows
+func (d *Downloader) checkRedirect(req *http.Request, via []*http.Request) error {
+	if err := d.redirectHTTPS(req, via); err != nil {
+		return err
+	}
+	if err := d.checkHost(req.URL); err != nil {
+		return err
+	}
+	if err := d.redirectNetrc(req, via); err != nil {
+		return err
+	}
+	return d.redirectReferer(req, via)
+}
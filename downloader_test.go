@@ -0,0 +1,230 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newRedirectServer serves a chain of redirects from /1 through /3 to /file
+func newRedirectServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/1", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/2", http.StatusFound) })
+	mux.HandleFunc("/2", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/3", http.StatusMovedPermanently) })
+	mux.HandleFunc("/3", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// quietLogger returns a logger that discards everything
+func quietLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	return l
+}
+
+func TestOnRedirect(t *testing.T) {
+	srv := newRedirectServer(t)
+	var hops []string
+	d := New(WithOnRedirect(func(from, to *url.URL, status int) {
+		hops = append(hops, fmt.Sprintf("%s -> %s %d", from, to, status))
+	}))
+
+	u, _ := url.Parse(srv.URL + "/1")
+	body, err := d.GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" {
+		t.Fatalf("got %q", body)
+	}
+
+	want := []string{
+		srv.URL + "/1 -> " + srv.URL + "/2 302",
+		srv.URL + "/2 -> " + srv.URL + "/3 301",
+		srv.URL + "/3 -> " + srv.URL + "/file 307",
+	}
+	if fmt.Sprint(hops) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", hops, want)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	var ran []string
+	record := func(name string) Option {
+		return WithRequestHook(func(*http.Request) error {
+			ran = append(ran, name)
+			return nil
+		})
+	}
+	recordResp := func(name string) Option {
+		return WithResponseHook(func(*http.Response) error {
+			ran = append(ran, name)
+			return nil
+		})
+	}
+	d := New(recordResp("resp1"), record("req1"), recordResp("resp2"), record("req2"))
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ran) != "[req1 req2 resp1 resp2]" {
+		t.Fatalf("hooks ran in order %q", ran)
+	}
+
+	// A failing request hook stops the request being sent, and the rest of
+	// the hooks being run
+	errHook := errors.New("hook failed")
+	ran = nil
+	d = New(WithLogger(quietLogger()), WithRequestHook(func(*http.Request) error { return errHook }), record("req2"), recordResp("resp"))
+	_, err := d.GetBodyFromURL(u, nil, nil)
+	if !errors.Is(err, errHook) || !strings.HasPrefix(err.Error(), "dl: request hook: ") {
+		t.Fatalf("got %v", err)
+	}
+	if len(ran) != 0 || atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("ran %q, server hit %d times", ran, hits)
+	}
+
+	d = New(WithLogger(quietLogger()), WithResponseHook(func(*http.Response) error { return errHook }), recordResp("resp"))
+	_, err = d.GetBodyFromURL(u, nil, nil)
+	if !errors.Is(err, errHook) || !strings.HasPrefix(err.Error(), "dl: response hook: ") {
+		t.Fatalf("got %v", err)
+	}
+	if len(ran) != 0 {
+		t.Fatalf("ran %q", ran)
+	}
+}
+
+func TestHooksProbesAndRetries(t *testing.T) {
+	var mu sync.Mutex
+	var requests, responses []string
+	hooks := []Option{
+		WithLogger(quietLogger()),
+		fastRetries,
+		WithRequestHook(func(req *http.Request) error {
+			mu.Lock()
+			defer mu.Unlock()
+			requests = append(requests, req.Header.Get("Range"))
+			return nil
+		}),
+		WithResponseHook(func(resp *http.Response) error {
+			mu.Lock()
+			defer mu.Unlock()
+			responses = append(responses, resp.Request.Header.Get("Range"))
+			return nil
+		}),
+	}
+
+	// Every attempt of a retried download goes through the hooks
+	body := bytes.Repeat([]byte("0123456789"), 1000)
+	u, ranges := newDropServer(t, body, 4000)
+	if _, err := New(hooks...).DownloadFileRetry(filepath.Join(t.TempDir(), "f"), u, nil, nil, 3); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(requests) != fmt.Sprint(ranges()) || fmt.Sprint(responses) != fmt.Sprint(ranges()) || len(requests) != 2 {
+		t.Fatalf("hooks saw requests %q and responses %q, server got %q", requests, responses, ranges())
+	}
+
+	// So do the probe and the segments of a segmented one
+	requests, responses = nil, nil
+	srv, su := newSegmentServer(t, testBody(2*MinSegmentSize), nil)
+	if _, err := New(append(hooks, WithSegments(2))...).Download(filepath.Join(t.TempDir(), "f"), &RequestSpec{URL: su}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(requests)
+	sort.Strings(responses)
+	sort.Strings(srv.ranges)
+	if fmt.Sprint(requests) != fmt.Sprint(srv.ranges) || fmt.Sprint(responses) != fmt.Sprint(srv.ranges) || len(requests) != 3 {
+		t.Fatalf("hooks saw requests %q and responses %q, server got %q", requests, responses, srv.ranges)
+	}
+}
+
+func TestResponseValidator(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 1000)
+	u, ranges := newDropServer(t, body, 4000)
+	dir := t.TempDir()
+
+	// A failing validator stops the download before anything is written,
+	// and isn't retried
+	errInvalid := errors.New("not a file")
+	var second int32
+	dest := filepath.Join(dir, "refused")
+	d := New(WithLogger(quietLogger()), fastRetries, WithResponseValidator(func(resp *http.Response) error {
+		if _, err := os.Stat(dest + partSuffix); !os.IsNotExist(err) {
+			t.Errorf("part file exists while validating: %v", err)
+		}
+		return errInvalid
+	}), WithResponseValidator(func(*http.Response) error {
+		atomic.AddInt32(&second, 1)
+		return nil
+	}))
+	_, err := d.DownloadFileRetry(dest, u, nil, nil, 3)
+	if !errors.Is(err, errInvalid) || !strings.HasPrefix(err.Error(), "dl: invalid response from ") {
+		t.Fatalf("got %v", err)
+	}
+	if got := ranges(); len(got) != 1 || atomic.LoadInt32(&second) != 0 {
+		t.Fatalf("server got %q, second validator ran %d times", got, second)
+	}
+	for _, name := range []string{dest, dest + partSuffix} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s exists: %v", name, err)
+		}
+	}
+
+	// Every attempt is validated, including the ones that resume
+	u, ranges = newDropServer(t, body, 4000)
+	var validated []string
+	d = New(WithLogger(quietLogger()), fastRetries, WithResponseValidator(func(resp *http.Response) error {
+		validated = append(validated, resp.Request.Header.Get("Range"))
+		return nil
+	}))
+	if _, err := d.DownloadFileRetry(filepath.Join(dir, "retried"), u, nil, nil, 3); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(validated) != fmt.Sprint(ranges()) || len(validated) != 2 || validated[1] != "bytes=4000-" {
+		t.Fatalf("validated %q, server got %q", validated, ranges())
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxErrorBody is how much of an error response's body is kept in an HTTPError
+const maxErrorBody = 4 * 1024
+
+// ErrRedirectWithoutLocation is returned, wrapped in an HTTPError, for a
+// redirect that couldn't be followed because it had no Location header
+var ErrRedirectWithoutLocation = errors.New("dl: redirect without a Location header")
+
+// HTTPError is returned when a server responds with a status other than 2xx
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	// Body is the start of the response body, at most 4KiB
+	Body []byte
+	URL  string
+	// Location is the Location header of a redirect that wasn't followed
+	Location string
+	// Err is what was wrong with the response beyond its status, if anything
+	Err error
+}
+
+func (e *HTTPError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("dl: %s returned %s: %v", e.URL, e.Status, e.Err)
+	case e.Location != "":
+		return fmt.Sprintf("dl: %s returned %s to %s, which wasn't followed", e.URL, e.Status, e.Location)
+	}
+	return fmt.Sprintf("dl: %s returned %s", e.URL, e.Status)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// checkStatus returns an HTTPError if resp doesn't have a 2xx status,
+// closing the body after keeping the start of it
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	he := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       body,
+		URL:        resp.Request.URL.Redacted(),
+	}
+
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		// The client follows redirects it can, so this one had a problem
+		if he.Location = resp.Header.Get("Location"); he.Location == "" {
+			he.Err = ErrRedirectWithoutLocation
+		}
+	}
+	return he
+}
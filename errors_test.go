@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"forbidden","reason":"token expired"}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/private")
+	u.User = url.UserPassword("user", "hunter2")
+
+	dest := filepath.Join(t.TempDir(), "private")
+	_, err := New().DownloadFile(dest, u, nil, nil)
+	var he *HTTPError
+	if !errors.As(err, &he) {
+		t.Fatalf("got %v, want an HTTPError", err)
+	}
+	if he.StatusCode != http.StatusForbidden || he.Status != "403 Forbidden" {
+		t.Errorf("status %d %q", he.StatusCode, he.Status)
+	}
+	if strings.Contains(he.URL, "hunter2") || !strings.HasSuffix(he.URL, "/private") {
+		t.Errorf("URL %q", he.URL)
+	}
+
+	var body struct {
+		Error, Reason string
+	}
+	if err := json.Unmarshal(he.Body, &body); err != nil {
+		t.Fatalf("body %q: %v", he.Body, err)
+	}
+	if body.Reason != "token expired" {
+		t.Errorf("reason %q", body.Reason)
+	}
+	if FileExists(dest) {
+		t.Error("error body written to the destination")
+	}
+}
+
+func TestHTTPErrorBodyLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(strings.Repeat("x", 3*maxErrorBody)))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	_, err := New().GetBodyFromURL(u, nil, nil)
+	var he *HTTPError
+	if !errors.As(err, &he) || len(he.Body) != maxErrorBody {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestRedirectWithoutLocation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMovedPermanently)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/moved")
+
+	dest := filepath.Join(t.TempDir(), "moved")
+	_, err := New().DownloadFile(dest, u, nil, nil)
+	var he *HTTPError
+	if !errors.As(err, &he) || he.StatusCode != http.StatusMovedPermanently {
+		t.Fatalf("got %v, want a 301 HTTPError", err)
+	}
+	if !errors.Is(err, ErrRedirectWithoutLocation) {
+		t.Errorf("got %v, want ErrRedirectWithoutLocation", err)
+	}
+	if FileExists(dest) {
+		t.Error("redirect body written to the destination")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filePath returns the local path of a file URL
+func filePath(u *url.URL) (string, error) {
+	p := u.Path
+	if p == "" {
+		p = u.Opaque
+	}
+
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		// file:///C:/dir/file
+		p = p[1:]
+	}
+
+	if u.Host != "" && u.Host != "localhost" {
+		if runtime.GOOS != "windows" {
+			return "", fmt.Errorf("dl: can't open file on remote host %s", u.Host)
+		}
+		// file://server/share/file
+		p = "//" + u.Host + p
+	}
+
+	return filepath.FromSlash(p), nil
+}
+
+// fileRoundTrip answers a request for a file URL from the local filesystem,
+// supporting the parts of HTTP the download machinery relies on
+func fileRoundTrip(req *http.Request) (*http.Response, error) {
+	p, err := filePath(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			return fileStatus(resp, http.StatusNotFound), nil
+		case os.IsPermission(err):
+			return fileStatus(resp, http.StatusForbidden), nil
+		}
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if stat.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("dl: %s is a directory", p)
+	}
+
+	size := stat.Size()
+	modified := stat.ModTime().UTC().Format(http.TimeFormat)
+	resp.Header.Set("Last-Modified", modified)
+	resp.Header.Set("Accept-Ranges", "bytes")
+
+	start, end := int64(0), size-1
+	if r := req.Header.Get("Range"); r != "" && ifRange(req.Header.Get("If-Range"), stat.ModTime()) {
+		if s, e, ok := parseRange(r, size); ok {
+			start, end = s, e
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+			fileStatus(resp, http.StatusPartialContent)
+		}
+	}
+	if resp.StatusCode == 0 {
+		fileStatus(resp, http.StatusOK)
+	}
+
+	resp.ContentLength = end - start + 1
+	resp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+
+	if req.Method == "HEAD" {
+		f.Close()
+		return resp, nil
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, start, resp.ContentLength), f}
+	return resp, nil
+}
+
+func fileStatus(resp *http.Response, code int) *http.Response {
+	resp.StatusCode = code
+	resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+	return resp
+}
+
+// ifRange reports whether an If-Range value still matches a file modified at modified
+func ifRange(v string, modified time.Time) bool {
+	if v == "" {
+		return true
+	}
+	t, err := http.ParseTime(v)
+	return err == nil && t.Equal(modified.UTC().Truncate(time.Second))
+}
+
+// parseRange parses a single byte range against a file of size bytes
+func parseRange(r string, size int64) (start, end int64, ok bool) {
+	if !strings.HasPrefix(r, "bytes=") || strings.Contains(r, ",") {
+		return 0, 0, false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r, "bytes="), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	var err error
+	if parts[0] == "" {
+		// bytes=-N is the last N bytes
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+
+	if start, err = strconv.ParseInt(parts[0], 10, 64); err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+
+	end = size - 1
+	if parts[1] != "" {
+		if end, err = strconv.ParseInt(parts[1], 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
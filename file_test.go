@@ -0,0 +1,166 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestFilePath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("paths are for unix")
+	}
+	for _, tc := range []struct {
+		url, want string
+	}{
+		{"file:///tmp/dir/f.txt", "/tmp/dir/f.txt"},
+		{"file://localhost/tmp/f.txt", "/tmp/f.txt"},
+		{"file:///tmp/a%20b%23c.txt", "/tmp/a b#c.txt"},
+		{"file:///C:/dir/f.txt", "C:/dir/f.txt"},
+		{"file:relative/f.txt", "relative/f.txt"},
+	} {
+		u, _ := url.Parse(tc.url)
+		if got, err := filePath(u); err != nil || got != tc.want {
+			t.Errorf("filePath(%s) = %q, %v, want %q", tc.url, got, err, tc.want)
+		}
+	}
+
+	u, _ := url.Parse("file://server/share/f.txt")
+	if _, err := filePath(u); err == nil {
+		t.Error("opened a file on another host")
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for _, tc := range []struct {
+		r          string
+		start, end int64
+		ok         bool
+	}{
+		{"bytes=0-9", 0, 9, true},
+		{"bytes=2-4", 2, 4, true},
+		{"bytes=5-", 5, 9, true},
+		{"bytes=5-100", 5, 9, true},
+		{"bytes=-3", 7, 9, true},
+		{"bytes=-30", 0, 9, true},
+		{"bytes=10-", 0, 0, false},
+		{"bytes=4-2", 0, 0, false},
+		{"bytes=-0", 0, 0, false},
+		{"bytes=0-1,3-4", 0, 0, false},
+		{"items=0-1", 0, 0, false},
+		{"bytes=a-b", 0, 0, false},
+	} {
+		start, end, ok := parseRange(tc.r, 10)
+		if start != tc.start || end != tc.end || ok != tc.ok {
+			t.Errorf("parseRange(%q) = %d, %d, %v, want %d, %d, %v", tc.r, start, end, ok, tc.start, tc.end, tc.ok)
+		}
+	}
+}
+
+func TestFileRoundTripRange(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "f")
+	ioutil.WriteFile(src, []byte("0123456789"), 0644)
+	modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(src, modified, modified)
+
+	for _, tc := range []struct {
+		name, rng, ifRange string
+		status             int
+		want               string
+	}{
+		{"whole", "", "", http.StatusOK, "0123456789"},
+		{"range", "bytes=2-4", "", http.StatusPartialContent, "234"},
+		{"suffix", "bytes=-3", "", http.StatusPartialContent, "789"},
+		{"unsatisfiable", "bytes=20-", "", http.StatusOK, "0123456789"},
+		{"if-range matches", "bytes=5-", modified.UTC().Format(http.TimeFormat), http.StatusPartialContent, "56789"},
+		{"if-range changed", "bytes=5-", modified.Add(-time.Hour).UTC().Format(http.TimeFormat), http.StatusOK, "0123456789"},
+	} {
+		req, _ := http.NewRequest("GET", "file://"+filepath.ToSlash(src), nil)
+		if tc.rng != "" {
+			req.Header.Set("Range", tc.rng)
+		}
+		if tc.ifRange != "" {
+			req.Header.Set("If-Range", tc.ifRange)
+		}
+		resp, err := fileRoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || string(body) != tc.want || resp.ContentLength != int64(len(tc.want)) {
+			t.Errorf("%s: got %d %q (%d bytes), want %d %q", tc.name, resp.StatusCode, body, resp.ContentLength, tc.status, tc.want)
+		}
+	}
+}
+
+func TestFileDownload(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a b.txt")
+	ioutil.WriteFile(src, []byte("hello file"), 0644)
+	u, _ := url.Parse("file://" + filepath.ToSlash(dir) + "/a%20b.txt")
+	d := New(WithLogger(quietLogger()))
+
+	dest := filepath.Join(dir, "out", "copy")
+	res, err := d.Download(dest, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); string(got) != "hello file" || res.Outcome != Downloaded || res.Written != 10 {
+		t.Fatalf("got %q, %+v", got, res)
+	}
+
+	// A copy of the same size is skipped
+	if res, err = d.Download(dest, &RequestSpec{URL: u}); err != nil || res.Outcome != SkippedSameSize {
+		t.Fatalf("got %v, %v", res.Outcome, err)
+	}
+
+	// A partial copy from an earlier run is resumed with a range
+	stat, _ := os.Stat(src)
+	ioutil.WriteFile(dest+partSuffix, []byte("hello"), 0644)
+	d.writeState(dest+partSuffix, &segmentState{URL: u.String(), Validator: stat.ModTime().UTC().Format(http.TimeFormat), Size: 10})
+	os.Remove(dest)
+	if res, err = d.ResumeDownloadProgress(dest, u, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); string(got) != "hello file" || res.Written != 10 || res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("resumed %q, %+v", got, res)
+	}
+
+	missing, _ := url.Parse("file://" + filepath.ToSlash(dir) + "/missing")
+	var he *HTTPError
+	if _, err := d.Download(filepath.Join(dir, "missing"), &RequestSpec{URL: missing}); !errors.As(err, &he) || he.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: got %v", err)
+	}
+	dirURL, _ := url.Parse("file://" + filepath.ToSlash(dir))
+	if _, err := d.Download(filepath.Join(dir, "dir"), &RequestSpec{URL: dirURL}); err == nil {
+		t.Error("downloaded a directory")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// DownloadToFileAt will write the url into f starting at offset, see Downloader.DownloadToFileAt
+func DownloadToFileAt(f *os.File, offset int64, u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	return std.DownloadToFileAt(f, offset, u, headers, cookies)
+}
+
+// DownloadToFileAt will download the url from offset onwards and write it
+// into f at the same offset with WriteAt, returning how many bytes were
+// written. A Range header in headers is sent instead of the one for offset,
+// so a part in the middle of the file can be fetched with
+// "bytes=offset-end". The server has to send back the part that starts at
+// offset. f is left open for the caller, and nothing is done to it when the
+// download fails part way through.
+func (d *Downloader) DownloadToFileAt(f *os.File, offset int64, u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	req, err := d.newRequest(newSpec(u, headers, cookies))
+	if err != nil {
+		return 0, err
+	}
+	if req.Header.Get("Range") == "" && offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return 0, err
+	}
+	if err := d.validate(resp); err != nil {
+		return 0, err
+	}
+
+	if err := checkRangeStart(resp, offset); err != nil {
+		return 0, fmt.Errorf("dl: %s: %w", u.Redacted(), err)
+	}
+
+	buf := d.getBuffer()
+	defer d.putBuffer(buf)
+	return copyBuffer(&offsetWriter{w: f, off: offset}, bodyReader{d.limitReader(req.Context(), resp.Body)}, *buf)
+}
+
+// checkRangeStart checks that resp is the part of a file starting at offset
+func checkRangeStart(resp *http.Response, offset int64) error {
+	if resp.StatusCode != http.StatusPartialContent {
+		if offset == 0 {
+			return nil
+		}
+		return fmt.Errorf("server ignored Range, sent %s", resp.Status)
+	}
+
+	var start, end int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/", &start, &end); err != nil {
+		return fmt.Errorf("bad Content-Range %q", resp.Header.Get("Content-Range"))
+	}
+	if start != offset {
+		return fmt.Errorf("asked for bytes from %d, got %d-%d", offset, start, end)
+	}
+	return nil
+}
+
+// offsetWriter writes to w at off, moving along as it is written to
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.off)
+	o.off += int64(n)
+	return n, err
+}
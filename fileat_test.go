@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadToFileAt(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ignores" {
+			w.Write([]byte(rangeBody))
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(rangeBody))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The second half first, then the first half by its own Range
+	d := New()
+	if n, err := d.DownloadToFileAt(f, 10, u, nil, nil); err != nil || n != 10 {
+		t.Fatalf("wrote %d bytes: %v", n, err)
+	}
+	if n, err := d.DownloadToFileAt(f, 0, u, map[string]string{"Range": "bytes=0-9"}, nil); err != nil || n != 10 {
+		t.Fatalf("wrote %d bytes: %v", n, err)
+	}
+	if got, _ := ioutil.ReadFile(f.Name()); string(got) != rangeBody {
+		t.Fatalf("assembled %q", got)
+	}
+
+	// A server that sends the whole file can't fill in the middle
+	u, _ = url.Parse(srv.URL + "/ignores")
+	if _, err := d.DownloadToFileAt(f, 5, u, nil, nil); err == nil {
+		t.Fatal("expected an error when the Range is ignored")
+	}
+}
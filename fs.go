@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io"
+	"os"
+)
+
+// File is a file opened through an FS
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// FS is the filesystem downloads are written to
+type FS interface {
+	Create(name string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+}
+
+// OSFS is the FS backed by the os package that downloads are written to by
+// default
+type OSFS struct{}
+
+// Create creates or truncates the named file
+func (OSFS) Create(name string) (File, error) {
+	return os.Create(name)
+}
+
+// OpenFile opens the named file with flag and perm
+func (OSFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// Stat returns the FileInfo of the named file
+func (OSFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// MkdirAll creates the directory path and any parents it needs
+func (OSFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Rename renames oldpath to newpath
+func (OSFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Remove removes the named file
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// SetFilesystem sets the filesystem the dl package writes downloads to
+func SetFilesystem(fs FS) {
+	std.fs = fs
+}
+
+// WithFilesystem sets the filesystem downloads are written to
+func WithFilesystem(fs FS) Option {
+	return func(d *Downloader) {
+		d.fs = fs
+	}
+}
+
+// exists checks if the named file exists on the Downloader's filesystem
+func (d *Downloader) exists(name string) bool {
+	_, err := d.fs.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memFS is an FS that keeps files in memory
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memData
+}
+
+// memData is the contents of a file in a memFS
+type memData struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: make(map[string]*memData)}
+}
+
+func (m *memFS) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[name]
+	switch {
+	case ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		f = &memData{}
+		m.files[name] = f
+	}
+	if flag&os.O_TRUNC != 0 {
+		f.mu.Lock()
+		f.data = nil
+		f.mu.Unlock()
+	}
+	return &memFile{name: name, d: f}, nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return f.info(name), nil
+}
+
+func (m *memFS) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	m.files[newpath] = f
+	delete(m.files, oldpath)
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// contents returns the contents of the named file, and whether it exists
+func (m *memFS) contents(name string) (string, bool) {
+	m.mu.Lock()
+	f, ok := m.files[name]
+	m.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return string(f.data), true
+}
+
+func (f *memData) info(name string) os.FileInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return memInfo{name: filepath.Base(name), size: int64(len(f.data))}
+}
+
+// memFile is a file opened from a memFS, which always writes to the end
+type memFile struct {
+	name string
+	d    *memData
+	pos  int
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+
+	if f.pos >= len(f.d.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.d.data[f.pos:])
+	f.pos += n
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	f.d.data = append(f.d.data, p...)
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.d.info(f.name), nil
+}
+
+type memInfo struct {
+	name string
+	size int64
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() os.FileMode  { return 0644 }
+func (i memInfo) ModTime() time.Time { return time.Time{} }
+func (i memInfo) IsDir() bool        { return false }
+func (i memInfo) Sys() interface{}   { return nil }
+
+func TestFilesystem(t *testing.T) {
+	body := "hello"
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		b := body
+		mu.Unlock()
+		w.Write([]byte(b))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	fs := newMemFS()
+	d := New(WithFilesystem(fs))
+	fileloc := filepath.Join(t.TempDir(), "sub", "f")
+	res, err := d.Download(fileloc, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fs.contents(fileloc); got != "hello" || res.Outcome != Downloaded {
+		t.Fatalf("got %q and %v, want hello downloaded", got, res.Outcome)
+	}
+	if _, ok := fs.contents(fileloc + partSuffix); ok {
+		t.Fatal("part file was left behind")
+	}
+	if _, err := os.Stat(fileloc); !os.IsNotExist(err) {
+		t.Fatal("file was written to disk")
+	}
+
+	// A file of the same size is skipped
+	res, err = d.Download(fileloc, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Outcome != SkippedSameSize || requests != 2 {
+		t.Fatalf("got %v after %d requests, want it skipped after 2", res.Outcome, requests)
+	}
+
+	// One that has changed size is downloaded again
+	mu.Lock()
+	body = "hello again"
+	mu.Unlock()
+	res, err = d.Download(fileloc, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fs.contents(fileloc); got != "hello again" || res.Outcome != Downloaded {
+		t.Fatalf("got %q and %v, want it downloaded again", got, res.Outcome)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ftpConn is a control connection to an FTP server
+type ftpConn struct {
+	conn net.Conn
+	text *textproto.Conn
+	host string
+	tls  *tls.Config
+	// dialer makes the data connections
+	dialer net.Dialer
+}
+
+// ftpRoundTrip answers a request for an ftp or ftps URL. GET retrieves the
+// file, with a "bytes=N-" Range becoming a REST, and the file's SIZE and MDTM
+// are returned as the Content-Length and Last-Modified headers.
+func (d *Downloader) ftpRoundTrip(req *http.Request) (*http.Response, error) {
+	if err := checkFTPURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	c, err := d.dialFTP(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.retrieve(req)
+	if err != nil || resp.Body == http.NoBody {
+		c.quit()
+	}
+	return resp, err
+}
+
+// checkFTPURL refuses a URL whose decoded path or credentials would break
+// out of the FTP command they are sent in, such as a path with "%0d%0a" in
+// it sending a command of its own
+func checkFTPURL(u *url.URL) error {
+	fields := []string{u.Path}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		fields = append(fields, u.User.Username(), pass)
+	}
+	for _, f := range fields {
+		if strings.ContainsAny(f, "\r\n\x00") {
+			return fmt.Errorf("dl: %s has a line break or NUL in it, which can't be sent over FTP", u.Redacted())
+		}
+	}
+	return nil
+}
+
+func (d *Downloader) dialFTP(req *http.Request) (*ftpConn, error) {
+	u := req.URL
+	implicitTLS := u.Scheme == "ftps"
+
+	addr := u.Host
+	if u.Port() == "" {
+		if implicitTLS {
+			addr = net.JoinHostPort(u.Hostname(), "990")
+		} else {
+			addr = net.JoinHostPort(u.Hostname(), "21")
+		}
+	}
+
+	dialer := net.Dialer{Control: d.dialControl}
+	conn, err := dialer.DialContext(req.Context(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ftpConn{conn: conn, host: u.Hostname(), dialer: dialer}
+	if implicitTLS {
+		c.tls = &tls.Config{}
+		if t := d.transport(); t != nil && t.TLSClientConfig != nil {
+			c.tls = t.TLSClientConfig.Clone()
+		}
+		if c.tls.ServerName == "" {
+			c.tls.ServerName = u.Hostname()
+		}
+		if c.tls.ClientSessionCache == nil {
+			// Servers commonly require the data connection to resume the
+			// control connection's session
+			c.tls.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+		}
+		c.conn = tls.Client(conn, c.tls)
+	}
+	if deadline, ok := req.Context().Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	}
+	c.text = textproto.NewConn(c.conn)
+
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+
+	code, msg, err := c.cmd("USER %s", user)
+	if err == nil && code == 331 {
+		code, msg, err = c.cmd("PASS %s", pass)
+	}
+	if err == nil && code != 230 && code != 202 {
+		err = &textproto.Error{Code: code, Msg: msg}
+	}
+	if err == nil && c.tls != nil {
+		if _, _, err = c.expect(200, "PBSZ 0"); err == nil {
+			_, _, err = c.expect(200, "PROT P")
+		}
+	}
+	if err == nil {
+		_, _, err = c.expect(200, "TYPE I")
+	}
+	if err != nil {
+		c.quit()
+		return nil, fmt.Errorf("dl: logging in to %s: %w", u.Host, err)
+	}
+
+	return c, nil
+}
+
+// cmd sends a command and reads its response
+func (c *ftpConn) cmd(format string, args ...interface{}) (int, string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+
+	return c.text.ReadResponse(0)
+}
+
+// expect sends a command and fails if the response code doesn't start with code
+func (c *ftpConn) expect(code int, format string, args ...interface{}) (int, string, error) {
+	got, msg, err := c.cmd(format, args...)
+	if err != nil {
+		return got, msg, err
+	}
+	if !ftpCodeMatches(got, code) {
+		return got, msg, &textproto.Error{Code: got, Msg: msg}
+	}
+	return got, msg, nil
+}
+
+// ftpCodeMatches works like textproto's expected codes, 2 matches 2xx, 20 matches 20x
+func ftpCodeMatches(code, expected int) bool {
+	switch {
+	case expected < 10:
+		return code/100 == expected
+	case expected < 100:
+		return code/10 == expected
+	}
+	return code == expected
+}
+
+func (c *ftpConn) quit() {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c.cmd("QUIT")
+	c.conn.Close()
+}
+
+func (c *ftpConn) retrieve(req *http.Request) (*http.Response, error) {
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	if path == "" || strings.HasSuffix(path, "/") {
+		return nil, fmt.Errorf("dl: %s is a directory", req.URL.Redacted())
+	}
+
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+
+	code, msg, err := c.cmd("SIZE %s", path)
+	if err != nil {
+		return nil, err
+	}
+	if code != 213 {
+		if cwd, _, err := c.cmd("CWD %s", path); err == nil && cwd == 250 {
+			return nil, fmt.Errorf("dl: %s is a directory", req.URL.Redacted())
+		}
+		if code/100 == 5 {
+			return fileStatus(resp, http.StatusNotFound), nil
+		}
+		return nil, &textproto.Error{Code: code, Msg: msg}
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("dl: bad SIZE response %q", msg)
+	}
+	resp.Header.Set("Accept-Ranges", "bytes")
+
+	var modified time.Time
+	if code, msg, err := c.cmd("MDTM %s", path); err == nil && code == 213 {
+		if t, err := time.Parse("20060102150405", strings.TrimSpace(msg)); err == nil {
+			modified = t
+			resp.Header.Set("Last-Modified", t.Format(http.TimeFormat))
+		}
+	}
+
+	start := int64(0)
+	if r := req.Header.Get("Range"); r != "" && ifRange(req.Header.Get("If-Range"), modified) {
+		if s, e, ok := parseRange(r, size); ok && e == size-1 {
+			start = s
+		}
+	}
+
+	if start > 0 {
+		if _, _, err := c.expect(350, "REST %d", start); err != nil {
+			start = 0
+		} else {
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, size-1, size))
+			fileStatus(resp, http.StatusPartialContent)
+		}
+	}
+	if resp.StatusCode == 0 {
+		fileStatus(resp, http.StatusOK)
+	}
+	resp.ContentLength = size - start
+	resp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+
+	if req.Method == "HEAD" {
+		return resp, nil
+	}
+
+	data, err := c.passive(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := c.expect(1, "RETR %s", path); err != nil {
+		data.Close()
+		return nil, err
+	}
+
+	resp.Body = &ftpBody{c: c, data: data, r: io.LimitReader(data, resp.ContentLength)}
+	return resp, nil
+}
+
+// passive opens a data connection with EPSV, falling back to PASV
+func (c *ftpConn) passive(req *http.Request) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+
+	var port int
+	code, msg, err := c.cmd("EPSV")
+	if err != nil {
+		return nil, err
+	}
+	if code == 229 {
+		// Entering Extended Passive Mode (|||port|)
+		if i := strings.Index(msg, "(|||"); i >= 0 {
+			fmt.Sscanf(msg[i+4:], "%d|)", &port)
+		}
+	}
+
+	if port == 0 {
+		_, msg, err := c.expect(227, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		// Entering Passive Mode (h1,h2,h3,h4,p1,p2), the address is ignored
+		// in favour of the control connection's
+		var h [4]int
+		var p1, p2 int
+		i := strings.IndexByte(msg, '(')
+		if i < 0 {
+			return nil, fmt.Errorf("dl: bad PASV response %q", msg)
+		}
+		if _, err := fmt.Sscanf(msg[i:], "(%d,%d,%d,%d,%d,%d)", &h[0], &h[1], &h[2], &h[3], &p1, &p2); err != nil {
+			return nil, fmt.Errorf("dl: bad PASV response %q", msg)
+		}
+		port = p1<<8 | p2
+	}
+
+	conn, err := c.dialer.DialContext(req.Context(), "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	if c.tls != nil {
+		conn = tls.Client(conn, c.tls)
+	}
+	return conn, nil
+}
+
+// ftpBody is the body of a RETR, closing it finishes the transfer and logs out
+type ftpBody struct {
+	c    *ftpConn
+	data net.Conn
+	r    io.Reader
+	done bool
+}
+
+func (b *ftpBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		b.done = true
+	}
+	return n, err
+}
+
+func (b *ftpBody) Close() error {
+	b.data.Close()
+
+	var err error
+	if b.done {
+		_, _, err = b.c.text.ReadResponse(2)
+	} else {
+		// The transfer was cut short, the server's reply doesn't matter
+		b.c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+		b.c.text.ReadResponse(0)
+	}
+	b.c.quit()
+
+	var te *textproto.Error
+	if errors.As(err, &te) {
+		return fmt.Errorf("dl: transfer failed: %w", err)
+	}
+	return nil
+}
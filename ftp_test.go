@@ -0,0 +1,255 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeFTP is an FTP server with one file, /pub/file.bin, that records the
+// commands it is sent
+type fakeFTP struct {
+	ln      net.Listener
+	content string
+	tls     *tls.Config
+
+	mu   sync.Mutex
+	cmds []string
+}
+
+// newFakeFTP starts a fakeFTP serving content, with implicit TLS if config
+// isn't nil
+func newFakeFTP(t *testing.T, content string, config *tls.Config) *fakeFTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeFTP{ln: ln, content: content, tls: config}
+	if config != nil {
+		s.ln = tls.NewListener(ln, config)
+	}
+	go func() {
+		for {
+			c, err := s.ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	t.Cleanup(func() { s.ln.Close() })
+	return s
+}
+
+func (s *fakeFTP) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.cmds...)
+}
+
+func (s *fakeFTP) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	fmt.Fprintf(c, "220 ready\r\n")
+
+	var data net.Listener
+	rest := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.cmds = append(s.cmds, line)
+		s.mu.Unlock()
+
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+		switch cmd {
+		case "USER":
+			fmt.Fprintf(c, "331 password please\r\n")
+		case "PASS":
+			fmt.Fprintf(c, "230 logged in\r\n")
+		case "TYPE", "PBSZ", "PROT":
+			fmt.Fprintf(c, "200 ok\r\n")
+		case "SIZE":
+			if arg == "pub/file.bin" {
+				fmt.Fprintf(c, "213 %d\r\n", len(s.content))
+			} else {
+				fmt.Fprintf(c, "550 no such file\r\n")
+			}
+		case "CWD":
+			if arg == "pub" {
+				fmt.Fprintf(c, "250 ok\r\n")
+			} else {
+				fmt.Fprintf(c, "550 no such directory\r\n")
+			}
+		case "MDTM":
+			fmt.Fprintf(c, "213 20200101120000\r\n")
+		case "REST":
+			fmt.Sscanf(arg, "%d", &rest)
+			fmt.Fprintf(c, "350 restarting\r\n")
+		case "EPSV":
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				fmt.Fprintf(c, "425 can't listen\r\n")
+				continue
+			}
+			if s.tls != nil {
+				data = tls.NewListener(data, s.tls)
+			}
+			fmt.Fprintf(c, "229 Entering Extended Passive Mode (|||%d|)\r\n", data.Addr().(*net.TCPAddr).Port)
+		case "RETR":
+			fmt.Fprintf(c, "150 sending\r\n")
+			dc, err := data.Accept()
+			data.Close()
+			if err != nil {
+				fmt.Fprintf(c, "425 no data connection\r\n")
+				continue
+			}
+			dc.Write([]byte(s.content[rest:]))
+			dc.Close()
+			fmt.Fprintf(c, "226 done\r\n")
+		case "QUIT":
+			fmt.Fprintf(c, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprintf(c, "502 not implemented\r\n")
+		}
+	}
+}
+
+func TestFTP(t *testing.T) {
+	s := newFakeFTP(t, "ftp content here", nil)
+	dir := t.TempDir()
+	d := New(WithLogger(quietLogger()))
+
+	u, _ := url.Parse("ftp://" + s.ln.Addr().String() + "/pub/file.bin")
+	dest := filepath.Join(dir, "file.bin")
+	if n, err := d.DownloadFile(dest, u, nil, nil); err != nil || n != 16 {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+	if got, _ := ioutil.ReadFile(dest); string(got) != "ftp content here" {
+		t.Errorf("got %q", got)
+	}
+	if cmds := s.commands(); cmds[0] != "USER anonymous" || cmds[1] != "PASS anonymous@" {
+		t.Errorf("logged in with %q", cmds[:2])
+	}
+
+	// The same size is skipped
+	if n, err := d.DownloadFile(dest, u, nil, nil); err != nil || n != 0 {
+		t.Errorf("second download: %d bytes, %v", n, err)
+	}
+
+	u, _ = url.Parse("ftp://" + s.ln.Addr().String() + "/pub/missing")
+	var he *HTTPError
+	if _, err := d.DownloadFile(filepath.Join(dir, "missing"), u, nil, nil); !errors.As(err, &he) || he.StatusCode != 404 {
+		t.Errorf("missing file: got %v, want a 404", err)
+	}
+
+	u, _ = url.Parse("ftp://" + s.ln.Addr().String() + "/pub")
+	if _, err := d.DownloadFile(filepath.Join(dir, "pub"), u, nil, nil); err == nil || !strings.Contains(err.Error(), "directory") {
+		t.Errorf("directory: got %v", err)
+	}
+}
+
+func TestFTPResume(t *testing.T) {
+	s := newFakeFTP(t, "0123456789abcdef", nil)
+	u, _ := url.Parse("ftp://" + s.ln.Addr().String() + "/pub/file.bin")
+	headers := map[string]string{"Range": "bytes=10-"}
+	body, err := New(WithLogger(quietLogger())).GetBodyFromURL(u, headers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "abcdef" {
+		t.Errorf("got %q", body)
+	}
+	found := false
+	for _, c := range s.commands() {
+		found = found || c == "REST 10"
+	}
+	if !found {
+		t.Errorf("no REST in %q", s.commands())
+	}
+}
+
+func TestFTPS(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	config := srv.TLS.Clone()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	srv.Close()
+
+	s := newFakeFTP(t, "secret content", config)
+	d := New(WithLogger(quietLogger()))
+	d.transport().TLSClientConfig.RootCAs = pool
+
+	u, _ := url.Parse("ftps://user:hunter2@" + s.ln.Addr().String() + "/pub/file.bin")
+	body, err := d.GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "secret content" {
+		t.Errorf("got %q", body)
+	}
+	cmds := strings.Join(s.commands(), "\n")
+	if !strings.Contains(cmds, "USER user\nPASS hunter2\nPBSZ 0\nPROT P") {
+		t.Errorf("commands:\n%s", cmds)
+	}
+}
+
+func TestFTPInjection(t *testing.T) {
+	s := newFakeFTP(t, "content", nil)
+	d := New(WithLogger(quietLogger()))
+
+	for _, raw := range []string{
+		"ftp://" + s.ln.Addr().String() + "/pub/a%0d%0aDELE%20x",
+		"ftp://" + s.ln.Addr().String() + "/pub/a%0aDELE%20x",
+		"ftp://" + s.ln.Addr().String() + "/pub/a%00",
+		"ftp://user%0d%0aDELE%20x:pass@" + s.ln.Addr().String() + "/pub/file.bin",
+		"ftp://user:pass%0d%0aDELE%20x@" + s.ln.Addr().String() + "/pub/file.bin",
+	} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.GetBodyFromURL(u, nil, nil); err == nil {
+			t.Errorf("%s: downloaded", raw)
+		}
+	}
+	if cmds := s.commands(); len(cmds) != 0 {
+		t.Errorf("server was sent %q", cmds)
+	}
+}
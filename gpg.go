@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/openpgp"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// ErrSignatureInvalid is returned when a file doesn't match its signature
+var ErrSignatureInvalid = errors.New("dl: signature invalid")
+
+// DownloadFileVerifyGPG will download the url to fileloc and verify its detached signature, see Downloader.DownloadFileVerifyGPG
+func DownloadFileVerifyGPG(fileloc string, u, sigURL *url.URL, keyring openpgp.KeyRing, headers map[string]string, cookies *[]*http.Cookie) error {
+	return std.DownloadFileVerifyGPG(fileloc, u, sigURL, keyring, headers, cookies)
+}
+
+// DownloadFileVerifyGPG will download the detached signature at sigURL, then
+// download the url to fileloc and verify it with the signature against
+// keyring before it is renamed into place, so a file that fails
+// verification never reaches fileloc and isn't given a sidecar,
+// deduplicated or stored. sigURL defaults to the url with .sig appended,
+// and the signature can be binary or armored. A file already at fileloc
+// that would be skipped as up to date is verified instead, and downloaded
+// again if it fails. The error wraps ErrSignatureInvalid when the download
+// doesn't match the signature.
+func (d *Downloader) DownloadFileVerifyGPG(fileloc string, u, sigURL *url.URL, keyring openpgp.KeyRing, headers map[string]string, cookies *[]*http.Cookie) error {
+	if sigURL == nil {
+		sig := *u
+		sig.Path += ".sig"
+		sig.RawPath = ""
+		sigURL = &sig
+	}
+
+	sig, err := d.GetBodyFromURL(sigURL, headers, cookies)
+	if err != nil {
+		return fmt.Errorf("dl: downloading signature: %w", err)
+	}
+
+	t := newTransfer(fileloc, newSpec(u, headers, cookies))
+	t.verify = func(path string) error {
+		return d.verifyGPG(path, fileloc, sig, keyring)
+	}
+	if _, err := d.fetchTransfer(t, 1); err != nil {
+		return err
+	}
+
+	d.log.Infof("Verified signature of %s\n", fileloc)
+	return nil
+}
+
+// verifyGPG checks the file at path, which is being downloaded to fileloc,
+// against the detached signature sig
+func (d *Downloader) verifyGPG(path, fileloc string, sig []byte, keyring openpgp.KeyRing) error {
+	f, err := d.fs.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	check := openpgp.CheckDetachedSignature
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN PGP")) {
+		check = openpgp.CheckArmoredDetachedSignature
+	}
+	if _, err := check(keyring, f, bytes.NewReader(sig)); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrSignatureInvalid, fileloc, err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/crypto/openpgp"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadFileVerifyGPG(t *testing.T) {
+	signer, err := openpgp.NewEntity("dl", "test", "dl@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("other", "test", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("release contents\n")
+	var binarySig, armoredSig, otherSig bytes.Buffer
+	if err := openpgp.DetachSign(&binarySig, signer, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := openpgp.ArmoredDetachSign(&armoredSig, signer, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := openpgp.DetachSign(&otherSig, other, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/release.tar.sig":
+			w.Write(binarySig.Bytes())
+		case r.URL.Path == "/release.tar.asc":
+			w.Write(armoredSig.Bytes())
+		case r.URL.Path == "/release.tar.other":
+			w.Write(otherSig.Bytes())
+		case strings.HasPrefix(r.URL.Path, "/release.tar"):
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/release.tar")
+	keyring := openpgp.EntityList{signer}
+	dir := t.TempDir()
+
+	for _, tt := range []struct {
+		sig   string
+		valid bool
+	}{
+		{"", true},
+		{"/release.tar.asc", true},
+		{"/release.tar.other", false},
+	} {
+		var sigURL *url.URL
+		if tt.sig != "" {
+			sigURL, _ = url.Parse(srv.URL + tt.sig)
+		}
+		dest := filepath.Join(dir, "release"+filepath.Ext(tt.sig))
+		err := New(WithLogger(quietLogger()), WithDigestSidecar("sha256")).DownloadFileVerifyGPG(dest, u, sigURL, keyring, nil, nil)
+		if !tt.valid {
+			if !errors.Is(err, ErrSignatureInvalid) {
+				t.Errorf("%q: got %v, want ErrSignatureInvalid", tt.sig, err)
+			}
+			if FileExists(dest) || FileExists(dest+partSuffix) || FileExists(dest+".sha256") {
+				t.Errorf("%q: file that failed verification was kept", tt.sig)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", tt.sig, err)
+		}
+		if body, _ := ioutil.ReadFile(dest); !bytes.Equal(body, data) {
+			t.Errorf("%q: got %q", tt.sig, body)
+		}
+		if !FileExists(dest + ".sha256") {
+			t.Errorf("%q: no sidecar for a verified file", tt.sig)
+		}
+	}
+
+	// Nothing is downloaded without a signature
+	dest := filepath.Join(dir, "nosig")
+	nosig, _ := url.Parse(srv.URL + "/missing.sig")
+	if err := New(WithLogger(quietLogger())).DownloadFileVerifyGPG(dest, u, nosig, keyring, nil, nil); err == nil {
+		t.Error("downloaded without a signature")
+	}
+	if FileExists(dest) || FileExists(dest+partSuffix) {
+		t.Error("file kept without a signature")
+	}
+
+	// A file on disk that would be skipped is verified, and kept if the
+	// download doesn't verify either
+	dest = filepath.Join(dir, "existing")
+	existing := []byte("local contents!!\n")
+	ioutil.WriteFile(dest, existing, 0644)
+	otherURL, _ := url.Parse(srv.URL + "/release.tar.other")
+	if err := New(WithLogger(quietLogger())).DownloadFileVerifyGPG(dest, u, otherURL, keyring, nil, nil); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("got %v, want ErrSignatureInvalid", err)
+	}
+	if body, _ := ioutil.ReadFile(dest); !bytes.Equal(body, existing) {
+		t.Errorf("existing file changed to %q", body)
+	}
+
+	// and replaced if the download does
+	if err := New(WithLogger(quietLogger())).DownloadFileVerifyGPG(dest, u, nil, keyring, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadFile(dest); !bytes.Equal(body, data) {
+		t.Errorf("got %q after a verified download", body)
+	}
+}
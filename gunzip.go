@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"compress/gzip"
+	"github.com/dustin/go-humanize"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// DownloadAndGunzip will download the gzip file at url and write it decompressed to destPath
+func DownloadAndGunzip(u *url.URL, destPath string, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	return std.DownloadAndGunzip(u, destPath, headers, cookies)
+}
+
+// DownloadAndGunzip will download the gzip file at url and write it
+// decompressed to destPath, returning the decompressed size
+func (d *Downloader) DownloadAndGunzip(u *url.URL, destPath string, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	req, err := d.newRequest(newSpec(u, headers, cookies))
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkStatus(resp); err != nil {
+		return 0, err
+	}
+	if err := d.validate(resp); err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+
+	d.fs.MkdirAll(filepath.Dir(destPath), os.FileMode(0775))
+	out, err := d.fs.Create(destPath)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	buf := d.getBuffer()
+	defer d.putBuffer(buf)
+
+	n, err := copyBuffer(out, gz, *buf)
+	if err != nil {
+		out.Close()
+		d.fs.Remove(destPath)
+		return n, err
+	}
+
+	d.log.Infof("Decompressed %s (%s)\n", filepath.Base(destPath), humanize.Bytes(uint64(n)))
+	return n, nil
+}
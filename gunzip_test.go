@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gzipped returns s compressed with gzip
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDownloadAndGunzip(t *testing.T) {
+	plain := strings.Repeat("hello world\n", 1000)
+	fixture := gzipped(plain)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(fixture)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/hello.txt.gz")
+
+	dest := filepath.Join(t.TempDir(), "sub", "hello.txt")
+	n, err := New().DownloadAndGunzip(u, dest, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(plain)) {
+		t.Fatalf("decompressed %d bytes, want %d", n, len(plain))
+	}
+	if body, _ := ioutil.ReadFile(dest); string(body) != plain {
+		t.Fatal("decompressed output doesn't match")
+	}
+}
+
+func TestDownloadAndGunzipCorrupt(t *testing.T) {
+	fixture := gzipped(strings.Repeat("hello world\n", 1000))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fixture[:len(fixture)/2])
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/hello.txt.gz")
+
+	dest := filepath.Join(t.TempDir(), "hello.txt")
+	if _, err := New().DownloadAndGunzip(u, dest, nil, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if FileExists(dest) {
+		t.Fatal("partial output left behind")
+	}
+}
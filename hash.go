@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	hashesMu sync.RWMutex
+	hashes   = map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha224": sha256.New224,
+		"sha256": sha256.New,
+		"sha384": sha512.New384,
+		"sha512": sha512.New,
+	}
+)
+
+// RegisterHash makes a hash algorithm available by name to checksum
+// verification and sidecar files, replacing any algorithm already registered
+// under that name. Names are case insensitive. md5, sha1, sha224, sha256,
+// sha384 and sha512 are registered to begin with.
+func RegisterHash(name string, newFunc func() hash.Hash) {
+	hashesMu.Lock()
+	defer hashesMu.Unlock()
+
+	hashes[strings.ToLower(name)] = newFunc
+}
+
+// newHash returns a new hash of the algorithm registered as name
+func newHash(name string) (hash.Hash, error) {
+	hashesMu.RLock()
+	defer hashesMu.RUnlock()
+
+	newFunc, ok := hashes[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(hashes))
+		for n := range hashes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("dl: unknown hash %q, registered hashes are %s", name, strings.Join(names, ", "))
+	}
+	return newFunc(), nil
+}
+
+// fileHash returns the hex encoded hash of the file at fileloc with the
+// algorithm registered as algo
+func (d *Downloader) fileHash(fileloc, algo string) (string, error) {
+	return hashFile(d.fs, fileloc, algo)
+}
+
+// hashFile returns the hex encoded hash of the file at fileloc on fs with the
+// algorithm registered as algo
+func hashFile(fs FS, fileloc, algo string) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := fs.OpenFile(fileloc, os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChecksum checks the file at fileloc has the hex encoded checksum want
+// with the algorithm registered as algo, removing it if it doesn't
+func (d *Downloader) verifyChecksum(fileloc, algo, want string) error {
+	got, err := d.fileHash(fileloc, algo)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(got, want) {
+		d.fs.Remove(fileloc)
+		return &ChecksumMismatchError{Path: fileloc, Algorithm: strings.ToLower(algo), Expected: want, Actual: got}
+	}
+	return nil
+}
+
+// verifyChecksums checks the file t is at against its checksums, removing it
+// if any of them don't match
+func (d *Downloader) verifyChecksums(t *transfer) error {
+	for _, sum := range t.checksums {
+		if err := d.verifyChecksum(t.fileloc, sum[0], sum[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
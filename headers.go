@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"net/http"
+)
+
+// SetDefaultHeader sets a header sent with every request made by the dl package
+func SetDefaultHeader(k, v string) {
+	std.SetDefaultHeader(k, v)
+}
+
+// WithDefaultHeaders sets headers sent with every request. Headers passed to
+// a call override these, and passing an empty value removes the default for
+// that call.
+//
+// A Host header, here or passed to a call, is sent in place of the URL's
+// host while still connecting to the URL's host, so an address like
+// https://10.0.0.5/artifact can be asked for as downloads.example.com. It is
+// kept across relative redirects, but a redirect to an absolute URL uses
+// that URL's host. The name TLS certificates are checked against is set
+// separately with WithTLSServerName.
+func WithDefaultHeaders(headers map[string]string) Option {
+	return func(d *Downloader) {
+		for k, v := range headers {
+			d.SetDefaultHeader(k, v)
+		}
+	}
+}
+
+// SetHostHeader sets the Host header sent with every request made by the dl
+// package, see WithHostHeader
+func SetHostHeader(host string) {
+	WithHostHeader(host)(std)
+}
+
+// WithHostHeader sends host as the Host header of every request in place of
+// the host of the URL, which is still the address that is connected to. This
+// is for requesting a virtual host from a server that isn't in DNS under that
+// name, and pairs with WithTLSServerName for HTTPS. Redirects to an absolute
+// URL use its host. An empty host goes back to using the URL.
+func WithHostHeader(host string) Option {
+	return func(d *Downloader) {
+		d.SetDefaultHeader("Host", host)
+	}
+}
+
+// SetAcceptLanguage sets the Accept-Language header the dl package sends with
+// every request, see WithAcceptLanguage
+func SetAcceptLanguage(lang string) {
+	WithAcceptLanguage(lang)(std)
+}
+
+// WithAcceptLanguage sends lang, like "en-US,en;q=0.9", as the Accept-Language
+// header of every request. It is a default header, so headers passed to a
+// call override it, and an empty lang removes it.
+func WithAcceptLanguage(lang string) Option {
+	return func(d *Downloader) {
+		d.SetDefaultHeader("Accept-Language", lang)
+	}
+}
+
+// SetDefaultHeader sets a header sent with every request, an empty value removes it
+func (d *Downloader) SetDefaultHeader(k, v string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k = http.CanonicalHeaderKey(k)
+	if v == "" {
+		delete(d.defaultHeaders, k)
+		return
+	}
+	if d.defaultHeaders == nil {
+		d.defaultHeaders = make(map[string]string)
+	}
+	d.defaultHeaders[k] = v
+}
+
+// setHeaders sets the default headers and then the call's headers on req
+func (d *Downloader) setHeaders(req *http.Request, headers map[string]string) {
+	merged := make(map[string]string)
+
+	d.mu.RLock()
+	for k, v := range d.defaultHeaders {
+		// setReferer has already sent the default Referer if the request
+		// has none of its own and it's safe to send
+		if k != "Referer" {
+			merged[k] = v
+		}
+	}
+	d.mu.RUnlock()
+
+	for k, v := range headers {
+		merged[http.CanonicalHeaderKey(k)] = v
+	}
+
+	for k, v := range merged {
+		switch {
+		case v == "":
+			req.Header.Del(k)
+		case k == "Host":
+			// The Host header is ignored by the client, it has to go on the request
+			req.Host = v
+		default:
+			req.Header.Set(k, v)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newEchoHostServer answers every request with the Host header it was sent
+func newEchoHostServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHostHeader(t *testing.T) {
+	srv := newEchoHostServer(t)
+	u, _ := url.Parse(srv.URL + "/file")
+
+	d := New(WithHostHeader("downloads.example.com"))
+	body, err := d.GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "downloads.example.com" {
+		t.Fatalf("server saw Host %q", body)
+	}
+
+	// A call can override it, or go back to the URL's host
+	if body, _ = d.GetBodyFromURL(u, map[string]string{"Host": "mirror.example.com"}, nil); string(body) != "mirror.example.com" {
+		t.Fatalf("server saw Host %q", body)
+	}
+	if body, _ = d.GetBodyFromURL(u, map[string]string{"Host": ""}, nil); string(body) != u.Host {
+		t.Fatalf("server saw Host %q, want %q", body, u.Host)
+	}
+}
+
+func TestHostHeaderRedirect(t *testing.T) {
+	other := newEchoHostServer(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/relative":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/absolute":
+			http.Redirect(w, r, other.URL+"/final", http.StatusFound)
+		default:
+			w.Write([]byte(r.Host))
+		}
+	}))
+	defer srv.Close()
+	d := New(WithHostHeader("downloads.example.com"))
+
+	// The Host header is kept when the redirect stays on the same server
+	u, _ := url.Parse(srv.URL + "/relative")
+	if body, err := d.GetBodyFromURL(u, nil, nil); err != nil || string(body) != "downloads.example.com" {
+		t.Fatalf("server saw Host %q: %v", body, err)
+	}
+
+	// but a redirect to an absolute URL is for that URL's host
+	u, _ = url.Parse(srv.URL + "/absolute")
+	otherURL, _ := url.Parse(other.URL)
+	if body, err := d.GetBodyFromURL(u, nil, nil); err != nil || string(body) != otherURL.Host {
+		t.Fatalf("server saw Host %q, want %q: %v", body, otherURL.Host, err)
+	}
+}
+
+func TestHostHeaderTLS(t *testing.T) {
+	srv, c, sni := newSNIServer(t)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	})
+	// httptest's certificate is valid for the address and for example.com
+	u, _ := url.Parse(srv.URL + "/artifact")
+	// Each Downloader gets its own connections, so each case has a handshake
+	client := func() *http.Client {
+		return &http.Client{Transport: c.Transport.(*http.Transport).Clone()}
+	}
+
+	// The Host header alone doesn't change the name the certificate is
+	// checked against, which is still the address
+	body, err := New(WithClient(client()), WithHostHeader("example.com")).GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "example.com" || sni() != "" {
+		t.Fatalf("server saw Host %q and server name %q", body, sni())
+	}
+
+	// With the server name too it is checked against the name
+	d := New(WithClient(client()), WithHostHeader("example.com"), WithTLSServerName("example.com"))
+	if body, err = d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "example.com" || sni() != "example.com" {
+		t.Fatalf("server saw Host %q and server name %q", body, sni())
+	}
+
+	// and verification still fails for a name the certificate isn't for
+	d = New(WithClient(client()), WithHostHeader("downloads.example.net"), WithTLSServerName("downloads.example.net"))
+	_, err = d.GetBodyFromURL(u, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("got %v, want a certificate error", err)
+	}
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join([]string{r.Header.Get("X-A"), r.Header.Get("X-B"), r.UserAgent(), r.Host}, "|")))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	d := New(WithDefaultHeaders(map[string]string{
+		"X-A":        "a",
+		"x-b":        "b",
+		"User-Agent": "agent",
+		"Host":       "h.example.com",
+	}))
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"defaults", nil, "a|b|agent|h.example.com"},
+		{"override", map[string]string{"X-A": "call", "user-agent": "other"}, "call|b|other|h.example.com"},
+		{"override in another case", map[string]string{"x-a": "lower"}, "lower|b|agent|h.example.com"},
+		{"remove", map[string]string{"X-B": "", "HOST": ""}, "a||agent|" + u.Host},
+		{"override host", map[string]string{"Host": "call.example.com"}, "a|b|agent|call.example.com"},
+	} {
+		body, err := d.GetBodyFromURL(u, tc.headers, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != tc.want {
+			t.Errorf("%s: server saw %q, want %q", tc.name, body, tc.want)
+		}
+	}
+
+	// Setting a default to an empty value removes it for good
+	d.SetDefaultHeader("x-a", "")
+	d.SetDefaultHeader("Host", "")
+	if body, _ := d.GetBodyFromURL(u, nil, nil); string(body) != "|b|agent|"+u.Host {
+		t.Errorf("server saw %q", body)
+	}
+}
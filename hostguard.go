@@ -0,0 +1,223 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// ErrHostNotAllowed is returned for a request to a host that isn't in the
+// Downloader's allowed hosts, is in its denied hosts, or is on a private
+// network it blocks
+var ErrHostNotAllowed = errors.New("dl: host not allowed")
+
+// SetAllowedHosts limits the hosts the dl package makes requests to, see WithAllowedHosts
+func SetAllowedHosts(patterns ...string) {
+	WithAllowedHosts(patterns...)(std)
+}
+
+// WithAllowedHosts only allows requests to hosts that match one of the
+// patterns, see hostMatches. Every redirect and meta refresh is checked
+// too, and file URLs are refused as they would reach the local filesystem.
+// No patterns allows every host.
+func WithAllowedHosts(patterns ...string) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		d.allowedHosts = lowerAll(patterns)
+		d.mu.Unlock()
+	}
+}
+
+// SetDeniedHosts stops the dl package making requests to some hosts, see WithDeniedHosts
+func SetDeniedHosts(patterns ...string) {
+	WithDeniedHosts(patterns...)(std)
+}
+
+// WithDeniedHosts refuses requests to hosts that match one of the patterns,
+// see hostMatches, even if they are allowed by WithAllowedHosts. Every
+// redirect and meta refresh is checked too. No patterns denies none.
+func WithDeniedHosts(patterns ...string) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		d.deniedHosts = lowerAll(patterns)
+		d.mu.Unlock()
+	}
+}
+
+func lowerAll(patterns []string) []string {
+	var lower []string
+	for _, pattern := range patterns {
+		lower = append(lower, strings.ToLower(pattern))
+	}
+	return lower
+}
+
+// hostMatches reports whether host matches one of the patterns. A pattern is
+// matched a label at a time, each with path.Match, so it has to have as many
+// labels as host: "*.example.com" matches "www.example.com" but not
+// "example.com" or "a.b.example.com", and "img*.example.com" matches
+// "img1.example.com".
+func hostMatches(patterns []string, host string) bool {
+	labels := strings.Split(host, ".")
+	for _, pattern := range patterns {
+		parts := strings.Split(pattern, ".")
+		if len(parts) != len(labels) {
+			continue
+		}
+		matched := true
+		for i, part := range parts {
+			if ok, _ := path.Match(part, labels[i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// SetBlockPrivateNetworks stops the dl package connecting to private
+// addresses, see WithBlockPrivateNetworks
+func SetBlockPrivateNetworks() {
+	WithBlockPrivateNetworks()(std)
+}
+
+// WithBlockPrivateNetworks refuses to connect to loopback, private (RFC 1918
+// and RFC 4193), shared (RFC 6598), link-local and unspecified addresses, for
+// downloading URLs from users without letting them reach internal services.
+// The address is checked once a host has been looked up, right before
+// connecting, so a name that resolves to a private address is refused however
+// it got there. File URLs are refused too. It doesn't apply to
+// WithUnixSocket.
+//
+// The check is made by the dialer of the Downloader's *http.Transport, which
+// stops using any proxy, and the client set with WithClient gets it too. A
+// request is refused with ErrHostNotAllowed if the client's transport isn't
+// one the check can be made on, or has been given a proxy since.
+func WithBlockPrivateNetworks() Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		d.blockPrivate = true
+		d.mu.Unlock()
+		d.installDialer()
+	}
+}
+
+// checkHost refuses u if its host isn't allowed. File URLs are refused when
+// hosts are limited or private networks blocked, as they read local files.
+// Data URLs are always allowed, as they hold their content and connect to
+// nothing.
+func (d *Downloader) checkHost(u *url.URL) error {
+	if u.Scheme == "data" {
+		return nil
+	}
+
+	d.mu.RLock()
+	allowedHosts := d.allowedHosts
+	deniedHosts := d.deniedHosts
+	block := d.blockPrivate
+	d.mu.RUnlock()
+
+	if u.Scheme == "file" {
+		if len(allowedHosts) > 0 || block {
+			return fmt.Errorf("%w: %s is a local file", ErrHostNotAllowed, u.Redacted())
+		}
+		return nil
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if hostMatches(deniedHosts, host) || (len(allowedHosts) > 0 && !hostMatches(allowedHosts, host)) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Redacted())
+	}
+
+	if ip := net.ParseIP(host); block && ip != nil && privateIP(ip) {
+		return fmt.Errorf("%w: %s is a private address", ErrHostNotAllowed, u.Redacted())
+	}
+	return nil
+}
+
+// dialControl is the Control of the Downloader's dialers, which refuses
+// private addresses if they are blocked
+func (d *Downloader) dialControl(network, address string, c syscall.RawConn) error {
+	d.mu.RLock()
+	block := d.blockPrivate
+	d.mu.RUnlock()
+	if !block {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+		return fmt.Errorf("%w: %s is a private address", ErrHostNotAllowed, host)
+	}
+	return nil
+}
+
+// checkGuard refuses to send a request with a client whose connections
+// can't be checked for private addresses, when they are blocked
+func (d *Downloader) checkGuard(req *http.Request) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if !d.blockPrivate {
+		return nil
+	}
+
+	t, ok := d.client.Transport.(*http.Transport)
+	switch {
+	case !ok || t != d.guarded:
+		return fmt.Errorf("%w: can't check the address %s connects to with a %T", ErrHostNotAllowed, req.URL.Redacted(), d.client.Transport)
+	case t.Proxy != nil || (d.http1 != nil && d.http1.Proxy != nil):
+		return fmt.Errorf("%w: can't check the address %s connects to through a proxy", ErrHostNotAllowed, req.URL.Redacted())
+	}
+	return nil
+}
+
+// sharedNets are the ranges privateIP counts that the net package doesn't
+var sharedNets = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+}
+
+// privateIP reports whether ip is an address on a private network
+func privateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range sharedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
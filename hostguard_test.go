@@ -0,0 +1,216 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newHostGuardServer(t *testing.T) (*httptest.Server, *url.URL) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if to := r.URL.Query().Get("to"); to != "" {
+			http.Redirect(w, r, to, http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return srv, u
+}
+
+func TestAllowedHosts(t *testing.T) {
+	srv, u := newHostGuardServer(t)
+
+	d := New(WithAllowedHosts("*.example.com"))
+	if _, err := d.GetBodyFromURL(u, nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("got %v, want ErrHostNotAllowed", err)
+	}
+
+	d = New(WithAllowedHosts("127.0.0.*"))
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every redirect is checked too
+	_, port, _ := net.SplitHostPort(u.Host)
+	r, _ := url.Parse(srv.URL + "?to=" + url.QueryEscape("http://localhost:"+port+"/"))
+	if _, err := d.GetBodyFromURL(r, nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("got %v for a redirect to localhost, want ErrHostNotAllowed", err)
+	}
+}
+
+func TestBlockPrivateNetworks(t *testing.T) {
+	_, u := newHostGuardServer(t)
+	_, port, _ := net.SplitHostPort(u.Host)
+
+	d := New(WithBlockPrivateNetworks())
+	if _, err := d.GetBodyFromURL(u, nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("got %v, want ErrHostNotAllowed", err)
+	}
+
+	// A name that resolves to a private address is refused when dialing
+	d = New(WithBlockPrivateNetworks(), WithResolve(map[string]string{"public.example:" + port: "127.0.0.1:" + port}))
+	pu, _ := url.Parse("http://public.example:" + port + "/")
+	if _, err := d.GetBodyFromURL(pu, nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("got %v, want ErrHostNotAllowed", err)
+	}
+}
+
+func TestBlockPrivateNetworksClient(t *testing.T) {
+	_, u := newHostGuardServer(t)
+	pu, _ := url.Parse("http://public.example/")
+
+	// The proxy a transport inherits is dropped, as only it would be checked
+	d := New(WithBlockPrivateNetworks())
+	if d.transport().Proxy != nil {
+		t.Fatal("proxy wasn't cleared")
+	}
+
+	// A client set afterwards is guarded too
+	d = New(WithBlockPrivateNetworks(), WithClient(&http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}))
+	if d.transport().Proxy != nil {
+		t.Fatal("proxy of the new client wasn't cleared")
+	}
+	if _, err := d.GetBodyFromURL(u, nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("got %v, want ErrHostNotAllowed", err)
+	}
+
+	// A proxy added since can't be checked
+	d.transport().Proxy = http.ProxyURL(u)
+	if _, err := d.GetBodyFromURL(pu, nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("got %v through a proxy, want ErrHostNotAllowed", err)
+	}
+
+	// Neither can a transport that isn't an *http.Transport
+	sent := false
+	d = New(WithBlockPrivateNetworks(), WithClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = true
+		return nil, errors.New("sent")
+	})}))
+	if _, err := d.GetBodyFromURL(pu, nil, nil); !errors.Is(err, ErrHostNotAllowed) || sent {
+		t.Fatalf("got %v, sent %v, want ErrHostNotAllowed", err, sent)
+	}
+}
+
+func TestPrivateIP(t *testing.T) {
+	for _, tt := range []struct {
+		ip      string
+		private bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"0.1.2.3", true},
+		{"::1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"::ffff:10.0.0.1", true},
+		{"100.128.0.1", false},
+		{"8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+	} {
+		if got := privateIP(net.ParseIP(tt.ip)); got != tt.private {
+			t.Errorf("privateIP(%s) = %v, want %v", tt.ip, got, tt.private)
+		}
+	}
+}
+
+func TestDeniedHosts(t *testing.T) {
+	srv, u := newHostGuardServer(t)
+
+	d := New(WithDeniedHosts("127.0.0.*"))
+	if _, err := d.GetBodyFromURL(u, nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("got %v, want ErrHostNotAllowed", err)
+	}
+
+	// Denied hosts win over allowed ones
+	d = New(WithAllowedHosts("127.0.0.1", "localhost"), WithDeniedHosts("localhost"))
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(u.Host)
+	r, _ := url.Parse(srv.URL + "?to=" + url.QueryEscape("http://localhost:"+port+"/"))
+	if _, err := d.GetBodyFromURL(r, nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("got %v for a redirect to a denied host, want ErrHostNotAllowed", err)
+	}
+}
+
+func TestHostMatches(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, host string
+		match         bool
+	}{
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "a.b.example.com", false},
+		{"*.*.example.com", "a.b.example.com", true},
+		{"img*.example.com", "img1.example.com", true},
+		{"img*.example.com", "cdn.example.com", false},
+		{"example.com", "example.com", true},
+		{"example.com", "example.com.evil.net", false},
+		{"127.0.0.*", "127.0.0.1", true},
+	} {
+		if got := hostMatches([]string{tt.pattern}, tt.host); got != tt.match {
+			t.Errorf("%q matching %q: got %v", tt.pattern, tt.host, got)
+		}
+	}
+}
+
+func TestHostGuardLocalURLs(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "secret")
+	ioutil.WriteFile(f, []byte("secret"), 0644)
+	fu := &url.URL{Scheme: "file", Path: filepath.ToSlash(f)}
+	du, _ := url.Parse("data:,hello")
+
+	for _, opt := range []Option{WithAllowedHosts("*.example.com"), WithBlockPrivateNetworks()} {
+		d := New(opt)
+		if _, err := d.GetBodyFromURL(fu, nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+			t.Errorf("file URL: got %v, want ErrHostNotAllowed", err)
+		}
+		if body, err := d.GetBodyFromURL(du, nil, nil); err != nil || string(body) != "hello" {
+			t.Errorf("data URL: got %q, %v", body, err)
+		}
+	}
+
+	// Only denying hosts leaves file URLs alone
+	if body, err := New(WithDeniedHosts("*.example.com")).GetBodyFromURL(fu, nil, nil); err != nil || string(body) != "secret" {
+		t.Errorf("file URL with denied hosts: got %q, %v", body, err)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// HTTPVersion selects which HTTP versions a Downloader uses
+type HTTPVersion int
+
+const (
+	// HTTPAuto negotiates the version the way the http package does
+	HTTPAuto HTTPVersion = iota
+	// HTTP1Only never uses HTTP/2
+	HTTP1Only
+	// HTTP2Only requires every response to be served over HTTP/2
+	HTTP2Only
+	// HTTP2Fallback prefers HTTP/2, but repeats a request over HTTP/1.1 when
+	// it fails with an HTTP/2 stream or connection error
+	HTTP2Fallback
+)
+
+// ErrHTTP2Unavailable is returned when HTTP/2 is required but the server
+// answered with another version
+var ErrHTTP2Unavailable = errors.New("dl: server did not use HTTP/2")
+
+type http1Key struct{}
+
+// WithHTTPVersion sets which HTTP versions the Downloader uses
+func WithHTTPVersion(v HTTPVersion) Option {
+	return func(d *Downloader) {
+		d.httpVersion = v
+
+		t := d.transport()
+		if t == nil {
+			return
+		}
+
+		switch v {
+		case HTTPAuto:
+			// As http.DefaultTransport is, before its first request
+			t.ForceAttemptHTTP2 = true
+			t.TLSNextProto = nil
+			if t.TLSClientConfig != nil {
+				t.TLSClientConfig = t.TLSClientConfig.Clone()
+				t.TLSClientConfig.NextProtos = nil
+			}
+		case HTTP1Only:
+			disableHTTP2(t)
+		case HTTP2Only, HTTP2Fallback:
+			// Undo disableHTTP2, an empty TLSNextProto would keep HTTP/2 off
+			t.ForceAttemptHTTP2 = true
+			t.TLSNextProto = nil
+			if t.TLSClientConfig == nil {
+				t.TLSClientConfig = &tls.Config{}
+			} else {
+				t.TLSClientConfig = t.TLSClientConfig.Clone()
+			}
+			t.TLSClientConfig.NextProtos = nil
+			if v == HTTP2Only {
+				t.TLSClientConfig.NextProtos = []string{"h2"}
+			}
+		}
+	}
+}
+
+// SetForceHTTP2 makes the dl package only use HTTP/2, see WithForceHTTP2
+func SetForceHTTP2(force bool) {
+	WithForceHTTP2(force)(std)
+}
+
+// WithForceHTTP2 makes the Downloader only use HTTP/2, like HTTP2Only, or
+// goes back to HTTPAuto if it did. Changing the HTTP version of a client
+// that has already made requests only affects new connections, and
+// re-enabling HTTP/2 on one that has used HTTP/1.1 may not work.
+func WithForceHTTP2(force bool) Option {
+	return func(d *Downloader) {
+		if force {
+			WithHTTPVersion(HTTP2Only)(d)
+		} else if d.httpVersion == HTTP2Only {
+			WithHTTPVersion(HTTPAuto)(d)
+		}
+	}
+}
+
+// SetForceHTTP1 makes the dl package only use HTTP/1.1, see WithForceHTTP1
+func SetForceHTTP1(force bool) {
+	WithForceHTTP1(force)(std)
+}
+
+// WithForceHTTP1 makes the Downloader only use HTTP/1.1, like HTTP1Only, or
+// goes back to HTTPAuto if it did, with the same caveats as WithForceHTTP2
+func WithForceHTTP1(force bool) Option {
+	return func(d *Downloader) {
+		if force {
+			WithHTTPVersion(HTTP1Only)(d)
+		} else if d.httpVersion == HTTP1Only {
+			WithHTTPVersion(HTTPAuto)(d)
+		}
+	}
+}
+
+func disableHTTP2(t *http.Transport) {
+	t.ForceAttemptHTTP2 = false
+	t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	if t.TLSClientConfig != nil {
+		t.TLSClientConfig = t.TLSClientConfig.Clone()
+		t.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+}
+
+// withHTTP1 marks a request to be sent over HTTP/1.1
+func withHTTP1(ctx context.Context) context.Context {
+	return context.WithValue(ctx, http1Key{}, true)
+}
+
+// http1Client returns a copy of client that only speaks HTTP/1.1
+func (d *Downloader) http1Client(c *http.Client) *http.Client {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.http1 == nil {
+		t := d.transport()
+		if t == nil {
+			return c
+		}
+		d.http1 = t.Clone()
+		disableHTTP2(d.http1)
+	}
+
+	c.Transport = d.http1
+	return c
+}
+
+// checkHTTPVersion enforces HTTP2Only on a response
+func (d *Downloader) checkHTTPVersion(resp *http.Response) error {
+	d.log.Debugf("%s served over %s\n", resp.Request.URL, resp.Proto)
+
+	if d.httpVersion == HTTP2Only && resp.ProtoMajor != 2 {
+		resp.Body.Close()
+		return fmt.Errorf("%w: %s answered with %s", ErrHTTP2Unavailable, resp.Request.URL.Host, resp.Proto)
+	}
+	return nil
+}
+
+// fallBack reports whether a request that failed with err should be repeated over HTTP/1.1
+func (d *Downloader) fallBack(req *http.Request, err error) bool {
+	if d.httpVersion != HTTP2Fallback || req.Context().Value(http1Key{}) != nil {
+		return false
+	}
+	return isHTTP2Error(err)
+}
+
+// isHTTP2Error reports whether err came from the HTTP/2 layer. The http
+// package doesn't export its HTTP/2 error types, so this looks for an error
+// of one of them in the chain of err. They are named http2 something in the
+// http package, or live in its internal http2 package in newer versions of Go.
+func isHTTP2Error(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		t := reflect.TypeOf(err)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch pkg := t.PkgPath(); {
+		case pkg == "net/http/internal/http2":
+			return true
+		case pkg == "net/http" && strings.HasPrefix(t.Name(), "http2"):
+			return true
+		}
+	}
+	return false
+}
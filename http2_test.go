@@ -0,0 +1,117 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newHTTP2Server(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *url.URL) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return srv, u
+}
+
+// discardLogger is an error log for test servers that are meant to fail
+func discardLogger() *log.Logger {
+	return log.New(ioutil.Discard, "", 0)
+}
+
+func TestForceHTTPVersion(t *testing.T) {
+	srv, u := newHTTP2Server(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"auto", nil, "HTTP/2.0"},
+		{"http2", []Option{WithForceHTTP2(true)}, "HTTP/2.0"},
+		{"http1", []Option{WithForceHTTP1(true)}, "HTTP/1.1"},
+		{"http1 then http2", []Option{WithForceHTTP1(true), WithForceHTTP2(true)}, "HTTP/2.0"},
+		{"http2 then http1", []Option{WithForceHTTP2(true), WithForceHTTP1(true)}, "HTTP/1.1"},
+		{"http1 undone", []Option{WithForceHTTP1(true), WithForceHTTP1(false)}, "HTTP/2.0"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// A transport that has made requests keeps its HTTP/2 setup
+			c := &http.Client{Transport: srv.Client().Transport.(*http.Transport).Clone()}
+			d := New(append([]Option{WithClient(c)}, tt.opts...)...)
+			body, err := d.GetBodyFromURL(u, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.want {
+				t.Fatalf("served over %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestForceHTTPVersionSharedConfig(t *testing.T) {
+	srv, _ := newHTTP2Server(t, func(w http.ResponseWriter, r *http.Request) {})
+	c := srv.Client()
+	config := c.Transport.(*http.Transport).TLSClientConfig
+
+	New(WithClient(c), WithForceHTTP1(true))
+	New(WithClient(c), WithForceHTTP2(true))
+	if config.NextProtos != nil {
+		t.Fatalf("NextProtos of the original config changed to %q", config.NextProtos)
+	}
+}
+
+func TestHTTP2Fallback(t *testing.T) {
+	srv, u := newHTTP2Server(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			panic(http.ErrAbortHandler)
+		}
+		w.Write([]byte(r.Proto))
+	})
+	srv.Config.ErrorLog = discardLogger()
+
+	_, err := New(WithClient(srv.Client())).GetBodyFromURL(u, nil, nil)
+	if !isHTTP2Error(err) {
+		t.Fatalf("got %v, want an HTTP/2 error", err)
+	}
+	if isHTTP2Error(fmt.Errorf("dl: stream error: %w", errors.New("http2: made up"))) {
+		t.Fatal("error matched by its message")
+	}
+
+	body, err := New(WithClient(srv.Client()), WithHTTPVersion(HTTP2Fallback)).GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "HTTP/1.1" {
+		t.Fatalf("served over %s, want HTTP/1.1", body)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrInsecureURL is returned for a plaintext URL by a Downloader that
+	// only uses HTTPS
+	ErrInsecureURL = errors.New("dl: refusing insecure URL")
+	// ErrInsecureRedirect is returned for a redirect to a plaintext URL by a
+	// Downloader that only uses HTTPS
+	ErrInsecureRedirect = errors.New("dl: refusing redirect to insecure URL")
+)
+
+// SetHTTPSOnly stops the dl package from using plaintext URLs, see WithHTTPSOnly
+func SetHTTPSOnly(downgradeHosts ...string) {
+	WithHTTPSOnly(downgradeHosts...)(std)
+}
+
+// WithHTTPSOnly refuses http and ftp URLs with ErrInsecureURL, and redirects
+// and meta refreshes to them with ErrInsecureRedirect, so nothing is ever
+// sent or received in plaintext. downgradeHosts are host names that are
+// still allowed over plaintext, for mirrors that can't do better.
+func WithHTTPSOnly(downgradeHosts ...string) Option {
+	return func(d *Downloader) {
+		d.httpsOnly = true
+		d.downgradeHosts = make(map[string]bool, len(downgradeHosts))
+		for _, host := range downgradeHosts {
+			d.downgradeHosts[strings.ToLower(host)] = true
+		}
+	}
+}
+
+// insecure reports whether u is a plaintext URL the Downloader mustn't use
+func (d *Downloader) insecure(u *url.URL) bool {
+	if !d.httpsOnly || d.downgradeHosts[strings.ToLower(u.Hostname())] {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "ftp"
+}
+
+// checkHTTPS refuses u if it is insecure
+func (d *Downloader) checkHTTPS(u *url.URL) error {
+	if d.insecure(u) {
+		return fmt.Errorf("%w: %s", ErrInsecureURL, u.Redacted())
+	}
+	return nil
+}
+
+// redirectHTTPS refuses a redirect to an insecure URL
+func (d *Downloader) redirectHTTPS(req *http.Request, via []*http.Request) error {
+	if d.insecure(req.URL) {
+		return fmt.Errorf("%w: %s redirected to %s", ErrInsecureRedirect, via[len(via)-1].URL.Redacted(), req.URL.Redacted())
+	}
+	return nil
+}
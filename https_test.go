@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPSOnly(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plaintext"))
+	}))
+	defer plain.Close()
+	var hits int32
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, plain.URL+"/file", http.StatusFound)
+		case "/refresh":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<meta http-equiv="refresh" content="0; url=` + plain.URL + `/file">`))
+		default:
+			w.Write([]byte("secure"))
+		}
+	}))
+	defer secure.Close()
+	dir := t.TempDir()
+	parse := func(s string) *url.URL {
+		u, _ := url.Parse(s)
+		return u
+	}
+
+	d := New(WithLogger(quietLogger()), WithClient(secure.Client()), WithHTTPSOnly(), WithFollowMetaRefresh(true), fastRetries)
+	if _, err := d.Download(filepath.Join(dir, "secure"), &RequestSpec{URL: parse(secure.URL + "/file")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, insecure := range []string{plain.URL + "/file", "ftp://127.0.0.1/file"} {
+		if _, err := d.Download(filepath.Join(dir, "plain"), &RequestSpec{URL: parse(insecure)}); !errors.Is(err, ErrInsecureURL) {
+			t.Errorf("%s: got %v, want ErrInsecureURL", insecure, err)
+		}
+	}
+
+	// Redirects and meta refreshes to plaintext are refused, and not retried
+	for _, path := range []string{"/redirect", "/refresh"} {
+		atomic.StoreInt32(&hits, 0)
+		_, err := d.DownloadFileRetry(filepath.Join(dir, "downgraded"), parse(secure.URL+path), nil, nil, 3)
+		if !errors.Is(err, ErrInsecureRedirect) || !strings.Contains(err.Error(), plain.URL+"/file") {
+			t.Errorf("%s: got %v, want ErrInsecureRedirect", path, err)
+		}
+		if n := atomic.LoadInt32(&hits); n != 1 {
+			t.Errorf("%s: sent %d requests", path, n)
+		}
+	}
+
+	// Hosts allowed to be downgraded can still use plaintext
+	d = New(WithLogger(quietLogger()), WithClient(secure.Client()), WithHTTPSOnly("example.com", "127.0.0.1"))
+	body, err := d.GetBodyFromURL(parse(secure.URL+"/redirect"), nil, nil)
+	if err != nil || string(body) != "plaintext" {
+		t.Fatalf("got %q, %v", body, err)
+	}
+	if !d.insecure(parse("http://example.org/")) || d.insecure(parse("http://EXAMPLE.com:8080/")) || d.insecure(parse("https://example.org/")) {
+		t.Error("downgrade hosts aren't matched by host name")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// linkPattern matches the href of an anchor tag, quoted or not
+var linkPattern = regexp.MustCompile(`(?is)<a\s[^>]*?\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+// IndexOptions controls which links DownloadIndex downloads
+type IndexOptions struct {
+	BatchOptions
+
+	Headers map[string]string
+	Cookies []*http.Cookie
+
+	// Glob, if set, is matched against the file name of each link
+	Glob string
+	// Regexp, if set, is matched against the full URL of each link
+	Regexp *regexp.Regexp
+	// SameHost skips links to other hosts
+	SameHost bool
+	// MaxCount fails the whole download if more links than this match, zero
+	// means no limit
+	MaxCount int
+}
+
+// DownloadIndex will download the files linked from an index page, see Downloader.DownloadIndex
+func DownloadIndex(indexURL *url.URL, destDir string, opts IndexOptions) (*BatchReport, error) {
+	return std.DownloadIndex(indexURL, destDir, opts)
+}
+
+// DownloadIndex will download the files linked from the index page at
+// indexURL that match opts into destDir. Links to directories, to parent
+// directories and sorting links are ignored.
+func (d *Downloader) DownloadIndex(indexURL *url.URL, destDir string, opts IndexOptions) (*BatchReport, error) {
+	links, err := d.IndexLinks(indexURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.MaxCount > 0 && len(links) > opts.MaxCount {
+		return nil, fmt.Errorf("dl: %s links to %d matching files, more than the limit of %d", indexURL.Redacted(), len(links), opts.MaxCount)
+	}
+
+	jobs := make([]Job, len(links))
+	for i, link := range links {
+		jobs[i] = Job{
+			RequestSpec: RequestSpec{
+				URL:     link,
+				Headers: opts.Headers,
+				Cookies: opts.Cookies,
+			},
+			Dest: filepath.Join(destDir, linkName(link)),
+		}
+	}
+
+	return d.DownloadAll(jobs, opts.BatchOptions)
+}
+
+// IndexLinks returns the links to files on the index page at indexURL that match opts
+func (d *Downloader) IndexLinks(indexURL *url.URL, opts IndexOptions) ([]*url.URL, error) {
+	body, err := d.GetBodyFromURL(indexURL, opts.Headers, &opts.Cookies)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := indexURL.Path
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir) + "/"
+	}
+
+	var links []*url.URL
+	seen := make(map[string]bool)
+	for _, m := range linkPattern.FindAllStringSubmatch(string(body), -1) {
+		href := html.UnescapeString(m[1] + m[2] + m[3])
+		if href == "" || strings.HasPrefix(href, "?") || strings.HasPrefix(href, "#") {
+			continue
+		}
+
+		ref, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+		link := indexURL.ResolveReference(ref)
+		link.Fragment = ""
+
+		switch {
+		case link.Scheme != indexURL.Scheme && link.Scheme != "http" && link.Scheme != "https":
+			continue
+		case strings.HasSuffix(link.Path, "/"):
+			// Directories, including the parent
+			continue
+		case link.Host == indexURL.Host && !strings.HasPrefix(link.Path, dir):
+			// Somewhere above the index
+			continue
+		case opts.SameHost && link.Host != indexURL.Host:
+			continue
+		case linkName(link) == "":
+			// Escaped slashes or dots that would put the file somewhere else
+			continue
+		}
+
+		if opts.Glob != "" {
+			if ok, _ := path.Match(opts.Glob, linkName(link)); !ok {
+				continue
+			}
+		}
+		if opts.Regexp != nil && !opts.Regexp.MatchString(link.String()) {
+			continue
+		}
+
+		if !seen[link.String()] {
+			seen[link.String()] = true
+			links = append(links, link)
+		}
+	}
+
+	return links, nil
+}
+
+// linkName returns the file name of link, or "" if it isn't one that can be
+// used as the name of a file in a directory
+func linkName(link *url.URL) string {
+	name := path.Base(link.Path)
+	if name == "." || name == ".." || name == "/" || strings.ContainsAny(name, `/\`) {
+		return ""
+	}
+	return name
+}
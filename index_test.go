@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestDownloadIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pub/" {
+			w.Write([]byte(`<html><a href="?C=M;O=A">Name</a> <a href="../">Parent</a> <a href="sub/">sub</a>
+<a href="a.tar.gz">a</a> <A HREF='b.tar.gz'>b</A> <a href=c.txt>c</a> <a href="/other/d.tar.gz">d</a>
+<a href="%2E%2E">up</a> <a href="..%5C..%5Cevil.tar.gz">evil</a> <a href="x%2F..%2F..%2Fevil.tar.gz">evil</a>`))
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/pub/")
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dest")
+	report, err := New().DownloadIndex(u, dest, IndexOptions{Glob: "*.tar.gz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, res := range report.Results {
+		got = append(got, res.Job.Dest)
+	}
+	sort.Strings(got)
+	// The escaped slashes only leave the base name, which stays in dest
+	if len(got) != 3 || got[0] != filepath.Join(dest, "a.tar.gz") || got[1] != filepath.Join(dest, "b.tar.gz") ||
+		got[2] != filepath.Join(dest, "evil.tar.gz") {
+		t.Fatalf("downloaded %q", got)
+	}
+	if body, _ := ioutil.ReadFile(got[0]); string(body) != "/pub/a.tar.gz" {
+		t.Fatalf("got %q", body)
+	}
+
+	// Nothing was written outside dest
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("%d entries next to dest", len(entries))
+	}
+}
+
+func TestLinkName(t *testing.T) {
+	for _, tt := range []struct {
+		path, name string
+	}{
+		{"/pub/a.tar.gz", "a.tar.gz"},
+		{"/pub/..", ""},
+		{"/pub/.", ""},
+		{"/", ""},
+		{"/pub/..\\..\\evil", ""},
+		{"/pub/a\\b", ""},
+	} {
+		if got := linkName(&url.URL{Path: tt.path}); got != tt.name {
+			t.Errorf("linkName(%q) = %q, want %q", tt.path, got, tt.name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// LineError is a line of a job list that couldn't be parsed
+type LineError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %q: %v", e.Line, e.Text, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// JobListError lists every line of a job list that couldn't be parsed
+type JobListError []*LineError
+
+func (e JobListError) Error() string {
+	msgs := make([]string, len(e))
+	for i, le := range e {
+		msgs[i] = le.Error()
+	}
+	return fmt.Sprintf("dl: %d bad lines in job list: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// JobsFromReader parses a list of URLs to download, one per line, each
+// optionally followed by whitespace and the path to save it to. Without a
+// path the file is saved under its own name in the working directory. Blank
+// lines and lines starting with # are skipped.
+//
+// Lines that can't be parsed don't stop the rest of the list from being read,
+// the jobs from every good line are returned along with a JobListError
+// describing the bad ones.
+func JobsFromReader(r io.Reader) ([]Job, error) {
+	var jobs []Job
+	var bad JobListError
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		dest := ""
+		if len(fields) > 1 {
+			dest = strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+		}
+
+		job, err := newJob(fields[0], dest, "", "")
+		if err != nil {
+			bad = append(bad, &LineError{Line: n, Text: line, Err: err})
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return jobs, err
+	}
+
+	if len(bad) > 0 {
+		return jobs, bad
+	}
+	return jobs, nil
+}
+
+// JobsFromTable parses a table of jobs separated by comma, such as ',' for CSV
+// or '\t' for TSV. The columns are the URL, the path to save it to and the
+// hex encoded checksum of the file, and all but the URL may be left empty or
+// out. A first row starting with "url" is taken as a header and skipped, as
+// are rows starting with #.
+//
+// Checksums are SHA-256 unless the header names another hash registered with
+// RegisterHash as the third column, such as "url,dest,blake3", or a checksum
+// is prefixed with its hash like "blake3:af1349b9...".
+//
+// Bad rows are reported the same way as JobsFromReader.
+func JobsFromTable(r io.Reader, comma rune) ([]Job, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var jobs []Job
+	var bad JobListError
+	algo := "sha256"
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			perr, ok := err.(*csv.ParseError)
+			if !ok {
+				return jobs, err
+			}
+			bad = append(bad, &LineError{Line: perr.StartLine, Text: strings.Join(record, string(comma)), Err: perr.Err})
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "url") {
+			if len(record) > 2 {
+				switch name := strings.ToLower(strings.TrimSpace(record[2])); name {
+				case "", "checksum", "hash", "sum":
+				default:
+					algo = name
+				}
+			}
+			continue
+		}
+		if len(record) > 3 {
+			bad = append(bad, &LineError{Line: line, Text: strings.Join(record, string(comma)), Err: fmt.Errorf("%d columns, expected at most 3", len(record))})
+			continue
+		}
+
+		fields := make([]string, 3)
+		for i, f := range record {
+			fields[i] = strings.TrimSpace(f)
+		}
+		if fields[0] == "" && len(record) == 1 {
+			continue
+		}
+
+		sumAlgo, sum := algo, fields[2]
+		if i := strings.IndexByte(sum, ':'); i >= 0 {
+			sumAlgo, sum = sum[:i], sum[i+1:]
+		}
+
+		job, err := newJob(fields[0], fields[1], sumAlgo, sum)
+		if err != nil {
+			bad = append(bad, &LineError{Line: line, Text: strings.Join(record, string(comma)), Err: err})
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	if len(bad) > 0 {
+		return jobs, bad
+	}
+	return jobs, nil
+}
+
+// newJob builds the Job for a line of a job list, sum is the checksum of the
+// file with the hash algo
+func newJob(rawurl, dest, algo, sum string) (Job, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return Job{}, err
+	}
+	if u.Scheme == "" {
+		return Job{}, fmt.Errorf("no scheme in URL %q", rawurl)
+	}
+
+	if dest == "" {
+		dest = path.Base(u.Path)
+		if dest == "/" || dest == "." {
+			return Job{}, fmt.Errorf("can't name a file after %q", rawurl)
+		}
+	}
+
+	job := Job{RequestSpec: *newSpec(u, nil, nil), Dest: dest}
+	if sum != "" {
+		h, err := newHash(algo)
+		if err != nil {
+			return Job{}, err
+		}
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != h.Size()*2 {
+			return Job{}, fmt.Errorf("malformed %s checksum %q", algo, sum)
+		}
+		job.Checksum = sum
+		job.ChecksumAlgorithm = strings.ToLower(algo)
+	}
+	return job, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJobsFromReader(t *testing.T) {
+	list := `# downloads for the release
+https://example.com/a.zip
+
+  https://example.com/dir/b.zip   out dir/b.zip  
+	# an indented comment
+::not a url
+https://example.com/
+example.com/no-scheme.zip
+https://example.com/c.zip?x=1 c.zip
+`
+	jobs, err := JobsFromReader(strings.NewReader(list))
+
+	want := []struct{ url, dest string }{
+		{"https://example.com/a.zip", "a.zip"},
+		{"https://example.com/dir/b.zip", "out dir/b.zip"},
+		{"https://example.com/c.zip?x=1", "c.zip"},
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("got %d jobs, want %d", len(jobs), len(want))
+	}
+	for i, w := range want {
+		if jobs[i].URL.String() != w.url || jobs[i].Dest != w.dest {
+			t.Errorf("job %d is %s to %q, want %s to %q", i, jobs[i].URL, jobs[i].Dest, w.url, w.dest)
+		}
+	}
+
+	// Every bad line is reported with its line number
+	var bad JobListError
+	if !errors.As(err, &bad) {
+		t.Fatalf("got %v, want a JobListError", err)
+	}
+	wantBad := []struct {
+		line int
+		text string
+	}{
+		{6, "::not a url"},
+		{7, "https://example.com/"},
+		{8, "example.com/no-scheme.zip"},
+	}
+	if len(bad) != len(wantBad) {
+		t.Fatalf("got %d bad lines, want %d: %v", len(bad), len(wantBad), err)
+	}
+	for i, w := range wantBad {
+		if bad[i].Line != w.line || bad[i].Text != w.text || bad[i].Err == nil {
+			t.Errorf("bad line %d is %+v, want line %d %q", i, bad[i], w.line, w.text)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "dl: 3 bad lines in job list: line 6: ") {
+		t.Errorf("got %q", err)
+	}
+
+	// A good list has no error
+	if jobs, err := JobsFromReader(strings.NewReader("https://example.com/a\n\n# done\n")); err != nil || len(jobs) != 1 {
+		t.Errorf("got %d jobs, %v", len(jobs), err)
+	}
+}
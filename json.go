@@ -0,0 +1,86 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GetJSON will decode the JSON body of the url into v
+func GetJSON(u *url.URL, v interface{}, headers map[string]string, cookies *[]*http.Cookie) error {
+	return std.GetJSON(u, v, headers, cookies)
+}
+
+// GetJSON will decode the JSON body of the url into v. It asks for JSON with
+// the Accept header unless headers already has one, and fails if the server
+// answers with something else.
+func (d *Downloader) GetJSON(u *url.URL, v interface{}, headers map[string]string, cookies *[]*http.Cookie) error {
+	h := map[string]string{"Accept": "application/json"}
+	for k, val := range headers {
+		h[http.CanonicalHeaderKey(k)] = val
+	}
+
+	req, err := d.newRequest(newSpec(u, h, cookies))
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	if err := d.validate(resp); err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); !isJSON(ct) {
+		return fmt.Errorf("dl: %s returned %q, not JSON", u.String(), ct)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("dl: decoding JSON from %s: %w", u.String(), err)
+	}
+	return nil
+}
+
+// isJSON reports whether contentType is JSON or a JSON based type like application/problem+json
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
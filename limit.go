@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"sync"
+)
+
+var (
+	slotsMu sync.Mutex
+	slots   chan struct{}
+)
+
+// SetMaxConcurrentDownloads limits how many file downloads can run at once
+// across the whole package, blocking any more until one finishes. Zero means
+// no limit.
+func SetMaxConcurrentDownloads(n int) {
+	slotsMu.Lock()
+	defer slotsMu.Unlock()
+
+	if n <= 0 {
+		slots = nil
+		return
+	}
+	slots = make(chan struct{}, n)
+}
+
+// acquireSlot blocks until a download slot is free and returns the function
+// that frees it again
+func acquireSlot() func() {
+	slotsMu.Lock()
+	s := slots
+	slotsMu.Unlock()
+
+	if s == nil {
+		return func() {}
+	}
+
+	s <- struct{}{}
+	return func() { <-s }
+}
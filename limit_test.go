@@ -0,0 +1,85 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrentDownloads(t *testing.T) {
+	const limit, downloads = 2, 6
+	var running, most int32
+	gate := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		<-gate
+		w.Write([]byte("done"))
+	}))
+	defer srv.Close()
+
+	SetMaxConcurrentDownloads(limit)
+	defer SetMaxConcurrentDownloads(0)
+
+	dir := t.TempDir()
+	d := New()
+	var wg sync.WaitGroup
+	for i := 0; i < downloads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u, _ := url.Parse(fmt.Sprintf("%s/%d", srv.URL, i))
+			if _, err := d.DownloadFile(filepath.Join(dir, fmt.Sprint(i)), u, nil, nil); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	// Wait for the limit to fill up, then give any extra downloads a
+	// chance to get through before opening the gate
+	for atomic.LoadInt32(&running) < limit {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&running); n != limit {
+		t.Errorf("%d downloads running, want %d", n, limit)
+	}
+	close(gate)
+	wg.Wait()
+
+	if most > limit {
+		t.Fatalf("%d downloads ran at once, limit is %d", most, limit)
+	}
+}
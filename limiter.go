@@ -0,0 +1,139 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// limiterChunk is the most that is read before waiting on a Limiter
+const limiterChunk = 32 * 1024
+
+// Limiter limits how fast downloads go, a *rate.Limiter from
+// golang.org/x/time/rate is one
+type Limiter interface {
+	// WaitN blocks until n bytes may be transferred
+	WaitN(ctx context.Context, n int) error
+}
+
+// SetSharedLimiter limits the dl package's downloads with l, see WithSharedLimiter
+func SetSharedLimiter(l Limiter) {
+	WithSharedLimiter(l)(std)
+}
+
+// WithSharedLimiter makes the body of every download wait on l for each
+// chunk of bytes it reads, so that the same Limiter can keep several
+// Downloaders within one bandwidth budget. Reads are cut down to at most
+// 32KiB, or the limiter's burst if it has a Burst method that returns less,
+// so no single read goes far over the limit. nil removes the limit.
+func WithSharedLimiter(l Limiter) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.limiter = l
+	}
+}
+
+// NewRateLimiter returns a Limiter that lets bytesPerSec bytes through a
+// second, and up to a second's worth at once after being idle
+func NewRateLimiter(bytesPerSec int64) Limiter {
+	if bytesPerSec <= 0 {
+		bytesPerSec = 1
+	}
+	return &rateLimiter{rate: bytesPerSec}
+}
+
+// rateLimiter is the Limiter returned by NewRateLimiter
+type rateLimiter struct {
+	rate int64
+
+	mu sync.Mutex
+	// paid is when the bytes let through so far will have taken their time
+	paid time.Time
+}
+
+func (l *rateLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if idle := now.Add(-time.Second); l.paid.Before(idle) {
+		l.paid = idle
+	}
+	l.paid = l.paid.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	wait := l.paid.Sub(now)
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Burst is the most that can go through at once
+func (l *rateLimiter) Burst() int {
+	return int(l.rate)
+}
+
+// limitReader returns r limited by the Downloader's Limiter, if it has one
+func (d *Downloader) limitReader(ctx context.Context, r io.Reader) io.Reader {
+	d.mu.RLock()
+	l := d.limiter
+	d.mu.RUnlock()
+	if l == nil {
+		return r
+	}
+
+	chunk := limiterChunk
+	if b, ok := l.(interface{ Burst() int }); ok && b.Burst() > 0 && b.Burst() < chunk {
+		chunk = b.Burst()
+	}
+	return &limitedReader{r: r, l: l, ctx: ctx, chunk: chunk}
+}
+
+// limitedReader waits on a Limiter for the bytes it reads
+type limitedReader struct {
+	r     io.Reader
+	l     Limiter
+	ctx   context.Context
+	chunk int
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > lr.chunk {
+		p = p[:lr.chunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := lr.l.WaitN(lr.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
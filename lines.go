@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// DefaultMaxLineLength is the longest line DownloadLines accepts unless it is
+// changed with WithMaxLineLength
+const DefaultMaxLineLength = bufio.MaxScanTokenSize
+
+// SetMaxLineLength sets the longest line the dl package's DownloadLines
+// accepts, see WithMaxLineLength
+func SetMaxLineLength(n int) {
+	WithMaxLineLength(n)(std)
+}
+
+// WithMaxLineLength sets the longest line in bytes that DownloadLines
+// accepts, a longer one fails the download with bufio.ErrTooLong. Zero or
+// less goes back to DefaultMaxLineLength.
+func WithMaxLineLength(n int) Option {
+	return func(d *Downloader) {
+		d.maxLineLength = n
+	}
+}
+
+// DownloadLines will call fn with each line of the body of the url, see Downloader.DownloadLines
+func DownloadLines(u *url.URL, headers map[string]string, cookies *[]*http.Cookie, fn func(line []byte) error) error {
+	return std.DownloadLines(u, headers, cookies, fn)
+}
+
+// DownloadLines will call fn with each line of the body of the url as it is
+// read, without the line ending, so large text files never have to be held in
+// memory. The line is only valid until fn returns. If fn returns an error
+// the download stops and that error is returned.
+func (d *Downloader) DownloadLines(u *url.URL, headers map[string]string, cookies *[]*http.Cookie, fn func(line []byte) error) error {
+	req, err := d.newRequest(newSpec(u, headers, cookies))
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	if err := d.validate(resp); err != nil {
+		return err
+	}
+
+	max := d.maxLineLength
+	if max <= 0 {
+		max = DefaultMaxLineLength
+	}
+
+	// The scanner needs room for the line ending as well as the line, and
+	// takes a buffer bigger than that as the limit instead
+	size := 4096
+	if size > max+2 {
+		size = max + 2
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, size), max+2)
+	for scanner.Scan() {
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("dl: reading lines of %s: %w", u.Redacted(), err)
+	}
+	return nil
+}
+
+// DownloadNDJSON will call fn with each JSON value of a newline delimited JSON
+// body, see Downloader.DownloadNDJSON
+func DownloadNDJSON(u *url.URL, headers map[string]string, cookies *[]*http.Cookie, fn func(json.RawMessage) error) error {
+	return std.DownloadNDJSON(u, headers, cookies, fn)
+}
+
+// DownloadNDJSON will call fn with each value of a newline delimited JSON
+// body as it arrives, skipping blank lines. A line that isn't valid JSON
+// stops the download with a LineError saying which line it was, and if fn
+// returns an error the download stops and that error is returned.
+func (d *Downloader) DownloadNDJSON(u *url.URL, headers map[string]string, cookies *[]*http.Cookie, fn func(json.RawMessage) error) error {
+	n := 0
+	return d.DownloadLines(u, headers, cookies, func(line []byte) error {
+		n++
+		if len(bytes.TrimSpace(line)) == 0 {
+			return nil
+		}
+
+		var msg json.RawMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			text := string(line)
+			if len(text) > 80 {
+				text = text[:80] + "..."
+			}
+			return fmt.Errorf("dl: decoding JSON from %s: %w", u.Redacted(), &LineError{Line: n, Text: text, Err: err})
+		}
+		return fn(msg)
+	})
+}
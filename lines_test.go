@@ -0,0 +1,132 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newLinesServer(t *testing.T, body string) *url.URL {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL + "/lines")
+	return u
+}
+
+func TestDownloadLines(t *testing.T) {
+	u := newLinesServer(t, "first\r\nsecond\n\nfourth")
+
+	var lines []string
+	err := New().DownloadLines(u, nil, nil, func(line []byte) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%q", lines) != `["first" "second" "" "fourth"]` {
+		t.Fatalf("got %q", lines)
+	}
+}
+
+func TestDownloadLinesStop(t *testing.T) {
+	var body strings.Builder
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&body, "line %d\n", i)
+	}
+	u := newLinesServer(t, body.String())
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := New().DownloadLines(u, nil, nil, func(line []byte) error {
+		calls++
+		if string(line) == "line 3" {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("got %v, want the callback's error", err)
+	}
+	if calls != 3 {
+		t.Fatalf("called %d times after stopping at the third line", calls)
+	}
+}
+
+func TestDownloadLinesTooLong(t *testing.T) {
+	u := newLinesServer(t, "short\n"+strings.Repeat("x", 100)+"\n")
+
+	err := New(WithMaxLineLength(50)).DownloadLines(u, nil, nil, func(line []byte) error { return nil })
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Fatalf("got %v, want bufio.ErrTooLong", err)
+	}
+}
+
+func TestDownloadNDJSON(t *testing.T) {
+	u := newLinesServer(t, `{"id":1,"name":"a"}
+{"id":2,"name":"b"}
+
+{"id":3,"name":"c"}
+`)
+
+	var ids []int
+	err := New().DownloadNDJSON(u, nil, nil, func(msg json.RawMessage) error {
+		var v struct{ ID int }
+		if err := json.Unmarshal(msg, &v); err != nil {
+			return err
+		}
+		ids = append(ids, v.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[1 2 3]" {
+		t.Fatalf("got %v", ids)
+	}
+}
+
+func TestDownloadNDJSONInvalid(t *testing.T) {
+	u := newLinesServer(t, "{\"id\":1}\n{\"id\":\n{\"id\":3}\n")
+
+	calls := 0
+	err := New().DownloadNDJSON(u, nil, nil, func(msg json.RawMessage) error {
+		calls++
+		return nil
+	})
+	var le *LineError
+	if !errors.As(err, &le) || le.Line != 2 {
+		t.Fatalf("got %v, want a LineError for line 2", err)
+	}
+	if calls != 1 {
+		t.Fatalf("called %d times", calls)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxMetaRefreshPage is how much of an HTML page is searched for a meta refresh
+const maxMetaRefreshPage = 64 << 10
+
+var (
+	metaTag       = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	refreshEquiv  = regexp.MustCompile(`(?is)\shttp-equiv\s*=\s*["']?refresh["'\s/>]`)
+	contentAttrib = regexp.MustCompile(`(?is)\scontent\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// SetFollowMetaRefresh sets whether the dl package follows meta refresh
+// redirects in HTML pages
+func SetFollowMetaRefresh(follow bool) {
+	WithFollowMetaRefresh(follow)(std)
+}
+
+// WithFollowMetaRefresh sets whether the Downloader follows the meta refresh
+// in an HTML page to the URL it points to, like the interstitial pages some
+// sites show before a download. Only successful text/html responses to GET
+// requests are looked at, and meta refreshes count towards the redirect limit.
+func WithFollowMetaRefresh(follow bool) Option {
+	return func(d *Downloader) {
+		d.metaRefresh = follow
+	}
+}
+
+// followMetaRefresh follows any meta refreshes starting at resp
+func (d *Downloader) followMetaRefresh(req *http.Request, resp *http.Response) (*http.Response, error) {
+	for hops := 0; ; hops++ {
+		target, err := metaRefreshTarget(resp)
+		if err != nil || target == nil {
+			return resp, err
+		}
+		if target.Scheme != "http" && target.Scheme != "https" {
+			d.log.Warnf("Not following meta refresh from %s to %s\n", resp.Request.URL.Redacted(), target.Redacted())
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if hops >= maxRedirects {
+			return nil, errors.New("dl: stopped after 10 meta refreshes")
+		}
+		if d.insecure(target) {
+			return nil, fmt.Errorf("%w: %s refreshed to %s", ErrInsecureRedirect, resp.Request.URL.Redacted(), target.Redacted())
+		}
+		if err := d.checkHost(target); err != nil {
+			return nil, err
+		}
+
+		d.log.Debugf("Following meta refresh from %s to %s\n", resp.Request.URL.Redacted(), target.Redacted())
+		if d.onRedirect != nil {
+			d.onRedirect(resp.Request.URL, target, resp.StatusCode)
+		}
+		prev := resp.Request
+		req = req.Clone(req.Context())
+		req.URL = target
+		req.Host = ""
+		if target.Host != prev.URL.Host {
+			// Don't hand credentials meant for one host to another, the same
+			// as the http client does for redirects
+			for _, h := range []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"} {
+				req.Header.Del(h)
+			}
+		}
+		d.redirectReferer(req, []*http.Request{prev})
+
+		if err := d.runRequestHooks(req); err != nil {
+			return nil, err
+		}
+		if resp, err = d.send(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// metaRefreshTarget returns the URL a meta refresh in resp points to, or nil
+// if it isn't an HTML page with one. The body of resp is left unread.
+func metaRefreshTarget(resp *http.Response) (*url.URL, error) {
+	if resp.Request == nil || resp.Request.Method != "GET" || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/html" {
+		return nil, nil
+	}
+
+	page, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMetaRefreshPage))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(page), resp.Body), resp.Body}
+
+	for _, tag := range metaTag.FindAll(page, -1) {
+		if !refreshEquiv.Match(tag) {
+			continue
+		}
+		m := contentAttrib.FindSubmatch(tag)
+		if m == nil {
+			continue
+		}
+		content := string(m[1]) + string(m[2]) + string(m[3])
+
+		i := strings.IndexByte(content, ';')
+		if i < 0 {
+			i = strings.IndexByte(content, ',')
+		}
+		if i < 0 {
+			continue
+		}
+		ref := strings.TrimSpace(content[i+1:])
+		if len(ref) >= 4 && strings.EqualFold(ref[:4], "url=") {
+			ref = strings.TrimSpace(ref[4:])
+		}
+		ref = strings.Trim(ref, `"'`)
+		if ref == "" {
+			continue
+		}
+
+		target, err := resp.Request.URL.Parse(ref)
+		if err != nil {
+			continue
+		}
+		return target, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newMetaRefreshServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><title>Your download will start shortly</title>
+<META HTTP-EQUIV="Refresh" CONTENT="3; URL='/files/real.bin'"></head></html>`))
+		case "/loop":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<meta http-equiv=refresh content="0;url=/loop">`))
+		case "/files/real.bin":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("the real file"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFollowMetaRefresh(t *testing.T) {
+	srv := newMetaRefreshServer(t)
+	u, _ := url.Parse(srv.URL + "/download")
+	dir := t.TempDir()
+
+	var hops []string
+	d := New(WithFollowMetaRefresh(true), WithOnRedirect(func(from, to *url.URL, status int) {
+		hops = append(hops, from.Path+" "+to.Path)
+	}))
+	dest := filepath.Join(dir, "followed")
+	if _, err := d.DownloadFile(dest, u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadFile(dest); string(body) != "the real file" {
+		t.Fatalf("got %q", body)
+	}
+	if len(hops) != 1 || hops[0] != "/download /files/real.bin" {
+		t.Fatalf("redirects %q", hops)
+	}
+
+	// It's off by default
+	dest = filepath.Join(dir, "page")
+	if _, err := New().DownloadFile(dest, u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadFile(dest); !strings.Contains(string(body), "<html>") {
+		t.Fatalf("got %q", body)
+	}
+}
+
+func TestFollowMetaRefreshLoop(t *testing.T) {
+	srv := newMetaRefreshServer(t)
+	u, _ := url.Parse(srv.URL + "/loop")
+
+	d := New(WithFollowMetaRefresh(true), WithLogger(quietLogger()))
+	if _, err := d.DownloadFile(filepath.Join(t.TempDir(), "loop"), u, nil, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestFollowMetaRefreshHooks(t *testing.T) {
+	srv := newMetaRefreshServer(t)
+	u, _ := url.Parse(srv.URL + "/download")
+
+	var requests, responses []string
+	d := New(WithFollowMetaRefresh(true), WithLogger(quietLogger()), WithRequestHook(func(req *http.Request) error {
+		requests = append(requests, req.URL.Path)
+		return nil
+	}), WithResponseHook(func(resp *http.Response) error {
+		responses = append(responses, resp.Request.URL.Path)
+		return nil
+	}))
+	if _, err := d.DownloadFile(filepath.Join(t.TempDir(), "f"), u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 || requests[1] != "/files/real.bin" || len(responses) != 1 || responses[0] != "/files/real.bin" {
+		t.Fatalf("hooks saw requests %q and responses %q", requests, responses)
+	}
+
+	// A hook can stop the refresh being followed
+	d = New(WithFollowMetaRefresh(true), WithLogger(quietLogger()), WithRequestHook(func(req *http.Request) error {
+		if req.URL.Path != "/download" {
+			return errors.New("refused")
+		}
+		return nil
+	}))
+	if _, err := d.DownloadFile(filepath.Join(t.TempDir(), "f"), u, nil, nil); err == nil || !strings.Contains(err.Error(), "request hook: refused") {
+		t.Fatalf("got %v", err)
+	}
+}
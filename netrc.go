@@ -0,0 +1,231 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcEntry is a machine or default entry of a netrc file
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// netrc is a parsed netrc file
+type netrc struct {
+	machines map[string]netrcEntry
+	// def is the default entry, nil if there isn't one
+	def *netrcEntry
+}
+
+// SetNetrc makes the dl package use credentials from a netrc file, see WithNetrc
+func SetNetrc(path string) {
+	WithNetrc(path)(std)
+}
+
+// WithNetrc sends Basic auth credentials from the netrc file at path, the one
+// named by $NETRC or ~/.netrc if path is empty, to hosts it has a machine
+// entry for, or to any host if it has a default entry. Requests that already
+// have credentials, in an Authorization header or the URL, are left alone.
+// A missing or unreadable file just means no credentials. The credentials
+// aren't sent on to another host when a request is redirected.
+func WithNetrc(path string) Option {
+	return func(d *Downloader) {
+		if path == "" {
+			path = os.Getenv("NETRC")
+		}
+		if path == "" {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, ".netrc")
+			}
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			d.log.Debugf("Not using netrc: %v\n", err)
+		}
+		n := parseNetrc(string(data))
+
+		d.mu.Lock()
+		d.netrc = n
+		d.mu.Unlock()
+	}
+}
+
+// setNetrcAuth adds credentials from the netrc file to req if it has none
+func (d *Downloader) setNetrcAuth(req *http.Request) {
+	if req.URL.User != nil || req.Header.Get("Authorization") != "" {
+		return
+	}
+	if e, ok := d.netrcEntry(req.URL.Hostname()); ok {
+		req.SetBasicAuth(e.login, e.password)
+	}
+}
+
+// netrcEntry returns the netrc entry for host
+func (d *Downloader) netrcEntry(host string) (netrcEntry, bool) {
+	d.mu.RLock()
+	n := d.netrc
+	d.mu.RUnlock()
+	if n == nil {
+		return netrcEntry{}, false
+	}
+
+	if e, ok := n.machines[strings.ToLower(host)]; ok {
+		return e, true
+	}
+	if n.def != nil {
+		return *n.def, true
+	}
+	return netrcEntry{}, false
+}
+
+// redirectNetrc drops credentials from the netrc file from a redirect to
+// another host
+func (d *Downloader) redirectNetrc(req *http.Request, via []*http.Request) error {
+	first := via[0]
+	if strings.EqualFold(req.URL.Hostname(), first.URL.Hostname()) {
+		return nil
+	}
+
+	e, ok := d.netrcEntry(first.URL.Hostname())
+	if !ok {
+		return nil
+	}
+	user, pass, ok := req.BasicAuth()
+	if ok && user == e.login && pass == e.password {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// parseNetrc parses the machine and default entries of a netrc file. macdef
+// macros are skipped.
+func parseNetrc(data string) *netrc {
+	n := &netrc{machines: make(map[string]netrcEntry)}
+
+	var tokens []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		lineTokens := netrcTokens(line)
+		if len(lineTokens) > 0 && lineTokens[0] == "macdef" {
+			// A macro runs until the next blank line
+			for scanner.Scan() {
+				if strings.TrimSpace(scanner.Text()) == "" {
+					break
+				}
+			}
+			continue
+		}
+		tokens = append(tokens, lineTokens...)
+	}
+
+	var e *netrcEntry
+	var machine string
+	save := func() {
+		if e == nil {
+			return
+		}
+		if machine == "" {
+			n.def = e
+		} else if _, ok := n.machines[machine]; !ok {
+			// The first entry for a machine wins, like curl
+			n.machines[machine] = *e
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		next := func() string {
+			if i+1 < len(tokens) {
+				i++
+				return tokens[i]
+			}
+			return ""
+		}
+
+		switch tokens[i] {
+		case "machine":
+			save()
+			e, machine = &netrcEntry{}, strings.ToLower(next())
+		case "default":
+			save()
+			e, machine = &netrcEntry{}, ""
+		case "login":
+			if v := next(); e != nil {
+				e.login = v
+			}
+		case "password":
+			if v := next(); e != nil {
+				e.password = v
+			}
+		case "account":
+			next()
+		}
+	}
+	save()
+	return n
+}
+
+// netrcTokens splits a line of a netrc file into tokens, which may be quoted
+// with backslash escapes
+func netrcTokens(line string) []string {
+	var tokens []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return tokens
+		}
+
+		if line[0] != '"' {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			tokens = append(tokens, line[:end])
+			line = line[end:]
+			continue
+		}
+
+		var tok strings.Builder
+		i := 1
+		for ; i < len(line) && line[i] != '"'; i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+			}
+			tok.WriteByte(line[i])
+		}
+		if i < len(line) {
+			i++
+		}
+		tokens = append(tokens, tok.String())
+		line = line[i:]
+	}
+}
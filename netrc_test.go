@@ -0,0 +1,162 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	n := parseNetrc(`# a comment
+machine Example.COM login user password "pass word\"s"
+machine example.com login second password ignored
+
+macdef init
+machine evil.com login macro password macro
+cd /pub
+
+machine
+  other.com
+  login other account acct
+  password secret
+default login anonymous password me@example.com
+`)
+	want := map[string]netrcEntry{
+		"example.com": {"user", `pass word"s`},
+		"other.com":   {"other", "secret"},
+	}
+	if len(n.machines) != len(want) {
+		t.Errorf("got machines %+v", n.machines)
+	}
+	for host, e := range want {
+		if got := n.machines[host]; got != e {
+			t.Errorf("%s: got %+v, want %+v", host, got, e)
+		}
+	}
+	if n.def == nil || *n.def != (netrcEntry{"anonymous", "me@example.com"}) {
+		t.Errorf("got default %+v", n.def)
+	}
+
+	for line, want := range map[string][]string{
+		`machine a login b`:     {"machine", "a", "login", "b"},
+		"\tpassword  \"a b\" x": {"password", "a b", "x"},
+		`password "a\\b\"c`:     {"password", `a\b"c`},
+		`password ""`:           {"password", ""},
+		"":                      nil,
+	} {
+		if got := netrcTokens(line); strings.Join(got, "|") != strings.Join(want, "|") || len(got) != len(want) {
+			t.Errorf("netrcTokens(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+// newBasicAuthServer serves /file, redirecting to it from /redirect?to=, and
+// records the Basic auth user of every request, or "-" for none
+func newBasicAuthServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var users []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok {
+			user, pass = "-", ""
+		}
+		mu.Lock()
+		users = append(users, user+pass)
+		mu.Unlock()
+		if to := r.URL.Query().Get("to"); to != "" {
+			http.Redirect(w, r, to, http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := users
+		users = nil
+		return got
+	}
+}
+
+func TestNetrc(t *testing.T) {
+	srv, users := newBasicAuthServer(t)
+	u, _ := url.Parse(srv.URL + "/file")
+	other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "netrc")
+	ioutil.WriteFile(path, []byte("machine 127.0.0.1 login user password pass\nmachine localhost login other password word\n"), 0600)
+	d := New(WithLogger(quietLogger()), WithNetrc(path))
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := users(); len(got) != 1 || got[0] != "userpass" {
+		t.Errorf("sent %q", got)
+	}
+
+	// Credentials already on the request are left alone
+	withUser := *u
+	withUser.User = url.UserPassword("url", "pass")
+	if _, err := d.GetBodyFromURL(&withUser, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := users(); len(got) != 1 || got[0] != "urlpass" {
+		t.Errorf("sent %q", got)
+	}
+
+	// A redirect to the same host keeps them, one to another host drops
+	// them, even though netrc has an entry for it
+	for _, tc := range []struct{ to, want string }{
+		{srv.URL + "/file", "userpass userpass"},
+		{other + "/file", "userpass -"},
+	} {
+		from, _ := url.Parse(srv.URL + "/redirect?to=" + url.QueryEscape(tc.to))
+		if _, err := d.GetBodyFromURL(from, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := users(); strings.Join(got, " ") != tc.want {
+			t.Errorf("redirect to %s: sent %q, want %q", tc.to, got, tc.want)
+		}
+	}
+
+	// $NETRC is used when no path is given, and a missing file just means
+	// no credentials
+	t.Setenv("NETRC", path)
+	d = New(WithLogger(quietLogger()), WithNetrc(""))
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	WithNetrc(filepath.Join(dir, "missing"))(d)
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := users(); len(got) != 2 || got[0] != "userpass" || got[1] != "-" {
+		t.Errorf("sent %q", got)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"net/http"
+	"path/filepath"
+)
+
+// SetPathFunc sets a function that picks where the dl package writes each
+// download once it has the response, see WithPathFunc
+func SetPathFunc(fn func(orig string, resp *http.Response) string) {
+	WithPathFunc(fn)(std)
+}
+
+// WithPathFunc sets a function that picks where each download is written
+// once the response to it has arrived, so a file can be named by its
+// Content-Type or Content-Disposition. It is called with the path the
+// download was asked to go to and the response, before its body is read,
+// and an empty result keeps that path. The download is written to a part
+// file next to the new path and renamed into place like any other, and the
+// DownloadResult's Path is where it ended up. Whether a file is already up
+// to date is still checked at the original path. nil removes it.
+func WithPathFunc(fn func(orig string, resp *http.Response) string) Option {
+	return func(d *Downloader) {
+		d.pathFunc = fn
+	}
+}
+
+// choosePath moves t to the path the path func picks for resp
+func (d *Downloader) choosePath(t *transfer, resp *http.Response) {
+	if d.pathFunc == nil {
+		return
+	}
+
+	fileloc := d.pathFunc(t.dest, resp)
+	if fileloc == "" || fileloc == t.fileloc {
+		return
+	}
+	d.log.Debugf("Writing %s to %s\n", filepath.Base(t.dest), fileloc)
+	t.fileloc = fileloc
+	t.part = fileloc + partSuffix
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathFunc(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/image" {
+			w.Header().Set("Content-Type", "image/png")
+		} else {
+			w.Header().Set("Content-Type", "application/x-unknown")
+		}
+		w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	d := New(WithLogger(quietLogger()), WithPathFunc(func(orig string, resp *http.Response) string {
+		exts, _ := mime.ExtensionsByType(resp.Header.Get("Content-Type"))
+		if len(exts) == 0 {
+			return ""
+		}
+		return orig + exts[0]
+	}))
+
+	u, _ := url.Parse(srv.URL + "/image")
+	res, err := d.Download(filepath.Join(dir, "image"), &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "image.png"); res.Path != want {
+		t.Fatalf("written to %s, want %s", res.Path, want)
+	}
+	if got, _ := ioutil.ReadFile(res.Path); string(got) != "data" {
+		t.Errorf("got %q", got)
+	}
+	if FileExists(filepath.Join(dir, "image")) || FileExists(res.Path+partSuffix) {
+		t.Error("files left at the original or part path")
+	}
+
+	// An empty path keeps the original
+	u, _ = url.Parse(srv.URL + "/other")
+	res, err = d.Download(filepath.Join(dir, "other"), &RequestSpec{URL: u})
+	if err != nil || res.Path != filepath.Join(dir, "other") {
+		t.Errorf("written to %s, %v", res.Path, err)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxPatternExpansion is the most URLs ExpandURL will expand a pattern to
+const MaxPatternExpansion = 100000
+
+// placeholder matches the #N references to a pattern's globs in a destination template
+var placeholder = regexp.MustCompile(`#(\d+)`)
+
+// PatternError describes a syntax error in a URL pattern
+type PatternError struct {
+	Pattern string
+	// Pos is the byte offset of the error in Pattern
+	Pos int
+	Msg string
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("dl: bad URL pattern at position %d: %s", e.Pos, e.Msg)
+}
+
+// expansion is one URL expanded from a pattern, along with the values its globs took
+type expansion struct {
+	url    string
+	values []string
+}
+
+// ExpandURL expands a curl style URL pattern into every URL it matches.
+// Patterns can hold numeric ranges like [1-10], [001-100] or [0-100:10],
+// letter ranges like [a-z], and lists like {alpha,beta}. A backslash escapes
+// the next character.
+func ExpandURL(pattern string) ([]*url.URL, error) {
+	exps, err := expandPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*url.URL, len(exps))
+	for i, e := range exps {
+		if urls[i], err = url.Parse(e.url); err != nil {
+			return nil, err
+		}
+	}
+	return urls, nil
+}
+
+func expandPattern(pattern string) ([]expansion, error) {
+	// Each part is a literal with one value or a glob with many
+	var parts [][]string
+	var literal strings.Builder
+
+	total := 1
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				literal.WriteByte(pattern[i])
+				continue
+			}
+			literal.WriteByte(c)
+		case '[', '{':
+			closer := byte(']')
+			if c == '{' {
+				closer = '}'
+			}
+
+			end := strings.IndexAny(pattern[i+1:], "[]{}")
+			if end < 0 || pattern[i+1+end] != closer {
+				if end >= 0 && (pattern[i+1+end] == '[' || pattern[i+1+end] == '{') {
+					return nil, &PatternError{pattern, i + 1 + end, "nested globs are not supported"}
+				}
+				return nil, &PatternError{pattern, i, fmt.Sprintf("unclosed %q", c)}
+			}
+			body := pattern[i+1 : i+1+end]
+
+			var values []string
+			var err error
+			if c == '[' {
+				values, err = expandRange(body)
+			} else {
+				values = strings.Split(body, ",")
+			}
+			if err != nil {
+				return nil, &PatternError{pattern, i, err.Error()}
+			}
+
+			total *= len(values)
+			if total > MaxPatternExpansion {
+				return nil, &PatternError{pattern, i, fmt.Sprintf("expands to more than %d URLs", MaxPatternExpansion)}
+			}
+
+			parts = append(parts, []string{literal.String()}, values)
+			literal.Reset()
+			i += end + 1
+		case ']', '}':
+			return nil, &PatternError{pattern, i, fmt.Sprintf("unexpected %q", c)}
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	parts = append(parts, []string{literal.String()})
+
+	exps := []expansion{{}}
+	for n, part := range parts {
+		glob := n%2 == 1
+		next := make([]expansion, 0, len(exps)*len(part))
+		for _, e := range exps {
+			for _, v := range part {
+				values := e.values
+				if glob {
+					values = append(append([]string(nil), e.values...), v)
+				}
+				next = append(next, expansion{url: e.url + v, values: values})
+			}
+		}
+		exps = next
+	}
+	return exps, nil
+}
+
+// expandRange expands the inside of a [] glob
+func expandRange(body string) ([]string, error) {
+	step := 1
+	if i := strings.IndexByte(body, ':'); i >= 0 {
+		var err error
+		if step, err = strconv.Atoi(body[i+1:]); err != nil || step < 1 {
+			return nil, fmt.Errorf("bad step %q", body[i+1:])
+		}
+		body = body[:i]
+	}
+
+	bounds := strings.SplitN(body, "-", 2)
+	if len(bounds) != 2 || bounds[0] == "" || bounds[1] == "" {
+		return nil, fmt.Errorf("bad range %q", body)
+	}
+	lo, hi := bounds[0], bounds[1]
+
+	if len(lo) == 1 && len(hi) == 1 && isLetter(lo[0]) && isLetter(hi[0]) {
+		if lo[0] > hi[0] || (lo[0] <= 'Z') != (hi[0] <= 'Z') {
+			return nil, fmt.Errorf("bad letter range %q", body)
+		}
+		var values []string
+		for c := int(lo[0]); c <= int(hi[0]); c += step {
+			values = append(values, string(rune(c)))
+		}
+		return values, nil
+	}
+
+	start, err1 := strconv.Atoi(lo)
+	end, err2 := strconv.Atoi(hi)
+	if err1 != nil || err2 != nil || start < 0 || start > end {
+		return nil, fmt.Errorf("bad numeric range %q", body)
+	}
+	if (end-start)/step+1 > MaxPatternExpansion {
+		return nil, fmt.Errorf("range %q is too large", body)
+	}
+
+	width := 0
+	if len(lo) > 1 && lo[0] == '0' {
+		width = len(lo)
+	}
+
+	var values []string
+	for n := start; n <= end; n += step {
+		values = append(values, fmt.Sprintf("%0*d", width, n))
+	}
+	return values, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// DownloadPattern will download every URL matched by pattern, see Downloader.DownloadPattern
+func DownloadPattern(pattern, dest string, headers map[string]string, cookies *[]*http.Cookie, opts BatchOptions) (*BatchReport, error) {
+	return std.DownloadPattern(pattern, dest, headers, cookies, opts)
+}
+
+// DownloadPattern will download every URL matched by pattern as a batch. If
+// dest holds #1, #2 and so on, they are replaced with the value of that glob
+// to name each file, otherwise dest is the directory the files are saved in
+// under their own names.
+func (d *Downloader) DownloadPattern(pattern, dest string, headers map[string]string, cookies *[]*http.Cookie, opts BatchOptions) (*BatchReport, error) {
+	exps, err := expandPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, len(exps))
+	for i, e := range exps {
+		u, err := url.Parse(e.url)
+		if err != nil {
+			return nil, err
+		}
+
+		fileloc := filepath.Join(dest, path.Base(u.Path))
+		if placeholder.MatchString(dest) {
+			values := e.values
+			fileloc = placeholder.ReplaceAllStringFunc(dest, func(ref string) string {
+				n, _ := strconv.Atoi(ref[1:])
+				if n < 1 || n > len(values) {
+					return ref
+				}
+				return values[n-1]
+			})
+		}
+
+		jobs[i] = Job{RequestSpec: *newSpec(u, headers, cookies), Dest: fileloc}
+	}
+
+	return d.DownloadAll(jobs, opts)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandURL(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		want    []string
+	}{
+		{"h/f[1-3]", []string{"h/f1", "h/f2", "h/f3"}},
+		{"h/f[001-003]", []string{"h/f001", "h/f002", "h/f003"}},
+		{"h/f[08-10]", []string{"h/f08", "h/f09", "h/f10"}},
+		{"h/f[0-20:10]", []string{"h/f0", "h/f10", "h/f20"}},
+		{"h/f[0-25:10]", []string{"h/f0", "h/f10", "h/f20"}},
+		{"h/[a-c]", []string{"h/a", "h/b", "h/c"}},
+		{"h/[A-E:2]", []string{"h/A", "h/C", "h/E"}},
+		{"h/{alpha,beta}", []string{"h/alpha", "h/beta"}},
+		{"h/{a,}x", []string{"h/ax", "h/x"}},
+		{"h/{a,b}/[1-2]", []string{"h/a/1", "h/a/2", "h/b/1", "h/b/2"}},
+		{`h/\[1-2\]\{a\}`, []string{"h/[1-2]{a}"}},
+		{`h/a\\b`, []string{`h/a\b`}},
+		{`h/end\`, []string{`h/end\`}},
+		{"h/plain", []string{"h/plain"}},
+	} {
+		urls, err := ExpandURL(tc.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", tc.pattern, err)
+			continue
+		}
+		var got []string
+		for _, u := range urls {
+			got = append(got, u.Path)
+		}
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("%s: got %q, want %q", tc.pattern, got, tc.want)
+		}
+	}
+}
+
+func TestExpandURLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		pos     int
+		msg     string
+	}{
+		{"h/[1-3", 2, "unclosed"},
+		{"h/{a,b", 2, "unclosed"},
+		{"h/[1-3}", 2, "unclosed"},
+		{"h/x]", 3, "unexpected"},
+		{"h/[1-{a}]", 5, "nested"},
+		{"h/[3-1]", 2, "bad numeric range"},
+		{"h/[1-x]", 2, "bad numeric range"},
+		{"h/[1]", 2, "bad range"},
+		{"h/[1-3:0]", 2, "bad step"},
+		{"h/[a-Z]", 2, "bad letter range"},
+		{"h/[1-1000000]", 2, "too large"},
+		{"h/[1-1000]/[1-1000]", 11, "more than 100000 URLs"},
+	} {
+		_, err := ExpandURL(tc.pattern)
+		var pe *PatternError
+		if !errors.As(err, &pe) || pe.Pos != tc.pos || pe.Pattern != tc.pattern || !strings.Contains(pe.Msg, tc.msg) {
+			t.Errorf("%s: got %v, want %q at %d", tc.pattern, err, tc.msg, tc.pos)
+		}
+	}
+
+	// Right at the limit is fine
+	if urls, err := ExpandURL("h/[1-1000]/[1-100]"); err != nil || len(urls) != MaxPatternExpansion {
+		t.Errorf("got %d URLs, %v", len(urls), err)
+	}
+}
+
+func TestDownloadPattern(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	d := New(WithLogger(quietLogger()))
+	dir := t.TempDir()
+
+	// #N is the value of the Nth glob, and ones without a glob are left alone
+	if _, err := d.DownloadPattern(srv.URL+"/{a,b}/f[1-2].txt", filepath.Join(dir, "#2-#1#3.txt"), nil, nil, BatchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"1-a#3.txt": "/a/f1.txt",
+		"2-a#3.txt": "/a/f2.txt",
+		"1-b#3.txt": "/b/f1.txt",
+		"2-b#3.txt": "/b/f2.txt",
+	} {
+		if got, _ := ioutil.ReadFile(filepath.Join(dir, name)); string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+
+	// Without any, dest is the directory to save the files in
+	out := filepath.Join(dir, "out")
+	if _, err := d.DownloadPattern(srv.URL+"/x/[8-10]", out, nil, nil, BatchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"8", "9", "10"} {
+		if got, _ := ioutil.ReadFile(filepath.Join(out, name)); string(got) != "/x/"+name {
+			t.Errorf("%s: got %q", name, got)
+		}
+	}
+
+	if _, err := d.DownloadPattern(srv.URL+"/[1-", out, nil, nil, BatchOptions{}); err == nil {
+		t.Error("downloaded a bad pattern")
+	}
+}
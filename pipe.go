@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Pipe will copy the body of the url to dst using a buffer of bufSize bytes
+func Pipe(u *url.URL, dst io.Writer, bufSize int, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	return std.Pipe(u, dst, bufSize, headers, cookies)
+}
+
+// Pipe will copy the body of the url to dst using a buffer of bufSize bytes,
+// a bufSize of zero or less uses the same 32KiB buffer io.Copy does
+func (d *Downloader) Pipe(u *url.URL, dst io.Writer, bufSize int, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	req, err := d.newRequest(newSpec(u, headers, cookies))
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkStatus(resp); err != nil {
+		return 0, err
+	}
+	if err := d.validate(resp); err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+
+	return copyBuffer(dst, d.limitReader(req.Context(), resp.Body), make([]byte, bufSize))
+}
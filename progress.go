@@ -0,0 +1,298 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"io"
+	"math"
+	"net/url"
+	"time"
+)
+
+const (
+	// progressInterval is how often progress is reported during a transfer
+	progressInterval = 500 * time.Millisecond
+	// defaultSpeedWindow is how far back transfer speed is measured
+	defaultSpeedWindow = 10 * time.Second
+	// rateHalfLife is how quickly older reads fade out of the current speed
+	rateHalfLife = 2 * time.Second
+)
+
+// ErrTooSlow is returned when a transfer falls below the minimum speed
+var ErrTooSlow = errors.New("dl: transfer too slow")
+
+// Progress describes how far along a download is
+type Progress struct {
+	URL  *url.URL
+	Path string
+	// Written is how much of the file has been downloaded, including anything
+	// resumed from an earlier attempt
+	Written int64
+	// Total is the size of the file, -1 if it isn't known
+	Total int64
+	// Speed is the average transfer speed in bytes per second over the speed
+	// window
+	Speed float64
+	// CurrentSpeed is the recent transfer speed in bytes per second, weighted
+	// towards the last few seconds
+	CurrentSpeed float64
+	// AverageSpeed is the transfer speed in bytes per second since the
+	// attempt started, not counting anything resumed from an earlier attempt
+	AverageSpeed float64
+	// ETA is how long the rest of the file should take at the current speed,
+	// -1 if that isn't known
+	ETA time.Duration
+	// Done is set on the last report of an attempt
+	Done bool
+	// Err is why the attempt ended early, nil if the whole body was read
+	Err error
+	// Meta is the RequestSpec's Meta
+	Meta interface{}
+	// Finished is set on one more report made once the download is over,
+	// however it ended, even if it never got as far as a response body:
+	// Outcome says what it did and Err is the error it failed with. Done is
+	// set on it too.
+	Finished bool
+	Outcome  Outcome
+}
+
+// SetProgress sets a function the dl package calls with the progress of every
+// download, nil disables it
+func SetProgress(fn func(Progress)) {
+	WithProgress(fn)(std)
+}
+
+// WithProgress sets a function that is called with the progress of every
+// download, about twice a second and once more when an attempt ends, then
+// with a Finished report once the download is over. It is called from the
+// downloading goroutine, so it should return quickly.
+func WithProgress(fn func(Progress)) Option {
+	return func(d *Downloader) {
+		d.progress = fn
+	}
+}
+
+// SetMinSpeed aborts downloads in the dl package that fall below a minimum
+// speed, see WithMinSpeed
+func SetMinSpeed(bytesPerSec int64, window, grace time.Duration) {
+	WithMinSpeed(bytesPerSec, window, grace)(std)
+}
+
+// WithMinSpeed aborts downloads with ErrTooSlow when their average speed over
+// window falls below bytesPerSec, which makes them eligible for a retry.
+// Nothing is checked for the first grace of a transfer. A zero window
+// measures over 10 seconds, and zero bytesPerSec disables the check.
+func WithMinSpeed(bytesPerSec int64, window, grace time.Duration) Option {
+	return func(d *Downloader) {
+		if window <= 0 {
+			window = defaultSpeedWindow
+		}
+		d.minSpeed = bytesPerSec
+		d.speedWindow = window
+		d.speedGrace = grace
+	}
+}
+
+// sample is the number of bytes transferred by a point in time
+type sample struct {
+	at time.Time
+	n  int64
+}
+
+// meter measures the speed of a transfer as it is read, reporting progress
+// and enforcing the minimum speed
+type meter struct {
+	d       *Downloader
+	r       io.Reader
+	t       *transfer
+	total   int64
+	window  time.Duration
+	start   time.Time
+	read    int64
+	samples []sample
+	// rate is the exponentially weighted current speed, and weight how much
+	// of it comes from actual reads rather than its starting value of zero
+	rate   float64
+	weight float64
+	// reported is when progress was last reported
+	reported time.Time
+}
+
+// newMeter wraps the body of an attempt at t, length is the length of the
+// body or -1
+func (d *Downloader) newMeter(r io.Reader, t *transfer, length int64) io.Reader {
+	m := d.meterFor(t, length)
+	if m == nil {
+		return r
+	}
+	m.r = r
+	return m
+}
+
+// meterFor returns a meter for an attempt at t that hasn't been given a
+// reader, or nil if nothing needs one
+func (d *Downloader) meterFor(t *transfer, length int64) *meter {
+	if d.progress == nil && t.progress == nil && d.minSpeed <= 0 {
+		return nil
+	}
+
+	window := d.speedWindow
+	if window <= 0 {
+		window = defaultSpeedWindow
+	}
+
+	total := int64(-1)
+	if length >= 0 {
+		total = t.offset + length
+	}
+
+	now := d.clock.Now()
+	return &meter{
+		d:        d,
+		t:        t,
+		total:    total,
+		window:   window,
+		start:    now,
+		samples:  []sample{{now, 0}},
+		reported: now,
+	}
+}
+
+func (m *meter) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	return n, m.count(n, err)
+}
+
+// count records a read of n bytes that ended with err, returning err or
+// ErrTooSlow if the transfer has become too slow
+func (m *meter) count(n int, err error) error {
+	m.read += int64(n)
+
+	now := m.d.clock.Now()
+	if dt := now.Sub(m.samples[len(m.samples)-1].at); dt > 0 {
+		w := 1 - math.Exp2(-float64(dt)/float64(rateHalfLife))
+		m.rate += w * (float64(n)/dt.Seconds() - m.rate)
+		m.weight += w * (1 - m.weight)
+	}
+	m.samples = append(m.samples, sample{now, m.read})
+	// Keep the newest sample that is at least a window old as the baseline
+	for len(m.samples) > 2 && now.Sub(m.samples[1].at) >= m.window {
+		m.samples = m.samples[1:]
+	}
+
+	if err == nil && m.d.minSpeed > 0 && now.Sub(m.start) >= m.d.speedGrace && now.Sub(m.samples[0].at) >= m.window {
+		if speed := m.speed(now); speed < float64(m.d.minSpeed) {
+			err = fmt.Errorf("%w: %s/s, below %s/s", ErrTooSlow, humanize.Bytes(uint64(speed)), humanize.Bytes(uint64(m.d.minSpeed)))
+		}
+	}
+
+	if (m.d.progress != nil || m.t.progress != nil) && (err != nil || now.Sub(m.reported) >= progressInterval) {
+		m.reported = now
+		m.report(now, err)
+	}
+	return err
+}
+
+// speed returns the average speed over the samples in bytes per second
+func (m *meter) speed(now time.Time) float64 {
+	first := m.samples[0]
+	elapsed := now.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(m.read-first.n) / elapsed
+}
+
+// report reports the progress so far, err is the error the read ended with
+// once the attempt is done
+func (m *meter) report(now time.Time, err error) {
+	p := Progress{
+		URL:          m.t.spec.URL,
+		Path:         m.t.fileloc,
+		Written:      m.t.offset + m.read,
+		Total:        m.total,
+		Speed:        m.speed(now),
+		CurrentSpeed: m.currentSpeed(),
+		ETA:          -1,
+		Done:         err != nil,
+		Meta:         m.t.spec.Meta,
+	}
+	if err != io.EOF {
+		p.Err = err
+	}
+	if elapsed := now.Sub(m.start).Seconds(); elapsed > 0 {
+		p.AverageSpeed = float64(m.read) / elapsed
+	}
+	if m.total >= 0 && p.CurrentSpeed > 0 {
+		p.ETA = time.Duration(float64(m.total-p.Written) / p.CurrentSpeed * float64(time.Second))
+	}
+	if m.d.progress != nil {
+		m.d.progress(p)
+	}
+	if m.t.progress != nil {
+		m.t.progress(p)
+	}
+}
+
+// reportFinished reports that the download of t is over, with the result and
+// error it ended with
+func (d *Downloader) reportFinished(t *transfer, res DownloadResult, err error) {
+	if d.progress == nil && t.progress == nil {
+		return
+	}
+
+	p := Progress{
+		URL:      t.spec.URL,
+		Path:     t.fileloc,
+		Written:  res.Written,
+		Total:    res.Size,
+		ETA:      -1,
+		Done:     true,
+		Err:      err,
+		Meta:     t.spec.Meta,
+		Finished: true,
+		Outcome:  res.Outcome,
+	}
+	if err != nil {
+		p.Total = -1
+	}
+	if secs := res.Duration.Seconds(); secs > 0 {
+		p.AverageSpeed = float64(res.Written) / secs
+	}
+	if d.progress != nil {
+		d.progress(p)
+	}
+	if t.progress != nil {
+		t.progress(p)
+	}
+}
+
+// currentSpeed returns the weighted recent speed, corrected for how little
+// history there is early in a transfer
+func (m *meter) currentSpeed() float64 {
+	if m.weight == 0 {
+		return 0
+	}
+	return m.rate / m.weight
+}
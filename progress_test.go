@@ -0,0 +1,101 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tickingClock is a clock that moves on by step every time it is read, so
+// every read of a body seems to take step
+type tickingClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func (c *tickingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func (c *tickingClock) Sleep(ctx context.Context, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestMinSpeed(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Length", "2000")
+		for i := 0; i < 20; i++ {
+			w.Write(make([]byte, 100))
+			w.(http.Flusher).Flush()
+			time.Sleep(2 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/f")
+	dir := t.TempDir()
+
+	// Every read takes a second on the Downloader's clock, so about 100B/s
+	for _, tc := range []struct {
+		name     string
+		minSpeed int64
+		grace    time.Duration
+		slow     bool
+	}{
+		{"too slow", 1000, 3 * time.Second, true},
+		{"fast enough", 50, 3 * time.Second, false},
+		{"in the grace period", 1000, time.Hour, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&hits, 0)
+			d := New(WithLogger(quietLogger()), WithMinSpeed(tc.minSpeed, 2*time.Second, tc.grace))
+			d.clock = &tickingClock{now: time.Unix(0, 0), step: time.Second}
+
+			_, err := d.DownloadFileRetry(filepath.Join(dir, tc.name), u, nil, nil, 3)
+			if tc.slow {
+				// It's retried, and every attempt is too slow
+				if !errors.Is(err, ErrTooSlow) || atomic.LoadInt32(&hits) != 3 {
+					t.Fatalf("got %v after %d attempts, want ErrTooSlow after 3", err, hits)
+				}
+				return
+			}
+			if err != nil || atomic.LoadInt32(&hits) != 1 {
+				t.Fatalf("got %v after %d attempts", err, hits)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SupportsRanges reports whether the server allows byte ranges of the url, see Downloader.SupportsRanges
+func SupportsRanges(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (bool, error) {
+	return std.SupportsRanges(u, headers, cookies)
+}
+
+// SupportsRanges reports whether the server allows byte ranges of the url,
+// which downloads need to resume. It asks with a HEAD request, and if the
+// answer doesn't say either way, requests the first byte of the url.
+func (d *Downloader) SupportsRanges(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (bool, error) {
+	spec := newSpec(u, headers, cookies)
+	spec.Method = "HEAD"
+	req, err := d.newRequest(spec)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	// Some servers don't allow HEAD, the range request is still worth a try
+	if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+		if err := checkStatus(resp); err != nil {
+			return false, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Accept-Ranges"))) {
+		case "bytes":
+			return true, nil
+		case "none":
+			return false, nil
+		}
+	}
+
+	if req, err = d.newRequest(newSpec(u, headers, cookies)); err != nil {
+		return false, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	if resp, err = d.do(req); err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return false, err
+	}
+	return resp.StatusCode == http.StatusPartialContent, nil
+}
+
+// GetRanges will return the requested byte ranges of the url, see Downloader.GetRanges
+func GetRanges(u *url.URL, ranges [][2]int64, headers map[string]string, cookies *[]*http.Cookie) ([][]byte, error) {
+	return std.GetRanges(u, ranges, headers, cookies)
+}
+
+// GetRanges will return the bytes of each of the ranges of the url, which
+// are the first and last byte like in a Range header. They are asked for in
+// a single request, which the server can answer with a multipart/byteranges
+// response. Any it doesn't answer that way, because it sent the whole file
+// or only one range, are asked for one at a time.
+func (d *Downloader) GetRanges(u *url.URL, ranges [][2]int64, headers map[string]string, cookies *[]*http.Cookie) ([][]byte, error) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+
+	specs := make([]string, len(ranges))
+	for i, r := range ranges {
+		if r[0] < 0 || r[1] < r[0] {
+			return nil, fmt.Errorf("dl: invalid range %d-%d", r[0], r[1])
+		}
+		specs[i] = fmt.Sprintf("%d-%d", r[0], r[1])
+	}
+
+	req, err := d.newRequest(newSpec(u, headers, cookies))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+strings.Join(specs, ","))
+
+	resp, err := d.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var parts []byteRange
+	if resp.StatusCode == http.StatusPartialContent {
+		if parts, err = readByteRanges(resp); err != nil {
+			return nil, fmt.Errorf("dl: reading ranges of %s: %w", u.Redacted(), err)
+		}
+	}
+	resp.Body.Close()
+
+	out := make([][]byte, len(ranges))
+	for i, r := range ranges {
+		for _, part := range parts {
+			if b, ok := part.slice(r); ok {
+				out[i] = b
+				break
+			}
+		}
+		if out[i] != nil {
+			continue
+		}
+
+		d.log.Debugf("Requesting bytes %d-%d of %s on their own\n", r[0], r[1], u.Redacted())
+		if out[i], err = d.getRange(u, r, headers, cookies); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// getRange returns the bytes of a single range of the url
+func (d *Downloader) getRange(u *url.URL, r [2]int64, headers map[string]string, cookies *[]*http.Cookie) ([]byte, error) {
+	req, err := d.newRequest(newSpec(u, headers, cookies))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r[0], r[1]))
+
+	resp, err := d.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("dl: %s ignored Range", u.Redacted())
+	}
+
+	parts, err := readByteRanges(resp)
+	if err != nil {
+		return nil, fmt.Errorf("dl: reading range of %s: %w", u.Redacted(), err)
+	}
+	for _, part := range parts {
+		if b, ok := part.slice(r); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("dl: %s didn't send bytes %d-%d", u.Redacted(), r[0], r[1])
+}
+
+// byteRange is a range of bytes a server sent, starting at start
+type byteRange struct {
+	start int64
+	data  []byte
+}
+
+// slice returns the bytes of the range r, if they are all in b. A range
+// that runs past the end of the file is cut short like a server would.
+func (b byteRange) slice(r [2]int64) ([]byte, bool) {
+	end := b.start + int64(len(b.data))
+	if r[0] < b.start || r[0] >= end {
+		return nil, false
+	}
+	if r[1] >= end {
+		return b.data[r[0]-b.start:], true
+	}
+	return b.data[r[0]-b.start : r[1]-b.start+1], true
+}
+
+// readByteRanges reads the ranges in a 206 response, which is either a single
+// range or a multipart/byteranges body of them
+func readByteRanges(resp *http.Response) ([]byteRange, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		part, err := readByteRange(resp.Header.Get("Content-Range"), resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return []byteRange{part}, nil
+	}
+
+	var parts []byteRange
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		part, err := readByteRange(p.Header.Get("Content-Range"), p)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+}
+
+// readByteRange reads the bytes of the Content-Range from r
+func readByteRange(contentRange string, r io.Reader) (byteRange, error) {
+	var start, end int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/", &start, &end); err != nil {
+		return byteRange{}, fmt.Errorf("bad Content-Range %q", contentRange)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, end-start+1))
+	if err != nil {
+		return byteRange{}, err
+	}
+	if int64(len(data)) != end-start+1 {
+		return byteRange{}, fmt.Errorf("got %d bytes of %s", len(data), contentRange)
+	}
+	return byteRange{start: start, data: data}, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSupportsRanges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ranges":
+			http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(rangeBody))
+		case "/none":
+			w.Header().Set("Accept-Ranges", "none")
+			w.Write([]byte(rangeBody))
+		case "/nohead":
+			// Doesn't allow HEAD, but serves ranges
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(rangeBody))
+		default:
+			w.Write([]byte(rangeBody))
+		}
+	}))
+	defer srv.Close()
+
+	for path, want := range map[string]bool{
+		"/ranges": true,
+		"/none":   false,
+		"/nohead": true,
+		"/plain":  false,
+	} {
+		u, _ := url.Parse(srv.URL + path)
+		ok, err := New().SupportsRanges(u, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if ok != want {
+			t.Errorf("%s: got %v, want %v", path, ok, want)
+		}
+	}
+}
+
+func TestGetRanges(t *testing.T) {
+	body := strings.Repeat(rangeBody, 50)
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rg := r.Header.Get("Range")
+		switch {
+		case r.URL.Path == "/whole" && strings.Contains(rg, ","):
+			w.Write([]byte(body))
+			return
+		case r.URL.Path == "/single" && strings.Contains(rg, ","):
+			r.Header.Set("Range", rg[:strings.Index(rg, ",")])
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(body))
+	}))
+	defer srv.Close()
+
+	ranges := [][2]int64{{5, 9}, {100, 102}, {995, 2000}}
+	tests := []struct {
+		path     string
+		requests int32
+	}{
+		{"/multipart", 1},
+		{"/single", 3},
+		{"/whole", 4},
+	}
+	for _, tt := range tests {
+		atomic.StoreInt32(&requests, 0)
+		u, _ := url.Parse(srv.URL + tt.path)
+		got, err := New().GetRanges(u, ranges, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if len(got) != 3 || string(got[0]) != "56789" || string(got[1]) != "012" || string(got[2]) != "fghij" {
+			t.Errorf("%s: got %q", tt.path, got)
+		}
+		if n := atomic.LoadInt32(&requests); n != tt.requests {
+			t.Errorf("%s: %d requests, want %d", tt.path, n, tt.requests)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// WithAutoReferer sends a Referer with every request the way a browser would:
+// the request's own Referer, or else the page registered for its host with
+// SetRefererPage, and the previous URL for each redirect
+func WithAutoReferer() Option {
+	return func(d *Downloader) {
+		d.autoReferer = true
+	}
+}
+
+// SetReferer sets the Referer the dl package sends with every request, see WithReferer
+func SetReferer(ref string) {
+	WithReferer(ref)(std)
+}
+
+// WithReferer sends ref as the Referer of every request that doesn't have
+// its own, either as RequestSpec.Referer, a Referer header passed to the
+// call, or one from auto referers. It is the default Referer header, so
+// SetDefaultHeader("Referer", ref) does the same. It is stripped from
+// requests to http URLs if it is an https page, like other Referers. An
+// empty ref removes it.
+func WithReferer(ref string) Option {
+	return func(d *Downloader) {
+		d.SetDefaultHeader("Referer", ref)
+	}
+}
+
+// WithInsecureReferer allows a Referer from an https page to be sent to an
+// http URL, which is otherwise stripped like browsers do
+func WithInsecureReferer() Option {
+	return func(d *Downloader) {
+		d.insecureReferer = true
+	}
+}
+
+// SetRefererPage registers the page used as the Referer for requests to host
+// when auto referers are enabled
+func (d *Downloader) SetRefererPage(host, page string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.refererPages == nil {
+		d.refererPages = make(map[string]string)
+	}
+	d.refererPages[host] = page
+}
+
+// setReferer sets the Referer for the first request of spec
+func (d *Downloader) setReferer(req *http.Request, spec *RequestSpec) {
+	ref := spec.Referer
+	if ref == "" && d.autoReferer {
+		d.mu.RLock()
+		ref = d.refererPages[req.URL.Host]
+		d.mu.RUnlock()
+	}
+	if ref == "" {
+		d.mu.RLock()
+		ref = d.defaultHeaders["Referer"]
+		d.mu.RUnlock()
+	}
+	if ref == "" {
+		return
+	}
+
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		d.log.Warnf("Not sending invalid Referer %q: %v\n", ref, err)
+		return
+	}
+	if ref = d.referer(refURL, req.URL); ref != "" {
+		req.Header.Set("Referer", ref)
+	}
+}
+
+// redirectReferer sets the Referer of a redirect to the URL that redirected it
+func (d *Downloader) redirectReferer(req *http.Request, via []*http.Request) error {
+	if !d.autoReferer {
+		return nil
+	}
+
+	if ref := d.referer(via[len(via)-1].URL, req.URL); ref != "" {
+		req.Header.Set("Referer", ref)
+	} else {
+		req.Header.Del("Referer")
+	}
+	return nil
+}
+
+// referer returns the Referer to send to target when coming from ref
+func (d *Downloader) referer(ref, target *url.URL) string {
+	if ref.Scheme == "https" && target.Scheme == "http" && !d.insecureReferer {
+		return ""
+	}
+
+	r := *ref
+	r.User = nil
+	r.Fragment = ""
+	return r.String()
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestReferer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Referer() + "|" + r.Header.Get("Accept-Language")))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+	d := New(WithReferer("http://example.com/page"), WithAcceptLanguage("en-US,en;q=0.9"))
+
+	tests := []struct {
+		name    string
+		spec    *RequestSpec
+		headers map[string]string
+		want    string
+	}{
+		{"default", &RequestSpec{}, nil, "http://example.com/page|en-US,en;q=0.9"},
+		{"spec", &RequestSpec{Referer: "http://example.com/other"}, nil, "http://example.com/other|en-US,en;q=0.9"},
+		{"header", &RequestSpec{}, map[string]string{"Referer": "http://example.com/header", "Accept-Language": "de"}, "http://example.com/header|de"},
+	}
+	for _, tt := range tests {
+		spec := tt.spec
+		spec.URL = u
+		spec.Headers = tt.headers
+		dest := filepath.Join(t.TempDir(), tt.name)
+		if _, err := d.Download(dest, spec); err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadFile(dest)
+		if string(body) != tt.want {
+			t.Errorf("%s: server saw %q, want %q", tt.name, body, tt.want)
+		}
+	}
+}
+
+func TestAutoReferer(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Referer())
+		if r.URL.Path == "/a" {
+			http.Redirect(w, r, "/b", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+	d := New(WithAutoReferer())
+	d.SetRefererPage(srv.Listener.Addr().String(), "http://page/")
+
+	u, _ := url.Parse(srv.URL + "/a")
+	if _, err := d.GetBodyFromURL(u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "http://page/" || got[1] != srv.URL+"/a" {
+		t.Fatalf("server saw referers %q", got)
+	}
+}
+
+func TestDefaultRefererDowngrade(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Referer()))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+
+	for _, tc := range []struct {
+		name string
+		d    *Downloader
+		want string
+	}{
+		{"http", New(WithReferer("http://example.com/page")), "http://example.com/page"},
+		{"https to http", New(WithReferer("https://example.com/page")), ""},
+		{"default header", New(WithDefaultHeaders(map[string]string{"Referer": "https://example.com/page"})), ""},
+		{"allowed", New(WithReferer("https://example.com/page"), WithInsecureReferer()), "https://example.com/page"},
+		{"removed", New(WithReferer("http://example.com/page"), WithReferer("")), ""},
+	} {
+		body, err := tc.d.GetBodyFromURL(u, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != tc.want {
+			t.Errorf("%s: server saw %q, want %q", tc.name, body, tc.want)
+		}
+	}
+
+	// Auto referers take the place of the default
+	d := New(WithAutoReferer())
+	d.SetDefaultHeader("Referer", "http://example.com/default")
+	d.SetRefererPage(u.Host, "http://example.com/registered")
+	if body, _ := d.GetBodyFromURL(u, nil, nil); string(body) != "http://example.com/registered" {
+		t.Errorf("server saw %q", body)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressEvent is a line written by a JSON lines reporter
+type progressEvent struct {
+	// Type is "progress", "completed" or "failed"
+	Type string `json:"type"`
+	// Outcome is what a completed download did, such as "downloaded"
+	Outcome string    `json:"outcome,omitempty"`
+	URL     string    `json:"url"`
+	Dest    string    `json:"dest"`
+	Written int64     `json:"written"`
+	Total   int64     `json:"total"`
+	Speed   float64   `json:"speed"`
+	ETA     float64   `json:"eta,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Started time.Time `json:"started"`
+	Time    time.Time `json:"time"`
+	// Meta is the download's Meta, it must be something encoding/json can
+	// encode to be useful
+	Meta interface{} `json:"meta,omitempty"`
+}
+
+// NewJSONLinesReporter returns a progress function for WithProgress that
+// writes every event to w as a line of JSON like
+//
+//	{"type":"progress","url":"https://example.com/f.iso","dest":"f.iso","written":1048576,"total":4194304,"speed":524288,"eta":6,"started":"...","time":"..."}
+//
+// The type is "progress" while a download is going, then "completed" or
+// "failed" once it is over, with the reason a download or one of its
+// attempts failed in "error". Every download ends with one of those, even
+// one that was skipped or failed before it got a response, and a completed
+// one says what it did in "outcome", like "downloaded" or "skipped, same
+// size". Speed is in bytes per second, eta in seconds, and total is -1 if
+// it isn't known. The download's Meta, if it has one, is included as
+// "meta". Progress events for a download are written at most once every
+// interval, but the last event of an attempt and the final event are
+// always written.
+func NewJSONLinesReporter(w io.Writer, interval time.Duration) func(Progress) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	started := make(map[string]time.Time)
+	last := make(map[string]time.Time)
+
+	return func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := time.Now()
+		if _, ok := started[p.Path]; !ok {
+			started[p.Path] = now
+		}
+		if !p.Done && now.Sub(last[p.Path]) < interval {
+			return
+		}
+		last[p.Path] = now
+
+		ev := progressEvent{
+			Type:    "progress",
+			URL:     p.URL.Redacted(),
+			Dest:    p.Path,
+			Written: p.Written,
+			Total:   p.Total,
+			Speed:   p.CurrentSpeed,
+			Started: started[p.Path],
+			Time:    now,
+			Meta:    p.Meta,
+		}
+		if p.ETA >= 0 {
+			ev.ETA = p.ETA.Seconds()
+		}
+		if p.Err != nil {
+			ev.Error = p.Err.Error()
+		}
+		if p.Finished {
+			ev.Type = "completed"
+			ev.Outcome = p.Outcome.String()
+			ev.Speed = p.AverageSpeed
+			if p.Err != nil {
+				ev.Type = "failed"
+				ev.Outcome = ""
+			}
+			delete(started, p.Path)
+			delete(last, p.Path)
+		}
+		enc.Encode(ev)
+	}
+}
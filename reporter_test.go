@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// reportedEvents downloads u to fileloc with a JSON lines reporter and
+// returns the events it wrote
+func reportedEvents(t *testing.T, fileloc string, u *url.URL) ([]progressEvent, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	d := New(WithLogger(quietLogger()), WithProgress(NewJSONLinesReporter(&buf, time.Hour)))
+	_, err := d.Download(fileloc, &RequestSpec{URL: u, Meta: "m"})
+
+	var events []progressEvent
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var ev progressEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) == 0 {
+		t.Fatal("no events were written")
+	}
+	for _, ev := range events[:len(events)-1] {
+		if ev.Type != "progress" {
+			t.Errorf("got a %q event before the last one: %+v", ev.Type, ev)
+		}
+	}
+	return events, err
+}
+
+func TestJSONLinesReporter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+	missing, _ := url.Parse(srv.URL + "/missing")
+	dir := t.TempDir()
+
+	dest := filepath.Join(dir, "file")
+	events, err := reportedEvents(t, dest, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := events[len(events)-1]
+	if last.Type != "completed" || last.Outcome != "downloaded" || last.Written != 6 || last.Total != 6 || last.Error != "" || last.Meta != "m" || last.Dest != dest {
+		t.Errorf("downloaded: last event %+v", last)
+	}
+
+	// A file of the same size is skipped without reading a body
+	same := filepath.Join(dir, "same")
+	ioutil.WriteFile(same, []byte("HELLO\n"), 0644)
+	events, err = reportedEvents(t, same, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := events[len(events)-1]; len(events) != 1 || last.Type != "completed" || last.Outcome != "skipped, same size" || last.Total != 6 {
+		t.Errorf("skipped: events %+v", events)
+	}
+
+	// A 404 fails before there is a body
+	events, err = reportedEvents(t, filepath.Join(dir, "missing"), missing)
+	if err == nil {
+		t.Fatal("downloaded a 404")
+	}
+	if last := events[len(events)-1]; len(events) != 1 || last.Type != "failed" || last.Error != err.Error() || last.Outcome != "" {
+		t.Errorf("failed: events %+v", events)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// RequestSpec describes the request to make for a download
+type RequestSpec struct {
+	// Method defaults to GET
+	Method string
+	URL    *url.URL
+	// Body is sent as the request body, it is read into memory if it can't
+	// be rewound so the request can be repeated
+	Body        io.Reader
+	ContentType string
+	Headers     map[string]string
+	Cookies     []*http.Cookie
+	// Referer is sent as the Referer header unless the headers set one
+	Referer string
+	// UserAgent is sent in place of the Downloader's user agent unless the
+	// headers set a User-Agent
+	UserAgent string
+
+	// RefreshURL, if set, is called for a new URL when a download fails with a
+	// status RefreshOn accepts, after which the download is tried once more
+	// with the new URL. This is meant for signed URLs that can expire.
+	RefreshURL func(ctx context.Context, old *url.URL) (*url.URL, error)
+	// RefreshOn decides which statuses call RefreshURL, by default only 403
+	RefreshOn func(status int) bool
+
+	// ExpectedSize, if set, is the exact size the downloaded file must be. A
+	// Content-Length that disagrees fails the download before anything is
+	// transferred, and so does writing a different number of bytes.
+	ExpectedSize int64
+	// MinSize, if set, fails a download that is smaller than it with
+	// ErrSuspiciouslySmall, for servers that answer with a short error
+	// message instead of an error status
+	MinSize int64
+
+	// Meta is anything the caller wants to tie to the download. It is never
+	// looked at, only passed along in the download's Progress, its
+	// DownloadResult, its SpanInfo and the context of its requests, see
+	// MetaFromContext.
+	Meta interface{}
+
+	buf []byte
+}
+
+// newSpec builds a GET RequestSpec from the arguments the package functions take
+func newSpec(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) *RequestSpec {
+	spec := &RequestSpec{
+		URL:     u,
+		Headers: headers,
+	}
+	if cookies != nil {
+		spec.Cookies = *cookies
+	}
+	return spec
+}
+
+func (s *RequestSpec) method() string {
+	if s.Method == "" {
+		return "GET"
+	}
+	return s.Method
+}
+
+// newBody returns a reader for the start of the body
+func (s *RequestSpec) newBody() (io.Reader, error) {
+	if s.Body == nil {
+		return nil, nil
+	}
+
+	if s.buf == nil {
+		if seeker, ok := s.Body.(io.Seeker); ok {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			return s.Body, nil
+		}
+
+		buf, err := ioutil.ReadAll(s.Body)
+		if err != nil {
+			return nil, err
+		}
+		s.buf = buf
+	}
+	return bytes.NewReader(s.buf), nil
+}
+
+// newRequest builds the request described by spec with the Downloader's user agent
+func (d *Downloader) newRequest(spec *RequestSpec) (*http.Request, error) {
+	body, err := spec.newBody()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(spec.method(), spec.URL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := spec.newBody()
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(body), nil
+		}
+	}
+
+	ua := d.nextUserAgent()
+	if spec.UserAgent != "" {
+		ua = spec.UserAgent
+	}
+	req.Header.Set("User-Agent", ua)
+	d.setReferer(req, spec)
+	if spec.ContentType != "" {
+		req.Header.Set("Content-Type", spec.ContentType)
+	}
+	addCookies(req, spec.Cookies)
+	d.setHeaders(req, spec.Headers)
+	d.setNetrcAuth(req)
+
+	return req, nil
+}
+
+// refresh returns a copy of s with a new URL from RefreshURL if err is a
+// status that calls for one
+func (s *RequestSpec) refresh(ctx context.Context, err error) (*RequestSpec, error) {
+	var he *HTTPError
+	if s.RefreshURL == nil || !errors.As(err, &he) {
+		return nil, nil
+	}
+
+	refreshOn := s.RefreshOn
+	if refreshOn == nil {
+		refreshOn = func(status int) bool { return status == http.StatusForbidden }
+	}
+	if !refreshOn(he.StatusCode) {
+		return nil, nil
+	}
+
+	u, err := s.RefreshURL(ctx, s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("dl: refreshing %s: %w", s.URL.Redacted(), err)
+	}
+
+	refreshed := *s
+	refreshed.URL = u
+	return &refreshed, nil
+}
+
+// metaKey is the context key for a RequestSpec's Meta
+type metaKey struct{}
+
+// MetaFromContext returns the Meta of the download a request was made for,
+// for request and response hooks to use with req.Context() and
+// resp.Request.Context()
+func MetaFromContext(ctx context.Context) interface{} {
+	return ctx.Value(metaKey{})
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newEchoUAServer answers every request with the User-Agent it was sent
+func newEchoUAServer(t *testing.T) *url.URL {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.UserAgent()))
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return u
+}
+
+func TestPerCallUserAgent(t *testing.T) {
+	u := newEchoUAServer(t)
+	d := New(WithUserAgent("global/1.0"))
+
+	dest := filepath.Join(t.TempDir(), "ua")
+	if _, err := d.Download(dest, &RequestSpec{URL: u, UserAgent: "call/2.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); string(got) != "call/2.0" {
+		t.Fatalf("server saw %q", got)
+	}
+
+	// A header wins over both
+	body, err := d.GetBodyFromURL(u, map[string]string{"User-Agent": "header/3.0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "header/3.0" {
+		t.Fatalf("server saw %q", body)
+	}
+
+	// And neither changed the Downloader's
+	if body, _ = d.GetBodyFromURL(u, nil, nil); string(body) != "global/1.0" {
+		t.Fatalf("server saw %q", body)
+	}
+}
+
+func TestRefreshURL(t *testing.T) {
+	// Signed URLs are only good for the current signature of their file
+	var mu sync.Mutex
+	var requests []string
+	signatures := map[string]string{"/a": "1", "/b": "2", "/c": "1"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.RequestURI())
+		sig, ok := signatures[r.URL.Path]
+		mu.Unlock()
+		if !ok {
+			http.Error(w, "gone", http.StatusGone)
+			return
+		}
+		if r.URL.Query().Get("sig") != sig {
+			http.Error(w, "expired", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	var refreshed []string
+	refresh := func(ctx context.Context, old *url.URL) (*url.URL, error) {
+		refreshed = append(refreshed, old.RequestURI())
+		mu.Lock()
+		sig := signatures[old.Path]
+		mu.Unlock()
+		u := *old
+		u.RawQuery = "sig=" + sig
+		return &u, nil
+	}
+	dir := t.TempDir()
+	var jobs []Job
+	for _, path := range []string{"/a", "/b", "/c"} {
+		u, _ := url.Parse(srv.URL + path + "?sig=1")
+		jobs = append(jobs, Job{RequestSpec: RequestSpec{URL: u, RefreshURL: refresh}, Dest: filepath.Join(dir, path[1:])})
+	}
+
+	// /b has expired, it is refreshed without using up its one attempt
+	report, err := New(WithLogger(quietLogger())).DownloadAll(jobs, BatchOptions{Concurrency: 1, Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if got, _ := ioutil.ReadFile(filepath.Join(dir, name)); string(got) != "/"+name {
+			t.Errorf("%s: got %q", name, got)
+		}
+	}
+	if want := "/a?sig=1 /b?sig=1 /b?sig=2 /c?sig=1"; strings.Join(requests, " ") != want {
+		t.Errorf("server got %q, want %s", requests, want)
+	}
+	if len(refreshed) != 1 || refreshed[0] != "/b?sig=1" || report.Failed != 0 {
+		t.Errorf("refreshed %q, %d failed", refreshed, report.Failed)
+	}
+
+	// A refreshed URL that still fails isn't refreshed again
+	refreshed = nil
+	u, _ := url.Parse(srv.URL + "/b?sig=1")
+	stale := func(ctx context.Context, old *url.URL) (*url.URL, error) {
+		refreshed = append(refreshed, old.RequestURI())
+		return old, nil
+	}
+	if _, err := New(WithLogger(quietLogger())).Download(filepath.Join(dir, "stale"), &RequestSpec{URL: u, RefreshURL: stale}); err == nil || len(refreshed) != 1 {
+		t.Errorf("got %v after %d refreshes", err, len(refreshed))
+	}
+
+	// Other statuses only refresh the URL if RefreshOn says so
+	u, _ = url.Parse(srv.URL + "/gone")
+	for _, tc := range []struct {
+		refreshOn func(int) bool
+		want      int
+	}{
+		{nil, 0},
+		{func(status int) bool { return status == http.StatusGone }, 1},
+	} {
+		refreshed = nil
+		spec := &RequestSpec{URL: u, RefreshURL: stale, RefreshOn: tc.refreshOn}
+		if _, err := New(WithLogger(quietLogger())).Download(filepath.Join(dir, "gone"), spec); err == nil || len(refreshed) != tc.want {
+			t.Errorf("got %v after %d refreshes, want %d", err, len(refreshed), tc.want)
+		}
+	}
+
+	// An error getting a new URL fails the download
+	errRefresh := errors.New("signing service down")
+	u, _ = url.Parse(srv.URL + "/b?sig=1")
+	spec := &RequestSpec{URL: u, RefreshURL: func(context.Context, *url.URL) (*url.URL, error) { return nil, errRefresh }}
+	_, err = New(WithLogger(quietLogger())).Download(filepath.Join(dir, "failed"), spec)
+	if !errors.Is(err, errRefresh) || !strings.HasPrefix(err.Error(), "dl: refreshing ") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// SetResolver sets the resolver the dl package looks up hosts with, see WithResolver
+func SetResolver(r *net.Resolver) {
+	WithResolver(r)(std)
+}
+
+// WithResolver looks up the hosts of URLs with r instead of the system
+// resolver, nil goes back to the system resolver
+func WithResolver(r *net.Resolver) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		d.resolver = r
+		d.mu.Unlock()
+		d.installDialer()
+	}
+}
+
+// SetResolve sets the addresses the dl package connects to in place of
+// looking up hosts, see WithResolve
+func SetResolve(overrides map[string]string) {
+	WithResolve(overrides)(std)
+}
+
+// WithResolve connects to a fixed address for some hosts instead of looking
+// them up, like curl's --resolve. Keys are the host and port being
+// connected to, like "example.com:443", and values the address to connect to
+// in their place, like "192.0.2.1:443" or "192.0.2.1" to keep the port.
+// The URL's host is still used for the Host header and for TLS, and
+// redirects to an overridden host connect to its address too. Overrides are
+// added to any that are already set, and an empty address removes one.
+func WithResolve(overrides map[string]string) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		for hostport, addr := range overrides {
+			if addr == "" {
+				delete(d.resolveOverrides, hostport)
+				continue
+			}
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				if _, port, err := net.SplitHostPort(hostport); err == nil {
+					addr = net.JoinHostPort(addr, port)
+				}
+			}
+			if d.resolveOverrides == nil {
+				d.resolveOverrides = make(map[string]string)
+			}
+			d.resolveOverrides[hostport] = addr
+		}
+		d.mu.Unlock()
+		d.installDialer()
+	}
+}
+
+// ResolveOverrides returns the addresses set with WithResolve, keyed by the
+// host and port they replace
+func (d *Downloader) ResolveOverrides() map[string]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	overrides := make(map[string]string, len(d.resolveOverrides))
+	for k, v := range d.resolveOverrides {
+		overrides[k] = v
+	}
+	return overrides
+}
+
+// installDialer makes the transport dial with d.dial, and stops it using a
+// proxy if private networks are blocked, as only the proxy would be checked
+func (d *Downloader) installDialer() {
+	t := d.transport()
+	if t == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t.DialContext = d.dial
+	if d.http1 != nil {
+		d.http1.DialContext = d.dial
+	}
+	if d.blockPrivate {
+		t.Proxy = nil
+		if d.http1 != nil {
+			d.http1.Proxy = nil
+		}
+	}
+	d.guarded = t
+}
+
+// dial connects to addr, or the address or Unix socket it is overridden with,
+// looking hosts up with the Downloader's resolver. It dials the same way as
+// the http package's default transport.
+func (d *Downloader) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	d.mu.RLock()
+	resolver := d.resolver
+	override, ok := d.resolveOverrides[addr]
+	socket := d.unixSockets[host]
+	timeout := d.dialTimeout
+	d.mu.RUnlock()
+	if timeout <= 0 {
+		timeout = DefaultDialTimeout
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Resolver:  resolver,
+		Control:   d.dialControl,
+	}
+
+	if socket != "" {
+		dialer.Control = nil
+		conn, err := dialer.DialContext(ctx, "unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("dl: dialing %s for %s: %w", socket, addr, err)
+		}
+		return conn, nil
+	}
+
+	target := addr
+	if ok {
+		d.log.Debugf("Connecting to %s for %s\n", override, addr)
+		target = override
+	}
+	conn, err := dialer.DialContext(ctx, network, target)
+	if ne, isNet := err.(net.Error); isNet && ne.Timeout() && ctx.Err() == nil {
+		err = &TimeoutError{Timeout: ErrDialTimeout, Err: err}
+	}
+	if err != nil && ok {
+		return nil, fmt.Errorf("dl: dialing %s in place of %s: %w", override, addr, err)
+	}
+	return conn, err
+}
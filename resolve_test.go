@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	srv := newEchoHostServer(t)
+	addr := srv.Listener.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+
+	d := New(WithResolve(map[string]string{"downloads.example.com:" + port: addr}))
+	u, _ := url.Parse("http://downloads.example.com:" + port + "/file")
+	body, err := d.GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != u.Host {
+		t.Fatalf("server saw Host %q, want %q", body, u.Host)
+	}
+}
+
+func TestResolveTLS(t *testing.T) {
+	srv, c, sni := newSNIServer(t)
+	addr := srv.Listener.Addr().String()
+
+	// The certificate is for example.com, which is connected to at the
+	// server's address
+	d := New(WithClient(c), WithResolve(map[string]string{"example.com:443": addr}))
+	u, _ := url.Parse("https://example.com/file")
+	body, err := d.GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" || sni() != "example.com" {
+		t.Fatalf("got %q with server name %q", body, sni())
+	}
+}
+
+func TestResolveRedirect(t *testing.T) {
+	srv := newRedirectServer(t)
+	addr := srv.Listener.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+	host := "mirror.example.com:" + port
+
+	var hops []string
+	d := New(WithResolve(map[string]string{host: addr}), WithOnRedirect(func(from, to *url.URL, status int) {
+		hops = append(hops, to.Host)
+	}))
+	u, _ := url.Parse("http://" + host + "/1")
+	body, err := d.GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" || len(hops) != 3 || hops[2] != host {
+		t.Fatalf("got %q after redirects to %q", body, hops)
+	}
+}
+
+func TestResolveOverrides(t *testing.T) {
+	d := New(WithResolve(map[string]string{
+		"a.example.com:443": "192.0.2.1",
+		"b.example.com:80":  "192.0.2.2:8080",
+	}))
+	got := d.ResolveOverrides()
+	if len(got) != 2 || got["a.example.com:443"] != "192.0.2.1:443" || got["b.example.com:80"] != "192.0.2.2:8080" {
+		t.Fatalf("got %v", got)
+	}
+
+	// The returned map is a copy, and an empty address removes an override
+	got["c.example.com:443"] = "192.0.2.3:443"
+	WithResolve(map[string]string{"a.example.com:443": ""})(d)
+	if got = d.ResolveOverrides(); len(got) != 1 || got["b.example.com:80"] == "" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	var lookups int32
+	errNoDNS := errors.New("no DNS here")
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			atomic.AddInt32(&lookups, 1)
+			return nil, errNoDNS
+		},
+	}
+
+	u, _ := url.Parse("http://not-yet-live.example.com/file")
+	if _, err := New(WithResolver(r)).GetBodyFromURL(u, nil, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if atomic.LoadInt32(&lookups) == 0 {
+		t.Fatal("the resolver wasn't used")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// MaxReconnects is how many times a reader from OpenResumable reconnects
+// before giving up
+const MaxReconnects = 5
+
+// OpenResumable will open the body of the url as a reader that reconnects when
+// the connection drops, see Downloader.OpenResumable
+func OpenResumable(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (io.ReadCloser, error) {
+	return std.OpenResumable(u, headers, cookies)
+}
+
+// OpenResumable will open the body of the url as a reader that picks up where
+// it left off when the connection drops, by asking for the rest of the body
+// with a Range request. It reconnects up to MaxReconnects times, waiting as
+// long as it would between retries, and only if the server supports ranges
+// and the body hasn't changed in the meantime, otherwise the read error is
+// returned. The caller must close the reader.
+func (d *Downloader) OpenResumable(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (io.ReadCloser, error) {
+	r := &resumableReader{d: d, spec: newSpec(u, headers, cookies)}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// resumableReader is the reader returned by OpenResumable
+type resumableReader struct {
+	d    *Downloader
+	spec *RequestSpec
+	body io.ReadCloser
+	// offset is how much of the body has been read
+	offset       int64
+	validator    string
+	acceptRanges bool
+	reconnects   int
+}
+
+// open requests the body from offset onwards
+func (r *resumableReader) open() error {
+	req, err := r.d.newRequest(r.spec)
+	if err != nil {
+		return err
+	}
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		req.Header.Set("If-Range", r.validator)
+	}
+
+	resp, err := r.d.do(req)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	if err := r.d.validate(resp); err != nil {
+		resp.Body.Close()
+		return err
+	}
+
+	if r.offset > 0 {
+		if err := checkRangeStart(resp, r.offset); err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("dl: resuming %s: %w", r.spec.URL.Redacted(), err)
+		}
+	} else {
+		r.validator = ifRangeValidator(resp.Header)
+		r.acceptRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+	}
+
+	r.body = resp.Body
+	return nil
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			// A broken body keeps failing, so the next Read reconnects
+			return n, nil
+		}
+
+		if !r.acceptRanges || r.validator == "" || r.reconnects >= MaxReconnects {
+			return 0, err
+		}
+		r.reconnects++
+		r.body.Close()
+
+		wait := r.d.retryDelay(r.reconnects)
+		r.d.log.Warnf("Reconnecting to %s at %d bytes in %s: %v\n", path.Base(r.spec.URL.Path), r.offset, wait, err)
+		time.Sleep(wait)
+
+		if oerr := r.open(); oerr != nil {
+			r.body = http.NoBody
+			return 0, fmt.Errorf("%w (reconnecting after %v)", oerr, err)
+		}
+	}
+}
+
+func (r *resumableReader) Close() error {
+	return r.body.Close()
+}
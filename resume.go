@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// ResumeDownloadProgress will download the url to fileloc, carrying on from
+// what an earlier run left, see Downloader.ResumeDownloadProgress
+func ResumeDownloadProgress(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie, cb func(Progress)) (DownloadResult, error) {
+	return std.ResumeDownloadProgress(fileloc, u, headers, cookies, cb)
+}
+
+// ResumeDownloadProgress will download the url to fileloc like Download, but
+// in a way that survives the process being restarted. The validator and size
+// of the file are saved next to its part file, and if the download fails in
+// a way that can be resumed, or is stopped with Shutdown, both are kept. The
+// next call carries on from the end of the part file if the file hasn't
+// changed on the server. cb, if not nil, is called with the progress of this
+// download as well as any function set with WithProgress, starting with what
+// the part file already holds. It is always downloaded over one connection.
+func (d *Downloader) ResumeDownloadProgress(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie, cb func(Progress)) (DownloadResult, error) {
+	t := newTransfer(fileloc, newSpec(u, headers, cookies))
+	t.keep = true
+	t.progress = cb
+	d.loadResumeState(t)
+
+	if cb != nil {
+		cb(Progress{URL: u, Path: fileloc, Written: t.offset, Total: t.total, ETA: -1, Meta: t.spec.Meta})
+	}
+	return d.fetchTransfer(t, 1)
+}
+
+// loadResumeState picks t up from the state an earlier run saved, if there
+// is any that can be resumed from
+func (d *Downloader) loadResumeState(t *transfer) {
+	t.total = -1
+	state, err := d.readState(t.part)
+	if err != nil {
+		return
+	}
+	info, err := d.fs.Stat(t.part)
+	if err != nil || state.URL != t.spec.URL.String() || state.Validator == "" || (state.Size >= 0 && info.Size() > state.Size) {
+		d.fs.Remove(t.part + stateSuffix)
+		return
+	}
+
+	t.offset = info.Size()
+	t.ifRange = state.Validator
+	t.total = state.Size
+	t.acceptRanges = true
+	d.log.Infof("Resuming %s from an earlier run at %d bytes\n", t.fileloc, t.offset)
+}
+
+// saveResumeState saves the validator and size of a download t is starting
+// from the beginning, so that a later run can resume it
+func (d *Downloader) saveResumeState(t *transfer) {
+	if !t.keep {
+		return
+	}
+	if !t.acceptRanges || t.ifRange == "" {
+		// Nothing to resume with
+		d.fs.Remove(t.part + stateSuffix)
+		return
+	}
+
+	err := d.writeState(t.part, &segmentState{URL: t.spec.URL.String(), Validator: t.ifRange, Size: t.total})
+	if err != nil {
+		d.log.Warnf("Couldn't save state of %s: %v\n", t.part, err)
+	}
+}
+
+// discardPart removes the part file of a failed download, unless t keeps it
+// and err is something a later run could resume after
+func (d *Downloader) discardPart(t *transfer, err error) {
+	var te *transferError
+	var ue *url.Error
+	resumable := errors.As(err, &te) || errors.As(err, &ue) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+	if t.keep && resumable && t.offset > 0 && t.ifRange != "" {
+		return
+	}
+
+	d.fs.Remove(t.part)
+	if t.keep {
+		d.fs.Remove(t.part + stateSuffix)
+	}
+}
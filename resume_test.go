@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeDownloadProgress(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 10000)
+	u, ranges := newDropServer(t, body, 4000)
+	dest := filepath.Join(t.TempDir(), "file")
+
+	// The first run is cut off, leaving the part file and its state
+	if _, err := New(WithLogger(quietLogger())).ResumeDownloadProgress(dest, u, nil, nil, nil); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	if part, _ := ioutil.ReadFile(dest + partSuffix); len(part) != 4000 {
+		t.Fatalf("part file has %d bytes, want 4000", len(part))
+	}
+
+	var progress []Progress
+	res, err := New(WithLogger(quietLogger())).ResumeDownloadProgress(dest, u, nil, nil, func(p Progress) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) == 0 || progress[0].Written != 4000 || progress[0].Total != int64(len(body)) {
+		t.Fatalf("first progress %+v, want 4000 of %d written", progress, len(body))
+	}
+	if last := progress[len(progress)-1]; last.Written != int64(len(body)) {
+		t.Errorf("last progress %+v", last)
+	}
+	if r := ranges(); len(r) != 2 || r[1] != "bytes=4000-" {
+		t.Errorf("ranges %q", r)
+	}
+	if got, _ := ioutil.ReadFile(dest); !bytes.Equal(got, body) || res.Written != int64(len(body)) {
+		t.Errorf("got %d bytes, reported %d", len(got), res.Written)
+	}
+	if FileExists(dest+partSuffix) || FileExists(dest+partSuffix+stateSuffix) {
+		t.Error("part file or state left behind")
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+	retryFactor    = 2
+)
+
+// backoff is how long to wait between attempts
+type backoff struct {
+	base   time.Duration
+	max    time.Duration
+	factor float64
+	// jitter is the fraction of each delay that is randomized
+	jitter float64
+}
+
+var defaultBackoff = backoff{base: retryBaseDelay, max: retryMaxDelay, factor: retryFactor}
+
+// SetRetryBackoff sets how long the dl package waits between attempts, see WithRetryBackoff
+func SetRetryBackoff(base, max time.Duration, factor float64) {
+	WithRetryBackoff(base, max, factor)(std)
+}
+
+// WithRetryBackoff sets how long the Downloader waits between attempts: base
+// after the first, multiplied by factor after each one after that, and never
+// more than max. A factor below 1 is treated as 1, and a max below base as
+// base. It replaces any Backoff set with WithBackoff.
+func WithRetryBackoff(base, max time.Duration, factor float64) Option {
+	return func(d *Downloader) {
+		if base <= 0 {
+			d.log.Warnf("Retry backoff base %s is not positive, using %s\n", base, retryBaseDelay)
+			base = retryBaseDelay
+		}
+		if max < base {
+			d.log.Warnf("Retry backoff max %s is below base %s, using %s\n", max, base, base)
+			max = base
+		}
+		if factor < 1 || math.IsNaN(factor) {
+			d.log.Warnf("Retry backoff factor %v is below 1, using 1\n", factor)
+			factor = 1
+		}
+
+		d.backoff.base = base
+		d.backoff.max = max
+		d.backoff.factor = factor
+		d.retryBackoff = d.backoffDelay
+	}
+}
+
+// SetRetryJitter randomizes the waits between attempts of the dl package, see WithRetryJitter
+func SetRetryJitter(fraction float64) {
+	WithRetryJitter(fraction)(std)
+}
+
+// WithRetryJitter randomizes each wait between attempts by up to fraction of
+// it either way, so that clients that failed together don't all retry at the
+// same moment. Waits stay within the bounds set by WithRetryBackoff. fraction
+// is limited to between 0 and 1. Like WithRetryBackoff it replaces any Backoff
+// set with WithBackoff.
+func WithRetryJitter(fraction float64) Option {
+	return func(d *Downloader) {
+		if fraction < 0 || math.IsNaN(fraction) {
+			fraction = 0
+		}
+		if fraction > 1 {
+			fraction = 1
+		}
+		d.backoff.jitter = fraction
+		d.retryBackoff = d.backoffDelay
+	}
+}
+
+// DownloadFileRetry will download the url to fileloc, making up to attempts
+// attempts and resuming where the last one left off when the server allows it
+func DownloadFileRetry(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie, attempts int) (int64, error) {
+	return std.DownloadFileRetry(fileloc, u, headers, cookies, attempts)
+}
+
+// DownloadFileRetry will download the url to fileloc, making up to attempts
+// attempts and resuming where the last one left off when the server allows it
+func (d *Downloader) DownloadFileRetry(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie, attempts int) (int64, error) {
+	return d.download(fileloc, newSpec(u, headers, cookies), attempts)
+}
+
+// SetRetryPredicate sets how the dl package decides whether a failed attempt
+// is retried, see WithRetryPredicate
+func SetRetryPredicate(retry func(resp *http.Response, err error) bool) {
+	WithRetryPredicate(retry)(std)
+}
+
+// WithRetryPredicate replaces how the Downloader decides whether a failed
+// attempt is retried, which by default is when the connection failed, the
+// body was cut off, or the status was 5xx or 429. retry is called after every
+// failed attempt that has attempts left, with the response if there was one,
+// whose body has already been closed, and the error. nil restores the default.
+func WithRetryPredicate(retry func(resp *http.Response, err error) bool) Option {
+	if retry == nil {
+		return WithRetryPolicy(nil)
+	}
+	return WithRetryPolicy(func(resp *http.Response, err error, attempt int) bool {
+		return retry(resp, err)
+	})
+}
+
+// RetryPolicy decides whether a failed attempt is retried, given the
+// response if there was one, the error, and the number of the attempt that
+// failed starting from 1
+type RetryPolicy func(resp *http.Response, err error, attempt int) bool
+
+// DefaultRetryPolicy is how a Downloader decides whether to retry unless
+// told otherwise: when the connection failed, the body was cut off, or the
+// status was 5xx or 429. A RetryPolicy can call it to only change some
+// decisions.
+func DefaultRetryPolicy(resp *http.Response, err error, attempt int) bool {
+	return retryable(resp, err)
+}
+
+// SetRetryPolicy sets how the dl package decides whether a failed attempt is
+// retried, see WithRetryPolicy
+func SetRetryPolicy(retry RetryPolicy) {
+	WithRetryPolicy(retry)(std)
+}
+
+// WithRetryPolicy replaces how the Downloader decides whether a failed
+// attempt is retried, like WithRetryPredicate but also told which attempt
+// failed. retry is called after every failed attempt that has attempts left,
+// including ones that couldn't connect, which have a nil response. A
+// response's body has already been closed. nil restores DefaultRetryPolicy.
+func WithRetryPolicy(retry RetryPolicy) Option {
+	return func(d *Downloader) {
+		d.retryPolicy = retry
+	}
+}
+
+// shouldRetry reports whether a failed attempt should be retried
+func (d *Downloader) shouldRetry(resp *http.Response, err error, attempt int) bool {
+	if d.retryPolicy != nil {
+		return d.retryPolicy(resp, err, attempt)
+	}
+	return DefaultRetryPolicy(resp, err, attempt)
+}
+
+// retryable reports whether a failed attempt is worth trying again: the
+// connection failed, the body was cut off, or the server had a temporary
+// problem
+func retryable(resp *http.Response, err error) bool {
+	if errors.Is(err, ErrInsecureRedirect) || errors.Is(err, ErrHostNotAllowed) {
+		return false
+	}
+
+	var te *transferError
+	if errors.As(err, &te) {
+		return true
+	}
+
+	var ue *url.Error
+	if resp == nil && errors.As(err, &ue) {
+		return !errors.Is(err, context.Canceled)
+	}
+
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.StatusCode >= 500 || he.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// delay returns how long to wait before making the given attempt again,
+// random is a number in [0, 1) used for jitter
+func (b backoff) delay(attempt int, random float64) time.Duration {
+	delay := float64(b.base)
+	for i := 1; i < attempt && delay < float64(b.max); i++ {
+		delay *= b.factor
+	}
+	delay += delay * b.jitter * (2*random - 1)
+
+	if delay > float64(b.max) {
+		delay = float64(b.max)
+	}
+	if delay < float64(b.base) {
+		delay = float64(b.base)
+	}
+	return time.Duration(delay)
+}
+
+// backoffDelay is the Backoff set by WithRetryBackoff and WithRetryJitter
+func (d *Downloader) backoffDelay(attempt int) time.Duration {
+	return d.backoff.delay(attempt, rand.Float64())
+}
+
+// retryDelay returns how long to wait before making the given attempt again
+func (d *Downloader) retryDelay(attempt int) time.Duration {
+	if d.retryBackoff == nil {
+		return defaultRetryBackoff(attempt)
+	}
+	return d.retryBackoff(attempt)
+}
+
+// Backoff returns how long to wait before retrying after the given attempt
+// failed, counting from 1
+type Backoff func(attempt int) time.Duration
+
+// defaultRetryBackoff is the Backoff of a new Downloader
+var defaultRetryBackoff = ExponentialBackoff(retryBaseDelay, retryMaxDelay)
+
+// SetBackoff sets how long the dl package waits between attempts, see WithBackoff
+func SetBackoff(b Backoff) {
+	WithBackoff(b)(std)
+}
+
+// WithBackoff sets how long the Downloader waits between attempts, replacing
+// WithRetryBackoff and WithRetryJitter. nil restores the default, which is
+// ExponentialBackoff from 1s up to 30s.
+func WithBackoff(b Backoff) Option {
+	return func(d *Downloader) {
+		d.retryBackoff = b
+	}
+}
+
+// ExponentialBackoff waits a random time of up to base after the first
+// attempt, up to twice that after the second and so on, but never more than
+// max. Waiting for a random part of the whole delay, known as full jitter,
+// keeps clients that failed together from retrying together.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt; i++ {
+			if delay > max/2 {
+				delay = max
+				break
+			}
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+		if delay <= 0 {
+			return 0
+		}
+		// Up to and including delay, unless that would overflow
+		n := int64(delay)
+		if n < math.MaxInt64 {
+			n++
+		}
+		return time.Duration(rand.Int63n(n))
+	}
+}
+
+// ConstantBackoff always waits delay
+func ConstantBackoff(delay time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		return delay
+	}
+}
+
+// LinearBackoff waits step after the first attempt, twice step after the
+// second and so on, but never more than max
+func LinearBackoff(step, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		if attempt < 1 {
+			attempt = 1
+		}
+		if step <= 0 {
+			return 0
+		}
+		if time.Duration(attempt) > max/step {
+			return max
+		}
+		return step * time.Duration(attempt)
+	}
+}
+
+// SetOnRetry sets a function the dl package calls before every retry, see WithOnRetry
+func SetOnRetry(fn func(u *url.URL, attempt int, delay time.Duration, err error)) {
+	WithOnRetry(fn)(std)
+}
+
+// WithOnRetry sets a function that is called before every retry with the
+// URL, the attempt that failed counting from 1, how long the Downloader will
+// wait before retrying and why it failed. Segments of a download are retried
+// on their own, so each of their retries is reported too.
+func WithOnRetry(fn func(u *url.URL, attempt int, delay time.Duration, err error)) Option {
+	return func(d *Downloader) {
+		d.onRetry = fn
+	}
+}
+
+// clock tells a Downloader the time and waits between attempts, so tests can
+// run retries without waiting for them
+type clock interface {
+	Now() time.Time
+	// Sleep waits for d or until ctx is done, whichever comes first
+	Sleep(ctx context.Context, d time.Duration)
+}
+
+// realClock is the clock of a new Downloader
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newDropServer serves body, cutting the connection after drop bytes of the
+// first response and answering later Range requests with the rest. It returns
+// the Range header of every request.
+func newDropServer(t *testing.T, body []byte, drop int) (*url.URL, func() []string) {
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Accept-Ranges", "bytes")
+		if first {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body[:drop])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		if rg := r.Header.Get("Range"); rg != "" {
+			start, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rg, "bytes="), "-"))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(body)-1, len(body)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(body[start:])
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, _ := url.Parse(srv.URL + "/file")
+	return u, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ranges...)
+	}
+}
+
+// fastRetries is a Downloader option that keeps the waits between attempts short
+var fastRetries = WithRetryBackoff(time.Millisecond, time.Millisecond, 1)
+
+func TestDownloadFileRetryResume(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 1000)
+	u, ranges := newDropServer(t, body, 4000)
+
+	dest := filepath.Join(t.TempDir(), "file")
+	d := New(WithLogger(quietLogger()), fastRetries)
+	n, err := d.DownloadFileRetry(dest, u, nil, nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadFile(dest)
+	if !bytes.Equal(got, body) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(body))
+	}
+	if n != int64(len(body)) {
+		t.Errorf("reported %d bytes", n)
+	}
+	if r := ranges(); len(r) != 2 || r[1] != "bytes=4000-" {
+		t.Fatalf("ranges %q", r)
+	}
+}
+
+func TestDownloadFileRetryExhausted(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 1000)
+	u, _ := newDropServer(t, body, 4000)
+
+	dest := filepath.Join(t.TempDir(), "file")
+	d := New(WithLogger(quietLogger()), fastRetries)
+	if _, err := d.DownloadFileRetry(dest, u, nil, nil, 1); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestIfRange(t *testing.T) {
+	body := strings.Repeat("abcdefghij", 100)
+	tests := []struct {
+		name string
+		// etag is sent with every response
+		etag string
+		// ignore answers a Range with the whole body, and badTotal with a
+		// range of a longer file
+		ignore, badTotal bool
+		ifRange          string
+		err              error
+	}{
+		{name: "weak", etag: `W/"v1"`},
+		{name: "ignored", etag: `"v1"`, ignore: true, ifRange: `"v1"`},
+		{name: "changed", etag: `"v1"`, badTotal: true, ifRange: `"v1"`, err: ErrValidatorMismatch},
+	}
+	for _, tt := range tests {
+		var requests int32
+		var mu sync.Mutex
+		var ifRange string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", tt.etag)
+			w.Header().Set("Accept-Ranges", "bytes")
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.Write([]byte(body[:300]))
+				w.(http.Flusher).Flush()
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			mu.Lock()
+			ifRange = r.Header.Get("If-Range")
+			mu.Unlock()
+			if tt.badTotal && r.Header.Get("Range") != "" {
+				longer := body + strings.Repeat("z", 100)
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 300-%d/%d", len(longer)-1, len(longer)))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(longer[300:]))
+				return
+			}
+			w.Write([]byte(body))
+		}))
+		u, _ := url.Parse(srv.URL + "/file")
+
+		dest := filepath.Join(t.TempDir(), "file")
+		d := New(WithLogger(quietLogger()), fastRetries)
+		_, err := d.DownloadFileRetry(dest, u, nil, nil, 3)
+		srv.Close()
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+			}
+			if FileExists(dest) || FileExists(dest+partSuffix) {
+				t.Errorf("%s: files left behind", tt.name)
+			}
+		} else if got, _ := ioutil.ReadFile(dest); err != nil || string(got) != body {
+			t.Errorf("%s: got %d bytes, %v", tt.name, len(got), err)
+		}
+		if ifRange != tt.ifRange {
+			t.Errorf("%s: sent If-Range %q, want %q", tt.name, ifRange, tt.ifRange)
+		}
+	}
+}
+
+func TestIfRangeValidator(t *testing.T) {
+	date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		etag     string
+		modified time.Time
+		want     string
+	}{
+		{`"v1"`, time.Time{}, `"v1"`},
+		{`W/"v1"`, date.Add(-time.Hour), ""},
+		{"", date.Add(-time.Hour), date.Add(-time.Hour).Format(http.TimeFormat)},
+		{"", date, ""},
+		{"", time.Time{}, ""},
+	}
+	for _, tt := range tests {
+		h := http.Header{"Date": {date.Format(http.TimeFormat)}}
+		if tt.etag != "" {
+			h.Set("ETag", tt.etag)
+		}
+		if !tt.modified.IsZero() {
+			h.Set("Last-Modified", tt.modified.Format(http.TimeFormat))
+		}
+		if got := ifRangeValidator(h); got != tt.want {
+			t.Errorf("%v: got %q, want %q", h, got, tt.want)
+		}
+	}
+}
+
+// fakeClock is a clock whose Sleep only moves its time on and records how
+// long it was asked to wait
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+
+	const base, max = 100 * time.Millisecond, time.Second
+	nominal := []time.Duration{base, 3 * base, 9 * base, max, max, max}
+	for _, jitter := range []float64{0, 0.5} {
+		c := &fakeClock{now: time.Unix(0, 0)}
+		d := New(WithLogger(quietLogger()), WithRetryBackoff(base, max, 3), WithRetryJitter(jitter))
+		d.clock = c
+
+		res, err := d.fetch(filepath.Join(t.TempDir(), "file"), newSpec(u, nil, nil), len(nominal)+1)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(c.sleeps) != len(nominal) {
+			t.Fatalf("jitter %v: waited %d times, want %d", jitter, len(c.sleeps), len(nominal))
+		}
+
+		var total time.Duration
+		for i, got := range c.sleeps {
+			total += got
+			if got < base || got > max {
+				t.Errorf("jitter %v: wait %d is %s, outside %s to %s", jitter, i+1, got, base, max)
+			}
+			lo := time.Duration(float64(nominal[i]) * (1 - jitter))
+			hi := time.Duration(float64(nominal[i]) * (1 + jitter))
+			if got < lo || got > hi {
+				t.Errorf("jitter %v: wait %d is %s, want %s to %s", jitter, i+1, got, lo, hi)
+			}
+		}
+		if res.Duration != total {
+			t.Errorf("jitter %v: took %s, want the %s spent waiting", jitter, res.Duration, total)
+		}
+	}
+}
+
+func TestWithRetryBackoffInvalid(t *testing.T) {
+	d := New(WithLogger(quietLogger()), WithRetryBackoff(-time.Second, time.Millisecond, 0.5))
+	if d.backoff.base != retryBaseDelay || d.backoff.max != retryBaseDelay || d.backoff.factor != 1 {
+		t.Fatalf("got %+v", d.backoff)
+	}
+
+	d = New(WithRetryJitter(7))
+	if d.backoff.jitter != 1 {
+		t.Fatalf("jitter %v", d.backoff.jitter)
+	}
+}
+
+func TestRetryPredicate(t *testing.T) {
+	// An eventually consistent store that 404s until the object shows up
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/object")
+	dir := t.TempDir()
+
+	// By default a 404 isn't retried
+	d := New(WithLogger(quietLogger()), fastRetries)
+	if _, err := d.DownloadFileRetry(filepath.Join(dir, "default"), u, nil, nil, 5); err == nil {
+		t.Fatal("expected the 404")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("%d requests, want 1", n)
+	}
+
+	var statuses []int
+	d = New(WithLogger(quietLogger()), fastRetries, WithRetryPredicate(func(resp *http.Response, err error) bool {
+		if resp == nil {
+			return false
+		}
+		statuses = append(statuses, resp.StatusCode)
+		return resp.StatusCode == http.StatusNotFound
+	}))
+	dest := filepath.Join(dir, "object")
+	if _, err := d.DownloadFileRetry(dest, u, nil, nil, 5); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadFile(dest); string(body) != "ok" {
+		t.Fatalf("got %q", body)
+	}
+	if len(statuses) != 1 || statuses[0] != http.StatusNotFound {
+		t.Fatalf("predicate saw %v", statuses)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	var attempts []int
+	d := New(WithLogger(quietLogger()), fastRetries, WithRetryPolicy(func(resp *http.Response, err error, attempt int) bool {
+		attempts = append(attempts, attempt)
+		return (resp != nil && resp.StatusCode == http.StatusForbidden) || DefaultRetryPolicy(resp, err, attempt)
+	}))
+	if _, err := d.DownloadFileRetry(filepath.Join(t.TempDir(), "file"), u, nil, nil, 5); err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Fatalf("policy saw attempts %v", attempts)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		base, max time.Duration
+		// caps are the longest waits after each attempt, from the first
+		caps []time.Duration
+	}{
+		{"doubling", 100 * time.Millisecond, time.Second, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}},
+		{"base over max", time.Minute, time.Second, []time.Duration{time.Second, time.Second}},
+		{"no base", 0, time.Second, []time.Duration{0, 0, 0}},
+		{"negative base", -time.Second, time.Second, []time.Duration{0, 0}},
+	} {
+		b := ExponentialBackoff(tc.base, tc.max)
+		for i, limit := range tc.caps {
+			var longest time.Duration
+			for n := 0; n < 200; n++ {
+				delay := b(i + 1)
+				if delay < 0 || delay > limit {
+					t.Fatalf("%s: attempt %d waited %v, want at most %v", tc.name, i+1, delay, limit)
+				}
+				if delay > longest {
+					longest = delay
+				}
+			}
+			// Full jitter covers the whole range
+			if longest < limit/2 {
+				t.Errorf("%s: attempt %d waited at most %v of up to %v", tc.name, i+1, longest, limit)
+			}
+		}
+	}
+
+	// Large attempts don't overflow past max
+	b := ExponentialBackoff(time.Hour, time.Duration(math.MaxInt64))
+	for _, attempt := range []int{64, 1000, math.MaxInt32, math.MaxInt64} {
+		if delay := b(attempt); delay < 0 {
+			t.Errorf("attempt %d waited %v", attempt, delay)
+		}
+	}
+}
+
+func TestLinearBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		step, max time.Duration
+		attempt   int
+		want      time.Duration
+	}{
+		{"first", time.Second, time.Minute, 1, time.Second},
+		{"third", time.Second, time.Minute, 3, 3 * time.Second},
+		{"capped", time.Second, 5 * time.Second, 6, 5 * time.Second},
+		{"at the cap", time.Second, 5 * time.Second, 5, 5 * time.Second},
+		{"attempt zero", time.Second, time.Minute, 0, time.Second},
+		{"negative attempt", time.Second, time.Minute, -3, time.Second},
+		{"no step", 0, time.Minute, 3, 0},
+		{"negative step", -time.Second, time.Minute, 3, 0},
+		{"overflow", time.Hour, time.Duration(math.MaxInt64), math.MaxInt64, time.Duration(math.MaxInt64)},
+		{"large attempt", time.Hour, 24 * time.Hour, math.MaxInt32, 24 * time.Hour},
+	} {
+		if got := LinearBackoff(tc.step, tc.max)(tc.attempt); got != tc.want {
+			t.Errorf("%s: LinearBackoff(%v, %v)(%d) = %v, want %v", tc.name, tc.step, tc.max, tc.attempt, got, tc.want)
+		}
+	}
+}
+
+func TestConstantBackoff(t *testing.T) {
+	b := ConstantBackoff(3 * time.Second)
+	for _, attempt := range []int{0, 1, 2, 100, math.MaxInt64} {
+		if got := b(attempt); got != 3*time.Second {
+			t.Errorf("attempt %d waited %v", attempt, got)
+		}
+	}
+}
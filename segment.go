@@ -0,0 +1,685 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinSegmentSize is the smallest piece a segmented download is split into
+const MinSegmentSize = 1 << 20
+
+// SegmentAttempts is the fewest attempts each segment of a download gets
+const SegmentAttempts = 3
+
+// errNotSegmentable is returned when a download can't be split into segments
+// and has to be made in one piece
+var errNotSegmentable = errors.New("dl: can't download in segments")
+
+// SetSegments makes the dl package download files in pieces at once, see WithSegments
+func SetSegments(n int) {
+	WithSegments(n)(std)
+}
+
+// WithSegments splits each download into up to n ranges that are downloaded
+// at the same time over separate connections and written straight into
+// place in the file. Each range is retried on its own, with as many attempts
+// as the whole download would get but at least SegmentAttempts, so one
+// failing range doesn't start the others over. Ranges are at least
+// MinSegmentSize, and a download is only split if the server supports ranges
+// and sends a strong ETag or Last-Modified to make sure every range comes from
+// the same file. Otherwise, or if the filesystem's files don't implement
+// io.WriterAt, it is downloaded in one piece. Zero or one turns segments off.
+//
+// Which ranges have been written is saved next to the part file as they
+// finish, so a download that fails or is interrupted only fetches the missing
+// ranges the next time, unless the file has changed on the server.
+func WithSegments(n int) Option {
+	return func(d *Downloader) {
+		d.segments = n
+		d.adaptiveSegments = false
+	}
+}
+
+// SetAdaptiveSegments makes the dl package work out how many segments to
+// download files in, see WithAdaptiveSegments
+func SetAdaptiveSegments(max int) {
+	WithAdaptiveSegments(max)(std)
+}
+
+// WithAdaptiveSegments downloads files in segments like WithSegments, but
+// starts with a single connection and measures how fast it goes. Every
+// second, while the last connection added made the download at least 10%
+// faster, the segment with the most left is split in two and another
+// connection started, up to max connections. Why each connection was or
+// wasn't added is logged at debug level.
+func WithAdaptiveSegments(max int) Option {
+	return func(d *Downloader) {
+		d.segments = max
+		d.adaptiveSegments = max > 1
+	}
+}
+
+// segmentable reports whether t could be split up. Downloads checked block by
+// block or started by ResumeDownloadProgress are always made in one piece.
+func (d *Downloader) segmentable(t *transfer) bool {
+	spec := t.spec
+	if d.segments < 2 || t.blocks != nil || t.keep || spec.method() != "GET" || spec.Body != nil {
+		return false
+	}
+	for k := range spec.Headers {
+		if strings.EqualFold(k, "Range") {
+			return false
+		}
+	}
+	return true
+}
+
+// adaptWindow is how long adaptive segments measure the speed for before
+// deciding whether to add a connection
+var adaptWindow = time.Second
+
+// adaptGain is how much faster a download has to get for adaptive segments
+// to keep adding connections
+const adaptGain = 1.1
+
+// errFileChanged is returned when the file being downloaded in segments
+// changes on the server
+var errFileChanged = errors.New("dl: file changed during the download")
+
+// errSegmentEnd stops the transfer of a segment that has reached its end
+// after being split
+var errSegmentEnd = errors.New("dl: end of segment")
+
+// segment is the range [start, end) of a segmented download
+type segment struct {
+	mu         sync.Mutex
+	start, end int64
+	// done is how much of the range has been written
+	done int64
+	// running is set while the segment is being downloaded
+	running bool
+}
+
+// pos returns the offset the segment continues from and where it ends
+func (s *segment) pos() (int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.start + s.done, s.end
+}
+
+// splitGaps splits the ranges [start, end) in gaps into about n segments of
+// at least MinSegmentSize, giving each gap a share of them by its size
+func splitGaps(gaps [][2]int64, n int) []*segment {
+	var total int64
+	for _, gap := range gaps {
+		total += gap[1] - gap[0]
+	}
+
+	var segments []*segment
+	for _, gap := range gaps {
+		size := gap[1] - gap[0]
+		k := int(int64(n) * size / total)
+		if max := int(size / MinSegmentSize); k > max {
+			k = max
+		}
+		if k < 1 {
+			k = 1
+		}
+
+		per := size / int64(k)
+		for i := 0; i < k; i++ {
+			segments = append(segments, &segment{start: gap[0] + int64(i)*per, end: gap[0] + int64(i+1)*per})
+		}
+		segments[len(segments)-1].end = gap[1]
+	}
+	return segments
+}
+
+// segmentRun is a segmented download in progress
+type segmentRun struct {
+	d *Downloader
+	t *transfer
+	// ctx is the context of the segments' requests, which is cancelled to
+	// stop them all once the file has changed
+	ctx       context.Context
+	cancel    context.CancelFunc
+	w         io.WriterAt
+	out       File
+	validator string
+	size      int64
+	attempts  int
+	written   rangeSet
+
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	segments []*segment
+	errs     []error
+
+	// meter, if set, measures the segments together, guarded by meterMu
+	meterMu sync.Mutex
+	meter   *meter
+}
+
+// start downloads seg in the background
+func (r *segmentRun) start(seg *segment) {
+	seg.running = true
+	r.mu.Lock()
+	r.segments = append(r.segments, seg)
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		err := r.d.downloadSegment(r, seg)
+
+		seg.mu.Lock()
+		seg.running = false
+		seg.mu.Unlock()
+		if err != nil {
+			r.mu.Lock()
+			r.errs = append(r.errs, err)
+			r.mu.Unlock()
+			if errors.Is(err, errFileChanged) {
+				// The other segments are of a file that is gone
+				r.cancel()
+			}
+		}
+		r.saveState()
+	}()
+}
+
+// progress returns how much has been written and how many segments are
+// still running
+func (r *segmentRun) progress() (int64, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var done int64
+	running := 0
+	for _, seg := range r.segments {
+		seg.mu.Lock()
+		done += seg.done
+		if seg.running {
+			running++
+		}
+		seg.mu.Unlock()
+	}
+	return done, running
+}
+
+// split takes the second half of the running segment with the most left to
+// download and starts it as a new segment, reporting whether any segment had
+// enough left to split
+func (r *segmentRun) split() bool {
+	r.mu.Lock()
+	var biggest *segment
+	var most int64
+	for _, seg := range r.segments {
+		seg.mu.Lock()
+		if left := seg.end - seg.start - seg.done; seg.running && left > most {
+			biggest, most = seg, left
+		}
+		seg.mu.Unlock()
+	}
+	r.mu.Unlock()
+	if most < 2*MinSegmentSize {
+		return false
+	}
+
+	biggest.mu.Lock()
+	from := biggest.start + biggest.done
+	mid := from + (biggest.end-from)/2
+	next := &segment{start: mid, end: biggest.end}
+	biggest.end = mid
+	biggest.mu.Unlock()
+
+	r.start(next)
+	return true
+}
+
+// adapt adds segments to r while each one makes the download meaningfully
+// faster, up to max
+func (r *segmentRun) adapt(max int) {
+	defer r.wg.Done()
+	name := filepath.Base(r.t.fileloc)
+	ticker := time.NewTicker(adaptWindow)
+	defer ticker.Stop()
+
+	var last int64
+	var lastRate float64
+	for {
+		<-ticker.C
+		done, running := r.progress()
+		if running == 0 {
+			return
+		}
+		rate := float64(done-last) / adaptWindow.Seconds()
+		last = done
+
+		switch {
+		case running >= max:
+			r.d.log.Debugf("Segments for %s: %d connections at %s/s, the most allowed\n", name, running, humanize.Bytes(uint64(rate)))
+			return
+		case lastRate > 0 && rate < lastRate*adaptGain:
+			r.d.log.Debugf("Segments for %s: %d connections at %s/s, up from %s/s, not adding more\n", name, running, humanize.Bytes(uint64(rate)), humanize.Bytes(uint64(lastRate)))
+			return
+		case !r.split():
+			r.d.log.Debugf("Segments for %s: %d connections at %s/s, nothing left big enough to split\n", name, running, humanize.Bytes(uint64(rate)))
+			return
+		}
+		r.d.log.Debugf("Segments for %s: %d connections at %s/s, adding another\n", name, running, humanize.Bytes(uint64(rate)))
+		lastRate = rate
+	}
+}
+
+// downloadSegmented downloads t in segments, returning errNotSegmentable if
+// it can't be. A download that fails part way keeps its part file and a
+// state file saying which ranges of it were written, which the next attempt
+// to download it continues from if the file on the server hasn't changed.
+func (d *Downloader) downloadSegmented(t *transfer, attempts int) error {
+	size, validator, err := d.probeSegments(t)
+	if err != nil {
+		return err
+	}
+
+	state := d.loadSegmentState(t, size, validator)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if state != nil {
+		flag = os.O_WRONLY
+	}
+
+	d.fs.MkdirAll(filepath.Dir(t.fileloc), os.FileMode(0775))
+	out, err := d.fs.OpenFile(t.part, flag, os.FileMode(0664))
+	if err != nil {
+		return err
+	}
+	w, ok := out.(io.WriterAt)
+	if !ok {
+		out.Close()
+		d.fs.Remove(t.part)
+		return errNotSegmentable
+	}
+	if f, ok := out.(interface{ Truncate(int64) error }); ok && state == nil {
+		if err := f.Truncate(size); err != nil {
+			d.log.Debugf("Couldn't preallocate %s: %v\n", t.part, err)
+		}
+	}
+
+	if attempts < SegmentAttempts {
+		attempts = SegmentAttempts
+	}
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	r := &segmentRun{d: d, t: t, ctx: ctx, cancel: cancel, w: w, out: out, validator: validator, size: size, attempts: attempts}
+
+	missing := [][2]int64{{0, size}}
+	if state != nil {
+		for _, done := range state.Done {
+			r.written.add(done[0], done[1])
+		}
+		missing = r.written.gaps(size)
+		d.log.Infof("Resuming %s with %s of %s left\n", filepath.Base(t.fileloc), humanize.Bytes(uint64(r.written.missing(size))), sizeString(size))
+	}
+	// What was resumed counts towards the progress, like a resumed attempt
+	t.offset = size - r.written.missing(size)
+	r.meter = d.meterFor(t, size-t.offset)
+
+	if d.adaptiveSegments {
+		d.log.Infof("Downloading %s (%s) in up to %d segments\n", filepath.Base(t.fileloc), sizeString(size), d.segments)
+		for _, gap := range missing {
+			r.start(&segment{start: gap[0], end: gap[1]})
+		}
+		// adapt counts towards the wait group so it is done starting segments
+		// before the download is
+		r.wg.Add(1)
+		go r.adapt(d.segments)
+	} else {
+		segments := splitGaps(missing, d.segments)
+		d.log.Infof("Downloading %s (%s) in %d segments\n", filepath.Base(t.fileloc), sizeString(size), len(segments))
+		for _, seg := range segments {
+			r.start(seg)
+		}
+	}
+	r.wg.Wait()
+
+	err = out.Close()
+	for i, serr := range r.errs {
+		// Cancelling the others after a change makes it the error that matters
+		if i == 0 || errors.Is(serr, errFileChanged) {
+			err = serr
+		}
+	}
+	if err == nil && !r.written.covers(size) {
+		err = fmt.Errorf("dl: segments of %s left gaps, wrote %s", t.spec.URL.Redacted(), &r.written)
+	}
+	if err == nil {
+		err = d.verifySegments(t)
+	}
+	if err == nil && t.verify != nil {
+		err = t.verify(t.part)
+	}
+	if err == nil {
+		err = d.fs.Rename(t.part, t.fileloc)
+	}
+	if r.meter != nil {
+		end := err
+		if end == nil {
+			end = io.EOF
+		}
+		r.meter.report(d.clock.Now(), end)
+	}
+	t.offset, _ = r.progress()
+
+	// Otherwise the state each segment saved as it finished is kept for the
+	// next attempt
+	var mismatch *ChecksumMismatchError
+	switch {
+	case err == nil:
+		d.fs.Remove(t.part + stateSuffix)
+	case errors.Is(err, errFileChanged), errors.As(err, &mismatch):
+		d.fs.Remove(t.part)
+		d.fs.Remove(t.part + stateSuffix)
+	}
+	return err
+}
+
+// probeSegments asks for the first byte of t to find its size and the
+// validator to send with the requests for its segments
+func (d *Downloader) probeSegments(t *transfer) (int64, string, error) {
+	req, err := d.newRequest(t.spec)
+	if err != nil {
+		return 0, "", err
+	}
+	req = req.WithContext(t.ctx)
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := d.do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	t.proto = resp.Proto
+	t.status = resp.StatusCode
+	t.header = resp.Header.Clone()
+	if err := checkStatus(resp); err != nil {
+		return 0, "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, "", errNotSegmentable
+	}
+	d.choosePath(t, resp)
+
+	var start, end, size int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return 0, "", errNotSegmentable
+	}
+	if size < 2*MinSegmentSize {
+		return 0, "", errNotSegmentable
+	}
+	if t.spec.ExpectedSize > 0 && size != t.spec.ExpectedSize {
+		return 0, "", fmt.Errorf("%w: %s is %d bytes, expected %d", ErrSizeMismatch, t.spec.URL.Redacted(), size, t.spec.ExpectedSize)
+	}
+	if t.spec.MinSize > 0 && size < t.spec.MinSize {
+		return 0, "", tooSmall(t.spec.URL, size, t.spec.MinSize, nil)
+	}
+
+	validator := ifRangeValidator(resp.Header)
+	if validator == "" {
+		return 0, "", errNotSegmentable
+	}
+	return size, validator, nil
+}
+
+// downloadSegment downloads seg, retrying it up to r.attempts times
+func (d *Downloader) downloadSegment(r *segmentRun, seg *segment) error {
+	for attempt := 1; ; attempt++ {
+		resp, err := d.fetchSegment(r, seg)
+		if err == nil {
+			return nil
+		}
+
+		from, end := seg.pos()
+		if attempt >= r.attempts || r.ctx.Err() != nil || !d.shouldRetry(resp, err, attempt) ||
+			!d.retry(r.t, fmt.Sprintf("bytes %d-%d of %s", from, end-1, filepath.Base(r.t.fileloc)), attempt, err) {
+			return fmt.Errorf("dl: bytes %d-%d of %s: %w", from, end-1, r.t.spec.URL.Redacted(), err)
+		}
+	}
+}
+
+// fetchSegment makes one attempt at the rest of seg
+func (d *Downloader) fetchSegment(r *segmentRun, seg *segment) (*http.Response, error) {
+	t := r.t
+	req, err := d.newRequest(t.spec)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(r.ctx)
+	from, end := seg.pos()
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, end-1))
+	req.Header.Set("If-Range", r.validator)
+
+	resp, err := d.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		return resp, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		// If-Range failed, so the file has changed since the download started
+		return resp, fmt.Errorf("%w: %s", errFileChanged, t.spec.URL.Redacted())
+	}
+	if err := checkRangeStart(resp, from); err != nil {
+		return resp, err
+	}
+
+	buf := d.getBuffer()
+	defer d.putBuffer(buf)
+
+	dst := &segmentWriter{w: r.w, seg: seg, written: &r.written}
+	var src io.Reader = d.limitReader(r.ctx, resp.Body)
+	if r.meter != nil {
+		src = &segmentMeter{r: src, run: r}
+	}
+	_, err = copyBuffer(dst, bodyReader{src}, *buf)
+	if err != nil && err != errSegmentEnd {
+		return resp, err
+	}
+	if from, end := seg.pos(); from != end {
+		return resp, &transferError{fmt.Errorf("%w: stopped at byte %d of %d-%d", ErrTruncated, from, seg.start, end-1)}
+	}
+	return resp, nil
+}
+
+// segmentMeter counts what is read for a segment towards the meter of the
+// whole download
+type segmentMeter struct {
+	r   io.Reader
+	run *segmentRun
+}
+
+func (s *segmentMeter) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+
+	s.run.meterMu.Lock()
+	defer s.run.meterMu.Unlock()
+	// The end of a segment isn't the end of the download
+	if merr := s.run.meter.count(n, nil); merr != nil {
+		return n, merr
+	}
+	return n, err
+}
+
+// verifySegments checks the part file of t against the Repr-Digest its
+// segments were served with, if they had one
+func (d *Downloader) verifySegments(t *transfer) error {
+	check := d.reprDigestCheck(t.header)
+	if check == nil {
+		return nil
+	}
+
+	f, err := d.fs.OpenFile(t.part, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(check, f); err != nil {
+		return err
+	}
+	if err := check.verify(t.fileloc); err != nil {
+		return err
+	}
+	t.digest = check
+	return nil
+}
+
+// segmentWriter writes a segment into place, recording what it wrote, and
+// stops at the end of the segment even if it is split while being written
+type segmentWriter struct {
+	w       io.WriterAt
+	seg     *segment
+	written *rangeSet
+}
+
+func (s *segmentWriter) Write(p []byte) (int, error) {
+	s.seg.mu.Lock()
+	defer s.seg.mu.Unlock()
+
+	off := s.seg.start + s.seg.done
+	full := len(p)
+	if left := s.seg.end - off; int64(len(p)) > left {
+		p = p[:left]
+	}
+
+	n, err := s.w.WriteAt(p, off)
+	s.seg.done += int64(n)
+	if aerr := s.written.add(off, off+int64(n)); aerr != nil && err == nil {
+		err = aerr
+	}
+	if err == nil && n < full {
+		err = errSegmentEnd
+	}
+	return n, err
+}
+
+// rangeSet is the set of byte ranges of a file that have been written
+type rangeSet struct {
+	mu sync.Mutex
+	// ranges are sorted, don't overlap and aren't adjacent
+	ranges [][2]int64
+}
+
+// add records that [start, end) was written, which is an error if any of it
+// already was
+func (s *rangeSet) add(start, end int64) error {
+	if start >= end {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i][1] >= start })
+	for k := i; k < len(s.ranges) && s.ranges[k][0] < end; k++ {
+		if s.ranges[k][1] > start {
+			return fmt.Errorf("dl: bytes %d-%d were written twice", start, end-1)
+		}
+	}
+
+	// Merge with the ranges that touch it
+	j := i
+	for j < len(s.ranges) && s.ranges[j][0] <= end {
+		if s.ranges[j][0] < start {
+			start = s.ranges[j][0]
+		}
+		if s.ranges[j][1] > end {
+			end = s.ranges[j][1]
+		}
+		j++
+	}
+	s.ranges = append(s.ranges[:i], append([][2]int64{{start, end}}, s.ranges[j:]...)...)
+	return nil
+}
+
+// gaps returns the ranges of [0, size) that haven't been written
+func (s *rangeSet) gaps(size int64) [][2]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var gaps [][2]int64
+	var at int64
+	for _, r := range s.ranges {
+		if r[0] > at {
+			gaps = append(gaps, [2]int64{at, r[0]})
+		}
+		at = r[1]
+	}
+	if at < size {
+		gaps = append(gaps, [2]int64{at, size})
+	}
+	return gaps
+}
+
+// missing returns how much of [0, size) hasn't been written
+func (s *rangeSet) missing(size int64) int64 {
+	var n int64
+	for _, gap := range s.gaps(size) {
+		n += gap[1] - gap[0]
+	}
+	return n
+}
+
+// list returns a copy of the written ranges
+func (s *rangeSet) list() [][2]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][2]int64(nil), s.ranges...)
+}
+
+// covers reports whether all of [0, size) was written
+func (s *rangeSet) covers(size int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return size == 0 || (len(s.ranges) == 1 && s.ranges[0][0] == 0 && s.ranges[0][1] == size)
+}
+
+func (s *rangeSet) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := make([]string, len(s.ranges))
+	for i, r := range s.ranges {
+		parts[i] = fmt.Sprintf("%d-%d", r[0], r[1]-1)
+	}
+	return "bytes " + strings.Join(parts, ", ")
+}
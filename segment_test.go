@@ -0,0 +1,299 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// segmentServer serves body with ranges and a strong ETag, recording the
+// ranges it was asked for
+type segmentServer struct {
+	*httptest.Server
+	body []byte
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newSegmentServer(t *testing.T, body []byte, header http.Header) (*segmentServer, *url.URL) {
+	t.Helper()
+	s := &segmentServer{body: body}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.mu.Unlock()
+
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "f", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(s.Close)
+	u, _ := url.Parse(s.URL)
+	return s, u
+}
+
+func TestDownloadSegmented(t *testing.T) {
+	body := testBody(4*MinSegmentSize + 123)
+	srv, u := newSegmentServer(t, body, nil)
+
+	var mu sync.Mutex
+	var reports []Progress
+	d := New(WithSegments(4), WithProgress(func(p Progress) {
+		mu.Lock()
+		reports = append(reports, p)
+		mu.Unlock()
+	}))
+	fileloc := filepath.Join(t.TempDir(), "f")
+	res, err := d.Download(fileloc, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(fileloc); !bytes.Equal(got, body) {
+		t.Fatal("segmented file doesn't match")
+	}
+	if res.Written != int64(len(body)) {
+		t.Fatalf("wrote %d bytes, want %d", res.Written, len(body))
+	}
+	// The probe and one request for each segment
+	if len(srv.ranges) != 5 {
+		t.Fatalf("got %d requests, want 5: %q", len(srv.ranges), srv.ranges)
+	}
+
+	if len(reports) == 0 {
+		t.Fatal("no progress was reported")
+	}
+	if fin := reports[len(reports)-1]; !fin.Finished || fin.Outcome != Downloaded {
+		t.Fatalf("final report %+v, want a finished download", fin)
+	}
+	reports = reports[:len(reports)-1]
+	last := reports[len(reports)-1]
+	if !last.Done || last.Err != nil || last.Written != int64(len(body)) || last.Total != int64(len(body)) {
+		t.Fatalf("last report %+v, want done with the whole file", last)
+	}
+	for _, p := range reports[:len(reports)-1] {
+		if p.Done {
+			t.Fatalf("report %+v was done before the download", p)
+		}
+	}
+}
+
+func TestDownloadSegmentedMinSize(t *testing.T) {
+	body := testBody(2 * MinSegmentSize)
+	_, u := newSegmentServer(t, body, nil)
+
+	fileloc := filepath.Join(t.TempDir(), "f")
+	_, err := New(WithSegments(4)).Download(fileloc, &RequestSpec{URL: u, MinSize: 3 * MinSegmentSize})
+	if !errors.Is(err, ErrSuspiciouslySmall) {
+		t.Fatalf("got %v, want ErrSuspiciouslySmall", err)
+	}
+}
+
+func TestDownloadSegmentedReprDigest(t *testing.T) {
+	body := testBody(2*MinSegmentSize + 1)
+	sum := sha256.Sum256(body)
+	good := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	sum[0]++
+	bad := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	_, u := newSegmentServer(t, body, http.Header{"Repr-Digest": {good}})
+	fileloc := filepath.Join(t.TempDir(), "good")
+	res, err := New(WithSegments(2)).Download(fileloc, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DigestHeader != "Repr-Digest" {
+		t.Fatalf("verified against %q, want Repr-Digest", res.DigestHeader)
+	}
+
+	_, u = newSegmentServer(t, body, http.Header{"Repr-Digest": {bad}})
+	fileloc = filepath.Join(t.TempDir(), "bad")
+	_, err = New(WithSegments(2)).Download(fileloc, &RequestSpec{URL: u})
+	var mismatch *ChecksumMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("got %v, want a ChecksumMismatchError", err)
+	}
+	for _, path := range []string{fileloc, fileloc + partSuffix, fileloc + partSuffix + stateSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s was left behind", path)
+		}
+	}
+}
+
+func TestDownloadSegmentedFileChanged(t *testing.T) {
+	body := testBody(4 * MinSegmentSize)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		switch {
+		case rng == "bytes=0-0":
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(w, r, "f", time.Time{}, bytes.NewReader(body))
+		case strings.HasPrefix(rng, "bytes=0-"):
+			// The file has changed, so If-Range gets the whole of it
+			w.Header().Set("ETag", `"v2"`)
+			w.Write(body)
+		default:
+			// The other segments hang until they are cancelled
+			w.Header().Set("Content-Range", "bytes "+rng[len("bytes="):]+"/4194304")
+			w.WriteHeader(http.StatusPartialContent)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	fileloc := filepath.Join(t.TempDir(), "f")
+	start := time.Now()
+	_, err := New(WithSegments(4)).Download(fileloc, &RequestSpec{URL: u})
+	if !errors.Is(err, errFileChanged) {
+		t.Fatalf("got %v, want errFileChanged", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("took %v, the other segments weren't cancelled", elapsed)
+	}
+	if _, err := os.Stat(fileloc + partSuffix); !os.IsNotExist(err) {
+		t.Fatal("part file of a changed file was kept")
+	}
+}
+
+func TestDownloadSegmentedNotSegmentable(t *testing.T) {
+	body := testBody(4 * MinSegmentSize)
+	srv, u := newSegmentServer(t, body, nil)
+
+	fileloc := filepath.Join(t.TempDir(), "f")
+	_, err := New(WithSegments(4)).DownloadFileVerifyBlocks(fileloc, u, nil, nil, MinSegmentSize, blockHashes(body, MinSegmentSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.ranges) != 1 || srv.ranges[0] != "" {
+		t.Fatalf("got ranges %q, want one request for the whole file", srv.ranges)
+	}
+}
+
+// throttledWriter writes to a response 32KiB at a time, calling wait before
+// each write
+type throttledWriter struct {
+	http.ResponseWriter
+	wait func()
+}
+
+func (w throttledWriter) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > 32<<10 {
+			chunk = chunk[:32<<10]
+		}
+		w.wait()
+		m, err := w.ResponseWriter.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		b = b[m:]
+	}
+	return n, nil
+}
+
+func TestAdaptiveSegments(t *testing.T) {
+	defer func(w time.Duration) { adaptWindow = w }(adaptWindow)
+	adaptWindow = 100 * time.Millisecond
+	body := testBody(12 * MinSegmentSize)
+
+	for _, tc := range []struct {
+		name string
+		// shared makes every connection share the same bandwidth, so adding
+		// another doesn't make the download faster
+		shared bool
+		max    int
+		check  func(peak int) bool
+	}{
+		{"per connection", false, 3, func(peak int) bool { return peak == 3 }},
+		{"shared", true, 4, func(peak int) bool { return peak > 1 && peak < 4 }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu, link sync.Mutex
+			var running, peak int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				probe := r.Header.Get("Range") == "bytes=0-0"
+				if !probe {
+					mu.Lock()
+					running++
+					if running > peak {
+						peak = running
+					}
+					mu.Unlock()
+					defer func() {
+						mu.Lock()
+						running--
+						mu.Unlock()
+					}()
+				}
+
+				wait := func() { time.Sleep(4 * time.Millisecond) }
+				if tc.shared {
+					wait = func() {
+						link.Lock()
+						time.Sleep(4 * time.Millisecond)
+						link.Unlock()
+					}
+				}
+				w.Header().Set("ETag", `"v1"`)
+				http.ServeContent(throttledWriter{w, wait}, r, "f", time.Time{}, bytes.NewReader(body))
+			}))
+			defer srv.Close()
+			u, _ := url.Parse(srv.URL)
+
+			fileloc := filepath.Join(t.TempDir(), "f")
+			res, err := New(WithLogger(quietLogger()), WithAdaptiveSegments(tc.max)).Download(fileloc, &RequestSpec{URL: u})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := ioutil.ReadFile(fileloc); !bytes.Equal(got, body) || res.Size != int64(len(body)) {
+				t.Fatal("adaptively segmented file doesn't match")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !tc.check(peak) {
+				t.Errorf("got up to %d connections", peak)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// stateSuffix is appended to the part file of a segmented or resumable
+// download to name the file its state is saved in
+const stateSuffix = ".json"
+
+// segmentState is what is saved about a segmented download, or one started
+// by ResumeDownloadProgress, so it can be continued by a later run
+type segmentState struct {
+	URL       string `json:"url"`
+	Validator string `json:"validator"`
+	// Size is the size of the whole file, -1 if it isn't known
+	Size int64 `json:"size"`
+	// Done are the [start, end) ranges of the part file that were written by
+	// a segmented download
+	Done [][2]int64 `json:"done,omitempty"`
+}
+
+// readState reads the state saved next to part
+func (d *Downloader) readState(part string) (*segmentState, error) {
+	f, err := d.fs.OpenFile(part+stateSuffix, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &segmentState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// writeState saves state next to part. It is written to a temporary file
+// first so a crash can't leave it half written.
+func (d *Downloader) writeState(part string, state *segmentState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	path := part + stateSuffix
+	tmp := path + partSuffix
+	out, err := d.fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = d.fs.Rename(tmp, path)
+	}
+	if err != nil {
+		d.fs.Remove(tmp)
+	}
+	return err
+}
+
+// loadSegmentState returns the saved state of an earlier attempt at t if it
+// was for the same file, or nil after removing it if it wasn't
+func (d *Downloader) loadSegmentState(t *transfer, size int64, validator string) *segmentState {
+	state, err := d.readState(t.part)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil {
+		if info, serr := d.fs.Stat(t.part); serr != nil || info.Size() != size {
+			err = serr
+			if err == nil {
+				err = errFileChanged
+			}
+		}
+	}
+
+	switch {
+	case err != nil:
+		d.log.Warnf("Ignoring saved state of %s: %v\n", t.part, err)
+	case state.URL != t.spec.URL.String() || state.Validator != validator || state.Size != size:
+		d.log.Infof("%s has changed since it was partly downloaded, starting over\n", t.spec.URL.Redacted())
+	default:
+		return state
+	}
+	d.fs.Remove(t.part + stateSuffix)
+	return nil
+}
+
+// saveState saves which ranges of the part file have been written, after
+// making sure they are on disk if the file can be synced
+func (r *segmentRun) saveState() {
+	if f, ok := r.out.(interface{ Sync() error }); ok {
+		if err := f.Sync(); err != nil {
+			return
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.d.writeState(r.t.part, &segmentState{
+		URL:       r.t.spec.URL.String(),
+		Validator: r.validator,
+		Size:      r.size,
+		Done:      r.written.list(),
+	})
+	if err != nil {
+		r.d.log.Warnf("Couldn't save state of %s: %v\n", r.t.part, err)
+	}
+}
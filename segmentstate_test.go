@@ -0,0 +1,151 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRangeSet(t *testing.T) {
+	var s rangeSet
+	if s.add(10, 20) != nil || s.add(30, 40) != nil {
+		t.Fatal(s.String())
+	}
+	if gaps := s.gaps(50); len(gaps) != 3 || gaps[0] != [2]int64{0, 10} || gaps[1] != [2]int64{20, 30} || gaps[2] != [2]int64{40, 50} {
+		t.Fatalf("got gaps %v", gaps)
+	}
+	if s.missing(50) != 30 {
+		t.Fatalf("got %d missing, want 30", s.missing(50))
+	}
+	if s.add(20, 30) != nil || s.String() != "bytes 10-39" {
+		t.Fatal(s.String())
+	}
+	if s.add(0, 11) == nil || s.add(39, 41) == nil {
+		t.Fatal("overlapping ranges were added")
+	}
+	if s.add(0, 10) != nil || !s.covers(40) {
+		t.Fatal(s.String())
+	}
+}
+
+func TestSplitGaps(t *testing.T) {
+	segments := splitGaps([][2]int64{{0, 4 * MinSegmentSize}, {5 * MinSegmentSize, 6 * MinSegmentSize}}, 5)
+	if len(segments) != 5 {
+		t.Fatalf("got %d segments, want 5", len(segments))
+	}
+	var total int64
+	for _, seg := range segments {
+		total += seg.end - seg.start
+	}
+	if total != 5*MinSegmentSize {
+		t.Fatalf("segments cover %d bytes, want %d", total, 5*MinSegmentSize)
+	}
+}
+
+func TestDownloadSegmentedResume(t *testing.T) {
+	body := testBody(4 * MinSegmentSize)
+	failing := "bytes=2097152-3145727"
+	var mu sync.Mutex
+	var ranges []string
+	fail := true
+	etag := `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		failNow := fail && r.Header.Get("Range") == failing
+		w.Header().Set("ETag", etag)
+		mu.Unlock()
+
+		if failNow {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "f", time.Time{}, bytes.NewReader(body))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	fileloc := filepath.Join(t.TempDir(), "f")
+	d := New(WithSegments(4), WithBackoff(ConstantBackoff(time.Millisecond)))
+	if _, err := d.Download(fileloc, &RequestSpec{URL: u}); err == nil {
+		t.Fatal("download with a failing segment succeeded")
+	}
+	state, err := d.readState(fileloc + partSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Done) != 2 || state.Done[0] != [2]int64{0, 2 * MinSegmentSize} || state.Done[1] != [2]int64{3 * MinSegmentSize, 4 * MinSegmentSize} {
+		t.Fatalf("saved %v as done", state.Done)
+	}
+
+	// The next attempt only fetches the missing segment
+	mu.Lock()
+	fail = false
+	ranges = nil
+	mu.Unlock()
+	res, err := d.Download(fileloc, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(fileloc); !bytes.Equal(got, body) {
+		t.Fatal("resumed file doesn't match")
+	}
+	if res.Size != int64(len(body)) || res.Written != MinSegmentSize {
+		t.Errorf("resumed download has size %d and wrote %d, want %d and %d", res.Size, res.Written, len(body), MinSegmentSize)
+	}
+	if len(ranges) != 2 || ranges[1] != failing {
+		t.Fatalf("got ranges %q, want only the missing segment", ranges)
+	}
+	if _, err := os.Stat(fileloc + partSuffix + stateSuffix); !os.IsNotExist(err) {
+		t.Fatal("state was left behind")
+	}
+}
+
+func TestDownloadSegmentedResumeChanged(t *testing.T) {
+	body := testBody(4 * MinSegmentSize)
+	srv, u := newSegmentServer(t, body, nil)
+
+	fileloc := filepath.Join(t.TempDir(), "f")
+	d := New(WithSegments(4))
+	part := fileloc + partSuffix
+	ioutil.WriteFile(part, make([]byte, len(body)), 0644)
+	// Saved for a different version of the file
+	d.writeState(part, &segmentState{URL: u.String(), Validator: `"v0"`, Size: int64(len(body)), Done: [][2]int64{{0, int64(len(body)) - 1}}})
+
+	if _, err := d.Download(fileloc, &RequestSpec{URL: u}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(fileloc); !bytes.Equal(got, body) {
+		t.Fatal("file doesn't match")
+	}
+	if len(srv.ranges) != 5 {
+		t.Fatalf("got ranges %q, want the whole file again", srv.ranges)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HostKeyError is returned when an SFTP server's host key is rejected by the
+// HostKeyCallback of the Downloader's ssh.ClientConfig
+type HostKeyError struct {
+	Host string
+	Key  ssh.PublicKey
+	Err  error
+}
+
+func (e *HostKeyError) Error() string {
+	return fmt.Sprintf("dl: host key for %s rejected: %v", e.Host, e.Err)
+}
+
+func (e *HostKeyError) Unwrap() error {
+	return e.Err
+}
+
+// WithSSHConfig sets the ssh configuration used to connect to sftp URLs. A
+// user and password in the URL take precedence over the config's.
+func WithSSHConfig(c *ssh.ClientConfig) Option {
+	return func(d *Downloader) {
+		d.sshConfig = c
+	}
+}
+
+// sftpRoundTrip answers a request for an sftp URL, with a "bytes=N-" Range
+// starting the read at N
+func (d *Downloader) sftpRoundTrip(req *http.Request) (*http.Response, error) {
+	if d.sshConfig == nil {
+		return nil, errors.New("dl: no ssh config set for sftp")
+	}
+
+	u := req.URL
+	cfg := *d.sshConfig
+	if u.User != nil {
+		cfg.User = u.User.Username()
+		if pass, ok := u.User.Password(); ok {
+			cfg.Auth = append([]ssh.AuthMethod{ssh.Password(pass)}, cfg.Auth...)
+		}
+	}
+
+	var hostKeyErr *HostKeyError
+	hostKeyCallback := cfg.HostKeyCallback
+	cfg.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := errors.New("no HostKeyCallback set")
+		if hostKeyCallback != nil {
+			err = hostKeyCallback(hostname, remote, key)
+		}
+		if err != nil {
+			hostKeyErr = &HostKeyError{Host: hostname, Key: key, Err: err}
+			return hostKeyErr
+		}
+		return nil
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	dialer := net.Dialer{Control: d.dialControl}
+	conn, err := dialer.DialContext(req.Context(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &cfg)
+	if err != nil {
+		conn.Close()
+		if hostKeyErr != nil {
+			return nil, hostKeyErr
+		}
+		return nil, err
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+
+	resp, err := sftpRetrieve(req, client)
+	if err != nil || resp.Body == http.NoBody {
+		client.Close()
+		sshClient.Close()
+		return resp, err
+	}
+
+	resp.Body = &sftpBody{ReadCloser: resp.Body, client: client, ssh: sshClient}
+	return resp, nil
+}
+
+func sftpRetrieve(req *http.Request, client *sftp.Client) (*http.Response, error) {
+	path := req.URL.Path
+	if strings.HasPrefix(path, "/~/") {
+		// Relative to the user's home directory
+		path = path[3:]
+	}
+
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+
+	stat, err := client.Stat(path)
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			return fileStatus(resp, http.StatusNotFound), nil
+		case errors.Is(err, os.ErrPermission):
+			return fileStatus(resp, http.StatusForbidden), nil
+		}
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("dl: %s is a directory", req.URL.Redacted())
+	}
+
+	size := stat.Size()
+	resp.Header.Set("Last-Modified", stat.ModTime().UTC().Format(http.TimeFormat))
+	resp.Header.Set("Accept-Ranges", "bytes")
+
+	start := int64(0)
+	if r := req.Header.Get("Range"); r != "" && ifRange(req.Header.Get("If-Range"), stat.ModTime()) {
+		if s, e, ok := parseRange(r, size); ok && e == size-1 {
+			start = s
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, size-1, size))
+			fileStatus(resp, http.StatusPartialContent)
+		}
+	}
+	if resp.StatusCode == 0 {
+		fileStatus(resp, http.StatusOK)
+	}
+	resp.ContentLength = size - start
+	resp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+
+	if req.Method == "HEAD" {
+		return resp, nil
+	}
+
+	f, err := client.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if start > 0 {
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	resp.Body = f
+	return resp, nil
+}
+
+// sftpBody closes the sftp session along with the file
+type sftpBody struct {
+	io.ReadCloser
+	client *sftp.Client
+	ssh    *ssh.Client
+}
+
+func (b *sftpBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.client.Close()
+	b.ssh.Close()
+	return err
+}
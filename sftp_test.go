@@ -0,0 +1,181 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSFTPServer starts an SSH server that serves the local filesystem over
+// sftp to user with pass, returning its address and host key
+func newSFTPServer(t *testing.T, user, pass string) (string, ssh.PublicKey) {
+	t.Helper()
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, p []byte) (*ssh.Permissions, error) {
+			if c.User() == user && string(p) == pass {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, cfg)
+		}
+	}()
+	return ln.Addr().String(), signer.PublicKey()
+}
+
+func serveSFTP(conn net.Conn, cfg *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					if srv, err := sftp.NewServer(ch, sftp.ReadOnly()); err == nil {
+						srv.Serve()
+					}
+					ch.Close()
+				}
+			}
+		}()
+	}
+}
+
+func TestSFTP(t *testing.T) {
+	addr, key := newSFTPServer(t, "user", "pass")
+	dir := t.TempDir()
+	src := filepath.Join(dir, "f.txt")
+	ioutil.WriteFile(src, []byte("hello over sftp"), 0644)
+	u, _ := url.Parse("sftp://user:pass@" + addr + filepath.ToSlash(src))
+
+	d := New(WithLogger(quietLogger()), WithSSHConfig(&ssh.ClientConfig{HostKeyCallback: ssh.FixedHostKey(key)}))
+	dest := filepath.Join(dir, "copy")
+	if _, err := d.Download(dest, &RequestSpec{URL: u}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); string(got) != "hello over sftp" {
+		t.Fatalf("got %q", got)
+	}
+
+	// A range to the end of the file starts the read part way through,
+	// others get the whole file
+	for _, tc := range []struct {
+		rng    string
+		status int
+		want   string
+	}{
+		{"bytes=6-", http.StatusPartialContent, "over sftp"},
+		{"bytes=6-9", http.StatusOK, "hello over sftp"},
+	} {
+		req, _ := http.NewRequest("GET", u.String(), nil)
+		req.Header.Set("Range", tc.rng)
+		resp, err := d.sftpRoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || string(body) != tc.want {
+			t.Errorf("%s: got %d %q, want %d %q", tc.rng, resp.StatusCode, body, tc.status, tc.want)
+		}
+	}
+
+	// A part file from an earlier run is resumed from where it stopped
+	stat, _ := os.Stat(src)
+	os.Remove(dest)
+	ioutil.WriteFile(dest+partSuffix, []byte("hello "), 0644)
+	d.writeState(dest+partSuffix, &segmentState{URL: u.String(), Validator: stat.ModTime().UTC().Format(http.TimeFormat), Size: 15})
+	res, err := d.ResumeDownloadProgress(dest, u, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); string(got) != "hello over sftp" || res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("resumed %q with status %d", got, res.StatusCode)
+	}
+
+	missing, _ := url.Parse("sftp://user:pass@" + addr + filepath.ToSlash(filepath.Join(dir, "missing")))
+	var he *HTTPError
+	if _, err := d.Download(filepath.Join(dir, "missing"), &RequestSpec{URL: missing}); !errors.As(err, &he) || he.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: got %v", err)
+	}
+}
+
+func TestSFTPHostKey(t *testing.T) {
+	addr, key := newSFTPServer(t, "user", "pass")
+	u, _ := url.Parse("sftp://user:pass@" + addr + "/f")
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(other)
+
+	for name, callback := range map[string]ssh.HostKeyCallback{
+		"unknown key": ssh.FixedHostKey(otherSigner.PublicKey()),
+		"no callback": nil,
+	} {
+		d := New(WithLogger(quietLogger()), WithSSHConfig(&ssh.ClientConfig{HostKeyCallback: callback}))
+		_, err := d.Download(filepath.Join(t.TempDir(), "f"), &RequestSpec{URL: u})
+		var hke *HostKeyError
+		if !errors.As(err, &hke) || hke.Host != addr || string(hke.Key.Marshal()) != string(key.Marshal()) {
+			t.Errorf("%s: got %v, want a HostKeyError with the server's key", name, err)
+		}
+	}
+}
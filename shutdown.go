@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrShutdown is returned by downloads that were stopped or refused because
+// their Downloader was shut down
+var ErrShutdown = errors.New("dl: downloader is shut down")
+
+// activeDownloads keeps track of the downloads in progress so they can be
+// stopped
+type activeDownloads struct {
+	mu       sync.Mutex
+	shutdown bool
+	cancels  map[int]context.CancelFunc
+	next     int
+	// idle is closed once the last download stops after a shutdown
+	idle chan struct{}
+}
+
+// Shutdown will stop the downloads of the dl package, see Downloader.Shutdown
+func Shutdown(ctx context.Context) error {
+	return std.Shutdown(ctx)
+}
+
+// Shutdown stops every download to a file the Downloader is making and
+// waits for them to finish cleaning up, or for ctx to be done, in which case
+// it returns ctx's error. Their part files are removed, except those of
+// segmented downloads, which are kept to be resumed. The stopped downloads,
+// and any started afterwards, fail with ErrShutdown.
+func (d *Downloader) Shutdown(ctx context.Context) error {
+	a := &d.active
+	a.mu.Lock()
+	a.shutdown = true
+	for _, cancel := range a.cancels {
+		cancel()
+	}
+	if len(a.cancels) == 0 {
+		a.mu.Unlock()
+		return nil
+	}
+	if a.idle == nil {
+		a.idle = make(chan struct{})
+	}
+	idle := a.idle
+	n := len(a.cancels)
+	a.mu.Unlock()
+
+	d.log.Infof("Waiting for %d downloads to stop\n", n)
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// track registers a download so Shutdown can stop it, returning the context
+// to make it with and a function to call with its error once it is over,
+// which returns the error to report
+func (d *Downloader) track(ctx context.Context) (context.Context, func(error) error, error) {
+	a := &d.active
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.shutdown {
+		return ctx, nil, ErrShutdown
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	id := a.next
+	a.next++
+	if a.cancels == nil {
+		a.cancels = make(map[int]context.CancelFunc)
+	}
+	a.cancels[id] = cancel
+
+	return ctx, func(err error) error {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		stopped := a.shutdown && ctx.Err() == context.Canceled
+		cancel()
+		delete(a.cancels, id)
+		if a.shutdown && len(a.cancels) == 0 && a.idle != nil {
+			close(a.idle)
+		}
+
+		if err != nil && stopped {
+			return fmt.Errorf("%w: %v", ErrShutdown, err)
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{}, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000000")
+		w.Write([]byte("x"))
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	d := New(WithLogger(quietLogger()))
+
+	var futures []*Future
+	for i := 0; i < 3; i++ {
+		u, _ := url.Parse(fmt.Sprintf("%s/%d", srv.URL, i))
+		futures = append(futures, d.DownloadFileAsync(filepath.Join(dir, fmt.Sprint(i)), u, nil, nil, nil))
+	}
+	for range futures {
+		<-started
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range futures {
+		if _, err := f.Result(); !errors.Is(err, ErrShutdown) {
+			t.Errorf("download %d: got %v, want ErrShutdown", i, err)
+		}
+		if FileExists(filepath.Join(dir, fmt.Sprint(i))+partSuffix) || FileExists(filepath.Join(dir, fmt.Sprint(i))) {
+			t.Errorf("download %d left files behind", i)
+		}
+	}
+
+	u, _ := url.Parse(srv.URL + "/late")
+	if _, err := d.Download(filepath.Join(dir, "late"), &RequestSpec{URL: u}); !errors.Is(err, ErrShutdown) {
+		t.Errorf("download after shutdown: got %v, want ErrShutdown", err)
+	}
+	if err := d.Shutdown(ctx); err != nil {
+		t.Errorf("second shutdown: %v", err)
+	}
+}
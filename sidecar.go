@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SetDigestSidecar sets the hash the dl package writes a sidecar file with
+// after every download, see WithDigestSidecar
+func SetDigestSidecar(algo string) {
+	WithDigestSidecar(algo)(std)
+}
+
+// WithDigestSidecar writes a sidecar file named after the download with the
+// algorithm as its extension, like foo.tar.gz.sha256, in the format of tools
+// like sha256sum. It is only written when a file is actually downloaded, so
+// a skipped file keeps its existing sidecar. The algorithm can be any name
+// registered with RegisterHash, and an empty one turns sidecars off.
+func WithDigestSidecar(algo string) Option {
+	return func(d *Downloader) {
+		algo = strings.ToLower(algo)
+		if algo != "" {
+			if _, err := newHash(algo); err != nil {
+				d.log.Warnf("Not writing sidecars: %v\n", err)
+				algo = ""
+			}
+		}
+		d.sidecar = algo
+	}
+}
+
+// writeSidecar writes the digest sidecar for the file at fileloc
+func (d *Downloader) writeSidecar(fileloc string) error {
+	sum, err := d.fileHash(fileloc, d.sidecar)
+	if err != nil {
+		return err
+	}
+
+	sidecar := fileloc + "." + d.sidecar
+	tmp := sidecar + partSuffix
+	out, err := d.fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s  %s\n", sum, filepath.Base(fileloc))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = d.fs.Rename(tmp, sidecar)
+	}
+	if err != nil {
+		d.fs.Remove(tmp)
+		return fmt.Errorf("dl: writing %s: %w", sidecar, err)
+	}
+	return nil
+}
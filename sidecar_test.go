@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// helloSHA256 is the SHA-256 of "hello\n"
+const helloSHA256 = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+func newHelloServer(t *testing.T) *url.URL {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return u
+}
+
+func TestDigestSidecar(t *testing.T) {
+	u := newHelloServer(t)
+	fileloc := filepath.Join(t.TempDir(), "f.bin")
+	d := New(WithDigestSidecar("sha256"))
+	if _, err := d.DownloadFile(fileloc, u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(fileloc + ".sha256"); string(got) != helloSHA256+"  f.bin\n" {
+		t.Fatalf("got sidecar %q", got)
+	}
+
+	// A skipped file keeps its sidecar
+	ioutil.WriteFile(fileloc+".sha256", []byte("keep"), 0644)
+	if _, err := d.DownloadFile(fileloc, u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(fileloc + ".sha256"); string(got) != "keep" {
+		t.Fatal("sidecar of a skipped file was overwritten")
+	}
+}
+
+func TestChecksumBeforeSidecar(t *testing.T) {
+	u := newHelloServer(t)
+	dir := t.TempDir()
+	store := NewStore(filepath.Join(dir, "store"))
+	dedupDir := filepath.Join(dir, "dedup")
+	d := New(WithDigestSidecar("sha256"), WithStore(store), WithDedupDir(dedupDir))
+
+	fileloc := filepath.Join(dir, "f.bin")
+	jobs := []Job{{RequestSpec: RequestSpec{URL: u}, Dest: fileloc, SHA256: helloSHA256[1:] + "0"}}
+	report, err := d.DownloadAll(jobs, BatchOptions{})
+	var mismatch *ChecksumMismatchError
+	if err == nil || !errors.As(report.Results[0].Err, &mismatch) {
+		t.Fatalf("got %v, want a ChecksumMismatchError", report.Results[0].Err)
+	}
+	for _, path := range []string{fileloc, fileloc + ".sha256", dedupDir} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s exists after the checksum failed", path)
+		}
+	}
+	if store.Has(helloSHA256) {
+		t.Fatal("file that failed its checksum was stored")
+	}
+
+	// One that matches gets them all
+	jobs[0].SHA256 = helloSHA256
+	if _, err := d.DownloadAll(jobs, BatchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{fileloc, fileloc + ".sha256", filepath.Join(dedupDir, helloSHA256[:2], helloSHA256)} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !store.Has(helloSHA256) {
+		t.Fatal("file wasn't stored")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrSizeMismatch is returned when a download isn't the size it was expected to be
+var ErrSizeMismatch = errors.New("dl: size mismatch")
+
+// ErrTruncated is returned when a server closes the connection cleanly before
+// sending as much as its Content-Length said, as opposed to the connection
+// failing
+var ErrTruncated = errors.New("dl: server closed the connection early")
+
+// ErrSuspiciouslySmall is returned when a download is smaller than its MinSize
+var ErrSuspiciouslySmall = errors.New("dl: suspiciously small")
+
+// DefaultMaxPlausibleSize is the largest Content-Length a new Downloader
+// believes, 1 PiB
+const DefaultMaxPlausibleSize = 1 << 50
+
+// SetMaxPlausibleSize sets the largest Content-Length the dl package believes,
+// see WithMaxPlausibleSize
+func SetMaxPlausibleSize(n int64) {
+	WithMaxPlausibleSize(n)(std)
+}
+
+// WithMaxPlausibleSize sets the largest Content-Length the Downloader
+// believes. A larger one is treated as if the server hadn't sent a length at
+// all, rather than being trusted for size checks. Zero means no limit.
+func WithMaxPlausibleSize(n int64) Option {
+	return func(d *Downloader) {
+		d.maxPlausibleSize = n
+	}
+}
+
+// contentLength returns the Content-Length in h, or -1 if it is missing,
+// invalid or implausibly large
+func (d *Downloader) contentLength(h http.Header) int64 {
+	v := strings.TrimSpace(h.Get("Content-Length"))
+	if v == "" {
+		return -1
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	if d.maxPlausibleSize > 0 && n > d.maxPlausibleSize {
+		d.log.Warnf("Ignoring implausible Content-Length %d\n", n)
+		return -1
+	}
+	return n
+}
+
+// tooSmall returns the error for a download of size bytes that is below its
+// MinSize, quoting body if it looks like text
+func tooSmall(u *url.URL, size, min int64, body []byte) error {
+	err := fmt.Errorf("%w: %s is %d bytes, expected at least %d", ErrSuspiciouslySmall, u.Redacted(), size, min)
+	if len(body) > 0 && strings.HasPrefix(http.DetectContentType(body), "text/") {
+		err = fmt.Errorf("%w: %q", err, body)
+	}
+	return err
+}
+
+// sizeString formats a size for logging, which may be -1 if it isn't known
+func sizeString(n int64) string {
+	if n < 0 {
+		return "unknown size"
+	}
+	return humanize.Bytes(uint64(n))
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTruncated(t *testing.T) {
+	body := testBody(1000)
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/always" || atomic.AddInt32(&requests, 1) == 1 {
+			// Says 1000 bytes, sends 900 and ends the response
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Write(body[:len(body)-100])
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(body))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	d := New(WithLogger(quietLogger()), fastRetries)
+
+	u, _ := url.Parse(srv.URL + "/always")
+	_, err := d.DownloadFile(filepath.Join(dir, "always"), u, nil, nil)
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("got %v, want ErrTruncated", err)
+	}
+	if !strings.Contains(err.Error(), "900 of 1000") {
+		t.Errorf("error doesn't say how much arrived: %v", err)
+	}
+
+	// A retry picks up where it stopped
+	u, _ = url.Parse(srv.URL + "/once")
+	dest := filepath.Join(dir, "once")
+	if _, err := d.DownloadFileRetry(dest, u, nil, nil, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); !bytes.Equal(got, body) {
+		t.Fatalf("got %d bytes", len(got))
+	}
+}
+
+func TestExpectedSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.Write([]byte("hel"))
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	for _, path := range []string{"/plain", "/chunked"} {
+		u, _ := url.Parse(srv.URL + path)
+		spec := newSpec(u, nil, nil)
+		spec.ExpectedSize = 4
+		if _, err := New().Download(filepath.Join(dir, path), spec); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("%s: got %v, want ErrSizeMismatch", path, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSkipFunc(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		w.Write([]byte("new"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+	dest := filepath.Join(t.TempDir(), "file")
+
+	// A different size would be downloaded by default
+	ioutil.WriteFile(dest, []byte("old content"), 0644)
+	var etag string
+	d := New(WithLogger(quietLogger()), WithSkipFunc(func(fileloc string, localStat os.FileInfo, resp *http.Response) bool {
+		etag = resp.Header.Get("ETag")
+		return fileloc == dest && localStat.Size() == 11
+	}))
+	res, err := d.Download(dest, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Outcome != SkippedSameSize || etag != `"v2"` {
+		t.Errorf("outcome %v, skip func saw ETag %q", res.Outcome, etag)
+	}
+	if got, _ := ioutil.ReadFile(dest); string(got) != "old content" {
+		t.Errorf("skipped file changed to %q", got)
+	}
+
+	// The same size would be skipped by default
+	ioutil.WriteFile(dest, []byte("old"), 0644)
+	WithSkipFunc(func(string, os.FileInfo, *http.Response) bool { return false })(d)
+	res, err = d.Download(dest, &RequestSpec{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); res.Outcome != Downloaded || string(got) != "new" {
+		t.Errorf("outcome %v, file %q", res.Outcome, got)
+	}
+
+	// nil restores skipping files of the same size
+	WithSkipFunc(nil)(d)
+	if res, err = d.Download(dest, &RequestSpec{URL: u}); err != nil || res.Outcome != SkippedSameSize {
+		t.Errorf("default: outcome %v, %v", res.Outcome, err)
+	}
+}
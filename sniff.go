@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// sniffLen is how much of a file http.DetectContentType looks at
+const sniffLen = 512
+
+// DetectContentType will work out the MIME type of the file at fileloc from
+// its contents, see Downloader.DetectContentType
+func DetectContentType(fileloc string) (string, error) {
+	return std.DetectContentType(fileloc)
+}
+
+// DetectContentType will work out the MIME type of the file at fileloc from
+// its first 512 bytes with http.DetectContentType, regardless of the
+// Content-Type it was served with
+func (d *Downloader) DetectContentType(fileloc string) (string, error) {
+	f, err := d.fs.OpenFile(fileloc, os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// DownloadFileSniff will download the url to fileloc and return the type it
+// was served as and the type of its contents, see Downloader.DownloadFileSniff
+func DownloadFileSniff(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (headerType, sniffedType string, err error) {
+	return std.DownloadFileSniff(fileloc, u, headers, cookies)
+}
+
+// DownloadFileSniff will download the url to fileloc like DownloadFile and
+// return the Content-Type it was served with along with the type
+// DetectContentType finds in it, so callers can check a download is really
+// what they expected. headerType is empty if the file was already up to date
+// and wasn't downloaded again.
+func (d *Downloader) DownloadFileSniff(fileloc string, u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (headerType, sniffedType string, err error) {
+	res, err := d.Download(fileloc, newSpec(u, headers, cookies))
+	if err != nil {
+		return "", "", err
+	}
+
+	sniffedType, err = d.DetectContentType(res.Path)
+	return res.Header.Get("Content-Type"), sniffedType, err
+}
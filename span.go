@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"net/url"
+)
+
+// SpanInfo describes a download that is starting, for tracing
+type SpanInfo struct {
+	URL  *url.URL
+	Path string
+	// Meta is the RequestSpec's Meta
+	Meta interface{}
+}
+
+// SpanHooks starts a span for a download and returns the context its requests
+// are made with along with a function that ends the span
+type SpanHooks func(ctx context.Context, info SpanInfo) (context.Context, func(DownloadResult, error))
+
+// SetSpanHooks sets the function that traces downloads made by the dl package,
+// see WithSpanHooks
+func SetSpanHooks(start SpanHooks) {
+	WithSpanHooks(start)(std)
+}
+
+// WithSpanHooks calls start as each download begins, before checking whether
+// the file is up to date, and the function it returns once the download is
+// over with its result. It is called once per download however many attempts
+// it takes. The requests of the download are made with the context start
+// returns, so a request hook can inject a trace header from it. The
+// dlotel package has hooks for OpenTelemetry.
+func WithSpanHooks(start SpanHooks) Option {
+	return func(d *Downloader) {
+		d.spanHooks = start
+	}
+}
+
+// startSpan starts the span for a download to fileloc, the returned function
+// must be called with its result
+func (d *Downloader) startSpan(fileloc string, spec *RequestSpec) (context.Context, func(DownloadResult, error)) {
+	ctx := context.WithValue(context.Background(), metaKey{}, spec.Meta)
+	if d.spanHooks == nil {
+		return ctx, func(DownloadResult, error) {}
+	}
+
+	ctx, end := d.spanHooks(ctx, SpanInfo{URL: spec.URL, Path: fileloc, Meta: spec.Meta})
+	if end == nil {
+		end = func(DownloadResult, error) {}
+	}
+	return ctx, end
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type spanKey struct{}
+
+// span is what a test's SpanHooks saw of one download
+type span struct {
+	info  SpanInfo
+	ended int
+	res   DownloadResult
+	err   error
+}
+
+func TestSpanHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+	missing, _ := url.Parse(srv.URL + "/missing")
+	dir := t.TempDir()
+
+	var mu sync.Mutex
+	var spans []*span
+	var untraced int
+	d := New(WithLogger(quietLogger()),
+		WithSpanHooks(func(ctx context.Context, info SpanInfo) (context.Context, func(DownloadResult, error)) {
+			s := &span{info: info}
+			mu.Lock()
+			spans = append(spans, s)
+			mu.Unlock()
+			return context.WithValue(ctx, spanKey{}, s), func(res DownloadResult, err error) {
+				mu.Lock()
+				s.ended++
+				s.res, s.err = res, err
+				mu.Unlock()
+			}
+		}),
+		WithRequestHook(func(req *http.Request) error {
+			if req.Context().Value(spanKey{}) == nil {
+				mu.Lock()
+				untraced++
+				mu.Unlock()
+			}
+			return nil
+		}),
+	)
+
+	dest := filepath.Join(dir, "file")
+	if _, err := d.Download(dest, &RequestSpec{URL: u, Meta: "m"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Download(dest, &RequestSpec{URL: u}); err != nil {
+		t.Fatal(err)
+	}
+	_, ferr := d.Download(filepath.Join(dir, "missing"), &RequestSpec{URL: missing})
+	if ferr == nil {
+		t.Fatal("downloaded a 404")
+	}
+
+	if len(spans) != 3 {
+		t.Fatalf("started %d spans, want 3", len(spans))
+	}
+	if untraced != 0 {
+		t.Errorf("%d requests weren't made with the span's context", untraced)
+	}
+	for i, s := range spans {
+		if s.ended != 1 {
+			t.Errorf("span %d ended %d times", i, s.ended)
+		}
+	}
+
+	if s := spans[0]; s.info.URL != u || s.info.Path != dest || s.info.Meta != "m" || s.err != nil || s.res.Outcome != Downloaded || s.res.Written != 6 {
+		t.Errorf("downloaded: span %+v", s)
+	}
+	if s := spans[1]; s.err != nil || s.res.Outcome != SkippedSameSize {
+		t.Errorf("skipped: span %+v", s)
+	}
+	if s := spans[2]; s.info.URL != missing || s.err != ferr {
+		t.Errorf("failed: span %+v, want the error %v", s, ferr)
+	}
+}
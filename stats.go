@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// stats counts what a Downloader has done, the fields are updated atomically
+type stats struct {
+	bytesDownloaded  int64
+	downloadsStarted int64
+	downloadsFailed  int64
+	downloadsSkipped int64
+	retries          int64
+	activeDownloads  int64
+}
+
+// EnableExpvar publishes the dl package's counters with expvar, see Downloader.PublishExpvar
+func EnableExpvar() {
+	std.PublishExpvar("dl.")
+}
+
+// PublishExpvar publishes the counters of d with expvar under prefix, so a
+// prefix of "dl." gives dl.bytesDownloaded, dl.downloadsStarted,
+// dl.downloadsFailed, dl.downloadsSkipped, dl.retries and
+// dl.activeDownloads. They count every download made by d, whether it was
+// one call or part of a batch. Names that are already published are left
+// alone, so it is safe to call more than once.
+func (d *Downloader) PublishExpvar(prefix string) {
+	vars := map[string]*int64{
+		"bytesDownloaded":  &d.stats.bytesDownloaded,
+		"downloadsStarted": &d.stats.downloadsStarted,
+		"downloadsFailed":  &d.stats.downloadsFailed,
+		"downloadsSkipped": &d.stats.downloadsSkipped,
+		"retries":          &d.stats.retries,
+		"activeDownloads":  &d.stats.activeDownloads,
+	}
+	for name, v := range vars {
+		if expvar.Get(prefix+name) != nil {
+			continue
+		}
+		v := v
+		expvar.Publish(prefix+name, expvar.Func(func() interface{} {
+			return atomic.LoadInt64(v)
+		}))
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"expvar"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+// expvarInt reads the counter published as name
+func expvarInt(t *testing.T, name string) int64 {
+	t.Helper()
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatalf("%s isn't published", name)
+	}
+	return v.(expvar.Func)().(int64)
+}
+
+func TestEnableExpvar(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+	missing, _ := url.Parse(srv.URL + "/missing")
+	dir := t.TempDir()
+
+	EnableExpvar()
+	EnableExpvar()
+	names := []string{"bytesDownloaded", "downloadsStarted", "downloadsFailed", "downloadsSkipped", "retries", "activeDownloads"}
+	before := map[string]int64{}
+	for _, name := range names {
+		before[name] = expvarInt(t, "dl."+name)
+	}
+
+	dest := filepath.Join(dir, "file")
+	if _, err := Download(dest, &RequestSpec{URL: u}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Download(dest, &RequestSpec{URL: u}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Download(filepath.Join(dir, "missing"), &RequestSpec{URL: missing}); err == nil {
+		t.Fatal("downloaded a 404")
+	}
+
+	// The 404 gets past the size check, so it starts and then fails
+	want := map[string]int64{
+		"bytesDownloaded":  6,
+		"downloadsStarted": 2,
+		"downloadsFailed":  1,
+		"downloadsSkipped": 1,
+		"retries":          0,
+		"activeDownloads":  0,
+	}
+	for _, name := range names {
+		if got := expvarInt(t, "dl."+name) - before[name]; got != want[name] {
+			t.Errorf("dl.%s went up by %d, want %d", name, got, want[name])
+		}
+	}
+}
+
+func TestPublishExpvarRetries(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 1000)
+	u, _ := newDropServer(t, body, 4000)
+
+	d := New(WithLogger(quietLogger()), fastRetries)
+	d.PublishExpvar("dltest.retries.")
+	dest := filepath.Join(t.TempDir(), "file")
+	if _, err := d.DownloadFileRetry(dest, u, nil, nil, 3); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(dest); !bytes.Equal(b, body) {
+		t.Fatal("the file doesn't match the body")
+	}
+
+	if got := expvarInt(t, "dltest.retries.retries"); got != 1 {
+		t.Errorf("retries = %d, want 1", got)
+	}
+	if got := expvarInt(t, "dltest.retries.downloadsStarted"); got != 1 {
+		t.Errorf("downloadsStarted = %d, want 1", got)
+	}
+	if got := expvarInt(t, "dltest.retries.bytesDownloaded"); got != int64(len(body)) {
+		t.Errorf("bytesDownloaded = %d, want %d", got, len(body))
+	}
+	if got := expvarInt(t, "dltest.retries.activeDownloads"); got != 0 {
+		t.Errorf("activeDownloads = %d, want 0", got)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// storeName matches the names of the entries of a Store
+var storeName = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Store is a content addressed store of downloads, each kept once under its
+// SHA-256 and hardlinked to wherever it was downloaded to. Downloads in a
+// batch whose SHA-256 is already in the store are linked from it without
+// being downloaded again.
+type Store struct {
+	Dir string
+}
+
+// NewStore returns a Store keeping its content in dir
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+// SetStore sets the store the dl package keeps downloads in, see WithStore
+func SetStore(s *Store) {
+	WithStore(s)(std)
+}
+
+// WithStore keeps every download in s. The store should be on the same
+// filesystem as the downloads, otherwise content is copied instead of linked.
+// It only applies to downloads written with OSFS, and nil turns it off.
+func WithStore(s *Store) Option {
+	return func(d *Downloader) {
+		d.store = s
+	}
+}
+
+// Path returns where the content with the hex encoded SHA-256 sum is kept
+func (s *Store) Path(sum string) string {
+	return filepath.Join(s.Dir, sum)
+}
+
+// Has reports whether the store has the content with the hex encoded SHA-256 sum
+func (s *Store) Has(sum string) bool {
+	_, err := os.Stat(s.Path(sum))
+	return err == nil
+}
+
+// Put adds the file at fileloc with the hex encoded SHA-256 sum to the store,
+// replacing it with a link to the stored copy if the store already has it
+func (s *Store) Put(fileloc, sum string) error {
+	stored := s.Path(sum)
+	if err := os.MkdirAll(s.Dir, os.FileMode(0775)); err != nil {
+		return err
+	}
+
+	err := os.Link(fileloc, stored)
+	switch {
+	case err == nil:
+		return nil
+	case os.IsExist(err):
+		return s.Link(sum, fileloc)
+	}
+
+	// Probably a different filesystem, so the store gets a copy
+	if err := copyFile(fileloc, stored); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Link puts the content with the hex encoded SHA-256 sum at dest, as a
+// hardlink if possible and a copy if not
+func (s *Store) Link(sum, dest string) error {
+	stored := s.Path(sum)
+	if a, err := os.Stat(dest); err == nil {
+		if b, err := os.Stat(stored); err == nil && os.SameFile(a, b) {
+			return nil
+		}
+	}
+
+	os.MkdirAll(filepath.Dir(dest), os.FileMode(0775))
+	tmp := dest + partSuffix
+	os.Remove(tmp)
+	if err := os.Link(stored, tmp); err != nil {
+		if err := copyFile(stored, tmp); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// GC removes the content that isn't at any of the referenced paths, returning
+// how many entries were removed
+func (s *Store) GC(referenced []string) (int, error) {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return 0, err
+	}
+
+	keep := make(map[string]bool)
+	var unlinked []string
+	for _, p := range referenced {
+		ref, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+
+		linked := false
+		for _, info := range infos {
+			if storeName.MatchString(info.Name()) && os.SameFile(ref, info) {
+				keep[info.Name()] = true
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			unlinked = append(unlinked, p)
+		}
+	}
+
+	// Copies have to be hashed to tell what they hold
+	for _, p := range unlinked {
+		sum, err := hashFile(OSFS{}, p, "sha256")
+		if err != nil {
+			return 0, err
+		}
+		keep[sum] = true
+	}
+
+	removed := 0
+	for _, info := range infos {
+		if !storeName.MatchString(info.Name()) || keep[info.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.Dir, info.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// copyFile copies src to a new file at dst, written atomically
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile(filepath.Dir(dst), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), dst)
+	}
+	return err
+}
+
+// storeResult adds a finished download to the store
+func (d *Downloader) storeResult(fileloc string) {
+	if _, ok := d.fs.(OSFS); !ok {
+		return
+	}
+
+	sum, err := d.fileHash(fileloc, "sha256")
+	if err == nil {
+		err = d.store.Put(fileloc, sum)
+	}
+	if err != nil {
+		d.log.Warnf("Could not store %s: %v\n", fileloc, err)
+	}
+}
+
+// linkFromStore puts the content with the hex encoded SHA-256 sum at dest if
+// the store has it, reporting whether it did
+func (d *Downloader) linkFromStore(sum, dest string) bool {
+	if d.store == nil || sum == "" || !d.store.Has(sum) {
+		return false
+	}
+	if _, ok := d.fs.(OSFS); !ok {
+		return false
+	}
+
+	if err := d.store.Link(sum, dest); err != nil {
+		d.log.Warnf("Could not link %s from the store: %v\n", dest, err)
+		return false
+	}
+	d.log.Infof("Linked %s from the store\n", filepath.Base(dest))
+	return true
+}
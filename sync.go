@@ -0,0 +1,209 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// BlockList is the list of block checksums SyncFile compares a local file
+// with. It is served as JSON like
+//
+//	{"size": 10485760, "block_size": 1048576, "hash": "sha256", "blocks": ["9f86d0...", ...]}
+type BlockList struct {
+	// Size is the size of the whole file
+	Size      int64 `json:"size"`
+	BlockSize int64 `json:"block_size"`
+	// Hash is the algorithm the blocks are hashed with, sha256 if empty
+	Hash string `json:"hash"`
+	// Blocks are the hex encoded checksums of each block, the last of which
+	// may be short
+	Blocks []string `json:"blocks"`
+}
+
+// SyncFile will bring fileloc up to date with the url by downloading only the blocks that changed, see Downloader.SyncFile
+func SyncFile(fileloc string, u, blockListURL *url.URL, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	return std.SyncFile(fileloc, u, blockListURL, headers, cookies)
+}
+
+// SyncFile will bring fileloc up to date with the url, downloading only the
+// blocks of it that differ from the BlockList served at blockListURL with
+// Range requests. The unchanged blocks are copied from the old file, so the
+// file is replaced in one go once the new copy is complete. A missing file is
+// downloaded whole. It returns how many bytes were downloaded.
+func (d *Downloader) SyncFile(fileloc string, u, blockListURL *url.URL, headers map[string]string, cookies *[]*http.Cookie) (int64, error) {
+	body, err := d.GetBodyFromURL(blockListURL, headers, cookies)
+	if err != nil {
+		return 0, err
+	}
+
+	list := &BlockList{}
+	if err := json.Unmarshal(body, list); err != nil {
+		return 0, fmt.Errorf("dl: reading block list %s: %w", blockListURL.Redacted(), err)
+	}
+	if list.Hash == "" {
+		list.Hash = "sha256"
+	}
+	if list.BlockSize <= 0 || int64(len(list.Blocks)) != (list.Size+list.BlockSize-1)/list.BlockSize {
+		return 0, fmt.Errorf("dl: block list %s doesn't cover %d bytes", blockListURL.Redacted(), list.Size)
+	}
+	if _, err := newHash(list.Hash); err != nil {
+		return 0, err
+	}
+
+	old, err := d.fs.OpenFile(fileloc, os.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		return d.DownloadFile(fileloc, u, headers, cookies)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer old.Close()
+
+	part := fileloc + partSuffix
+	out, err := d.fs.Create(part)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	fetched, err := d.syncBlocks(out, old, list, newSpec(u, headers, cookies))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = d.fs.Rename(part, fileloc)
+	}
+	if err != nil {
+		d.fs.Remove(part)
+		return fetched, err
+	}
+
+	d.log.Infof("Synced %s (%s of %s downloaded)\n", filepath.Base(fileloc), humanize.Bytes(uint64(fetched)), humanize.Bytes(uint64(list.Size)))
+	return fetched, nil
+}
+
+// syncBlocks writes the file described by list to out, reading the blocks
+// that match from old and downloading the rest
+func (d *Downloader) syncBlocks(out io.Writer, old io.Reader, list *BlockList, spec *RequestSpec) (int64, error) {
+	buf := make([]byte, list.BlockSize)
+	var fetched int64
+
+	// Runs of changed blocks are collected and downloaded in one request
+	var pending []int
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		n, err := d.fetchBlocks(out, list, spec, pending)
+		fetched += n
+		pending = pending[:0]
+		return err
+	}
+
+	for i, want := range list.Blocks {
+		size := blockSize(list, i)
+		n, _ := io.ReadFull(old, buf[:size])
+
+		if int64(n) == size {
+			h, _ := newHash(list.Hash)
+			h.Write(buf[:size])
+			if hex.EncodeToString(h.Sum(nil)) == want {
+				if err := flush(); err != nil {
+					return fetched, err
+				}
+				if _, err := out.Write(buf[:size]); err != nil {
+					return fetched, err
+				}
+				continue
+			}
+		}
+		pending = append(pending, i)
+	}
+	return fetched, flush()
+}
+
+// fetchBlocks downloads the consecutive blocks and writes them to out,
+// checking each against the list
+func (d *Downloader) fetchBlocks(out io.Writer, list *BlockList, spec *RequestSpec, blocks []int) (int64, error) {
+	start := int64(blocks[0]) * list.BlockSize
+	end := int64(blocks[len(blocks)-1])*list.BlockSize + blockSize(list, blocks[len(blocks)-1]) - 1
+
+	req, err := d.newRequest(spec)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := d.do(req)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkStatus(resp); err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("dl: %s ignored Range, can't sync", spec.URL.Redacted())
+	}
+
+	var fetched int64
+	for _, i := range blocks {
+		block := make([]byte, blockSize(list, i))
+		n, err := io.ReadFull(resp.Body, block)
+		fetched += int64(n)
+		if err != nil {
+			return fetched, &transferError{err}
+		}
+
+		h, _ := newHash(list.Hash)
+		h.Write(block)
+		if got := hex.EncodeToString(h.Sum(nil)); got != list.Blocks[i] {
+			return fetched, &ChecksumMismatchError{
+				Path:      fmt.Sprintf("block %d of %s", i, spec.URL.Redacted()),
+				Algorithm: list.Hash,
+				Expected:  list.Blocks[i],
+				Actual:    got,
+			}
+		}
+		if _, err := io.Copy(out, bytes.NewReader(block)); err != nil {
+			return fetched, err
+		}
+	}
+	return fetched, nil
+}
+
+// blockSize returns the size of block i of the list
+func blockSize(list *BlockList, i int) int64 {
+	if rest := list.Size - int64(i)*list.BlockSize; rest < list.BlockSize {
+		return rest
+	}
+	return list.BlockSize
+}
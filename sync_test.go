@@ -0,0 +1,85 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncFile(t *testing.T) {
+	const blockSize = 1000
+	remote := testBody(4500)
+	local := append([]byte(nil), remote...)
+	// Only the third block differs
+	for i := 2 * blockSize; i < 3*blockSize; i++ {
+		local[i] ^= 0xff
+	}
+	list := BlockList{Size: int64(len(remote)), BlockSize: blockSize, Blocks: blockHashes(remote, blockSize)}
+
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file.blocks" {
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(remote))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/file")
+	listURL, _ := url.Parse(srv.URL + "/file.blocks")
+
+	dest := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(dest, local, 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := New().SyncFile(dest, u, listURL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); !bytes.Equal(got, remote) {
+		t.Fatal("synced file doesn't match")
+	}
+	if n != blockSize {
+		t.Errorf("downloaded %d bytes, want %d", n, blockSize)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=2000-2999" {
+		t.Errorf("requested %q", ranges)
+	}
+
+	// Now it's up to date nothing is fetched
+	ranges = nil
+	if n, err = New().SyncFile(dest, u, listURL, nil, nil); err != nil || n != 0 || len(ranges) != 0 {
+		t.Fatalf("second sync downloaded %d bytes in %q: %v", n, ranges, err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DownloadTemp will download the url to a new temporary file, see Downloader.DownloadTemp
+func DownloadTemp(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (string, *DownloadResult, error) {
+	return std.DownloadTemp(u, headers, cookies)
+}
+
+// DownloadTemp will download the url to a new file in the system's temporary
+// directory on the Downloader's filesystem and return its path, for when the
+// file's final name isn't known until it has been downloaded. The result's
+// Filename is the name the server suggested, if any. The caller is
+// responsible for renaming or removing the file, which is removed already if
+// the download fails.
+func (d *Downloader) DownloadTemp(u *url.URL, headers map[string]string, cookies *[]*http.Cookie) (string, *DownloadResult, error) {
+	tmp, err := d.tempFile(os.TempDir(), "dl-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The empty file only holds the name, so it mustn't be taken as up to date
+	t := newTransfer(tmp, newSpec(u, headers, cookies))
+	t.fresh = true
+	res, err := d.fetchTransfer(t, 1)
+	if err != nil {
+		d.fs.Remove(tmp)
+		return "", &res, err
+	}
+	return res.Path, &res, nil
+}
+
+// tempFile creates a new empty file in dir on the Downloader's filesystem
+// whose name starts with prefix, and returns its path
+func (d *Downloader) tempFile(dir, prefix string) (string, error) {
+	d.fs.MkdirAll(dir, os.FileMode(0775))
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := d.fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) && i < 10000 {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		f.Close()
+		return name, nil
+	}
+}
+
+// dispositionFilename returns the file name suggested by the
+// Content-Disposition header, without any directories
+func dispositionFilename(h http.Header) string {
+	_, params, err := mime.ParseMediaType(h.Get("Content-Disposition"))
+	if err != nil || params["filename"] == "" {
+		return ""
+	}
+
+	name := filepath.Base(filepath.FromSlash(params["filename"]))
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return ""
+	}
+	return name
+}
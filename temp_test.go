@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDownloadTemp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="../report.csv"`)
+		w.Write([]byte("a,b,c"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	path, res, err := New().DownloadTemp(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	if got, _ := ioutil.ReadFile(path); string(got) != "a,b,c" {
+		t.Fatalf("got %q, want a,b,c", got)
+	}
+	if filepath.Dir(path) != filepath.Clean(os.TempDir()) || !strings.HasPrefix(filepath.Base(path), "dl-") {
+		t.Fatalf("temp file at %s", path)
+	}
+	if res.Path != path || res.Filename != "report.csv" || res.StatusCode != http.StatusOK || res.Written != 5 {
+		t.Fatalf("got result %+v", res)
+	}
+}
+
+func TestDownloadTempEmpty(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Header().Set("Content-Length", "0")
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	// The empty file holding the name is neither probed nor skipped
+	fs := newMemFS()
+	d := New(WithFilesystem(fs), WithSkipFunc(func(string, os.FileInfo, *http.Response) bool { return true }))
+	path, res, err := d.DownloadTemp(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 || res.Outcome != Downloaded || res.StatusCode != http.StatusOK {
+		t.Fatalf("got %v with status %d after %d requests, want one download", res.Outcome, res.StatusCode, requests)
+	}
+	if _, ok := fs.contents(path); !ok {
+		t.Fatal("temp file isn't on the Downloader's filesystem")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("temp file was created on disk")
+	}
+}
+
+func TestDownloadTempFailed(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	fs := newMemFS()
+	path, _, err := New(WithFilesystem(fs)).DownloadTemp(u, nil, nil)
+	if err == nil || path != "" {
+		t.Fatalf("got %q and %v, want an error", path, err)
+	}
+	if len(fs.files) != 0 {
+		t.Fatalf("left %d files behind", len(fs.files))
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultDialTimeout is how long connecting to a server may take unless
+// WithDialTimeout says otherwise
+const DefaultDialTimeout = 30 * time.Second
+
+var (
+	// ErrDialTimeout is what a TimeoutError is for when connecting took too long
+	ErrDialTimeout = errors.New("dl: timed out connecting")
+	// ErrTLSHandshakeTimeout is what a TimeoutError is for when the TLS
+	// handshake took too long
+	ErrTLSHandshakeTimeout = errors.New("dl: timed out in TLS handshake")
+	// ErrResponseHeaderTimeout is what a TimeoutError is for when the server
+	// took too long to start responding
+	ErrResponseHeaderTimeout = errors.New("dl: timed out waiting for response headers")
+	// ErrDownloadTimeout is what a TimeoutError is for when a whole download
+	// took longer than WithDownloadTimeout allows
+	ErrDownloadTimeout = errors.New("dl: download timed out")
+)
+
+// TimeoutError is returned when one of the Downloader's timeouts is reached.
+// errors.Is reports which with ErrDialTimeout, ErrTLSHandshakeTimeout,
+// ErrResponseHeaderTimeout or ErrDownloadTimeout.
+type TimeoutError struct {
+	Timeout error
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return e.Timeout.Error() + ": " + e.Err.Error()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == e.Timeout
+}
+
+// SetDialTimeout limits how long the dl package takes to connect, see WithDialTimeout
+func SetDialTimeout(timeout time.Duration) {
+	WithDialTimeout(timeout)(std)
+}
+
+// WithDialTimeout limits how long connecting to a server may take, including
+// looking up its address. Zero means DefaultDialTimeout.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		d.dialTimeout = timeout
+		d.mu.Unlock()
+		d.installDialer()
+	}
+}
+
+// SetTLSHandshakeTimeout limits how long the dl package's TLS handshakes
+// take, see WithTLSHandshakeTimeout
+func SetTLSHandshakeTimeout(timeout time.Duration) {
+	WithTLSHandshakeTimeout(timeout)(std)
+}
+
+// WithTLSHandshakeTimeout limits how long a TLS handshake may take once
+// connected, zero means no limit
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(d *Downloader) {
+		t := d.transport()
+		if t == nil {
+			return
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		t.TLSHandshakeTimeout = timeout
+		if d.http1 != nil {
+			d.http1.TLSHandshakeTimeout = timeout
+		}
+	}
+}
+
+// SetResponseHeaderTimeout limits how long the dl package waits for a
+// response, see WithResponseHeaderTimeout
+func SetResponseHeaderTimeout(timeout time.Duration) {
+	WithResponseHeaderTimeout(timeout)(std)
+}
+
+// WithResponseHeaderTimeout limits how long the server may take to send the
+// headers of its response once the request has been sent, zero means no
+// limit. Reading the body isn't limited by it, so it fails a server that
+// doesn't respond quickly without cutting off a long download.
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return func(d *Downloader) {
+		t := d.transport()
+		if t == nil {
+			return
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		t.ResponseHeaderTimeout = timeout
+		if d.http1 != nil {
+			d.http1.ResponseHeaderTimeout = timeout
+		}
+	}
+}
+
+// SetDownloadTimeout limits how long each download of the dl package takes,
+// see WithDownloadTimeout
+func SetDownloadTimeout(timeout time.Duration) {
+	WithDownloadTimeout(timeout)(std)
+}
+
+// WithDownloadTimeout limits how long a whole download may take, including
+// every attempt and the waits between them, zero means no limit. Unlike the
+// client's Timeout it is only applied to downloads to a file, not the other
+// requests the Downloader makes.
+func WithDownloadTimeout(timeout time.Duration) Option {
+	return func(d *Downloader) {
+		d.downloadTimeout = timeout
+	}
+}
+
+// withDownloadTimeout returns ctx limited by the Downloader's download
+// timeout, and a function to call with the download's error once it is over
+// that cancels the context and returns the error to report
+func (d *Downloader) withDownloadTimeout(ctx context.Context) (context.Context, func(error) error) {
+	if d.downloadTimeout <= 0 {
+		return ctx, func(err error) error { return err }
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.downloadTimeout)
+	return ctx, func(err error) error {
+		defer cancel()
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			return &TimeoutError{Timeout: ErrDownloadTimeout, Err: err}
+		}
+		return err
+	}
+}
+
+// timeoutError returns err as a TimeoutError if it is from the transport
+// giving up on a TLS handshake or waiting for response headers. The http
+// package doesn't export those errors, so they are recognized by their text.
+func timeoutError(err error) error {
+	var ue *url.Error
+	var ne net.Error
+	if !errors.As(err, &ue) || !errors.As(err, &ne) || !ne.Timeout() {
+		return err
+	}
+
+	switch msg := ue.Err.Error(); {
+	case strings.Contains(msg, "TLS handshake timeout"):
+		ue.Err = &TimeoutError{Timeout: ErrTLSHandshakeTimeout, Err: ue.Err}
+	case strings.Contains(msg, "timeout awaiting response headers"):
+		ue.Err = &TimeoutError{Timeout: ErrResponseHeaderTimeout, Err: ue.Err}
+	}
+	return err
+}
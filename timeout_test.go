@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimeouts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-headers" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("x"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	// A listener that never answers a TLS handshake
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				break
+			}
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	// A resolver that never answers, so connecting takes as long as it's
+	// allowed to
+	hanging := &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+
+	timeouts := []error{ErrDialTimeout, ErrTLSHandshakeTimeout, ErrResponseHeaderTimeout, ErrDownloadTimeout}
+	for _, tc := range []struct {
+		name string
+		url  string
+		opt  Option
+		want error
+	}{
+		{"dial", "http://unresolvable.example/f", func(d *Downloader) {
+			WithResolver(hanging)(d)
+			WithDialTimeout(50 * time.Millisecond)(d)
+		}, ErrDialTimeout},
+		{"tls handshake", "https://" + silent.Addr().String() + "/f", WithTLSHandshakeTimeout(50 * time.Millisecond), ErrTLSHandshakeTimeout},
+		{"response headers", srv.URL + "/slow-headers", WithResponseHeaderTimeout(50 * time.Millisecond), ErrResponseHeaderTimeout},
+		{"download", srv.URL + "/slow-body", WithDownloadTimeout(100 * time.Millisecond), ErrDownloadTimeout},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u, _ := url.Parse(tc.url)
+			d := New(WithLogger(quietLogger()), fastRetries, tc.opt)
+			start := time.Now()
+			_, err := d.DownloadFileRetry(filepath.Join(t.TempDir(), "f"), u, nil, nil, 3)
+			if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+				t.Errorf("took %v", elapsed)
+			}
+
+			var te *TimeoutError
+			if !errors.As(err, &te) {
+				t.Fatalf("got %v, want a TimeoutError", err)
+			}
+			for _, timeout := range timeouts {
+				if errors.Is(err, timeout) != (timeout == tc.want) {
+					t.Errorf("errors.Is(%v, %v) = %v", err, timeout, !(timeout == tc.want))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SetTranscript makes the dl package log every request it sends to w, see WithTranscript
+func SetTranscript(w io.Writer) {
+	WithTranscript(w)(std)
+}
+
+// WithTranscript writes an entry for every HTTP request sent and the response
+// to it to w as a line of JSON, including each redirect that is followed and
+// each retry. Entries are laid out like the entries of a HAR file, with the
+// method, URL, headers, status and how long the response took to arrive.
+// Bodies aren't recorded, and neither are credentials: the values of
+// Authorization, Proxy-Authorization, Cookie and Set-Cookie headers are
+// replaced with "[redacted]", as are passwords in URLs. nil stops it.
+func WithTranscript(w io.Writer) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if w == nil {
+			d.transcript = nil
+			return
+		}
+		d.transcript = &transcript{enc: json.NewEncoder(w)}
+	}
+}
+
+// transcript writes entries to its encoder one at a time
+type transcript struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// harEntry is an entry of a transcript
+type harEntry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	// Time is how long the response took to arrive in milliseconds
+	Time     float64      `json:"time"`
+	Request  harRequest   `json:"request"`
+	Response *harResponse `json:"response,omitempty"`
+	Error    string       `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	RedirectURL string      `json:"redirectURL"`
+	// BodySize is the Content-Length of the response, -1 if it isn't known
+	BodySize int64 `json:"bodySize"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harHeaders lists h in a stable order with credentials redacted
+func harHeaders(h http.Header) []harHeader {
+	var keys []string
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	headers := []harHeader{}
+	for _, k := range keys {
+		for _, v := range h[k] {
+			switch http.CanonicalHeaderKey(k) {
+			case "Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie":
+				v = "[redacted]"
+			}
+			headers = append(headers, harHeader{Name: k, Value: v})
+		}
+	}
+	return headers
+}
+
+// transcriptTransport records the requests sent through base
+type transcriptTransport struct {
+	base       http.RoundTripper
+	transcript *transcript
+}
+
+func (t *transcriptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := harEntry{
+		StartedDateTime: time.Now(),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.Redacted(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header),
+		},
+	}
+	if req.Host != "" && req.Host != req.URL.Host {
+		entry.Request.Headers = append(entry.Request.Headers, harHeader{Name: "Host", Value: req.Host})
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	entry.Time = float64(time.Since(entry.StartedDateTime)) / float64(time.Millisecond)
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Response = &harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Headers:     harHeaders(resp.Header),
+			RedirectURL: resp.Header.Get("Location"),
+			BodySize:    resp.ContentLength,
+		}
+	}
+
+	t.transcript.mu.Lock()
+	t.transcript.enc.Encode(entry)
+	t.transcript.mu.Unlock()
+	return resp, err
+}
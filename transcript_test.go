@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscript(t *testing.T) {
+	srv := newRedirectServer(t)
+	var buf bytes.Buffer
+	d := New(WithTranscript(&buf), WithLogger(quietLogger()))
+
+	u, _ := url.Parse(srv.URL + "/1")
+	u.User = url.UserPassword("user", "hunter2")
+	cookies := []*http.Cookie{{Name: "session", Value: "secret"}}
+	if _, err := d.DownloadFile(filepath.Join(t.TempDir(), "file"), u, nil, &cookies); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("hunter2")) || bytes.Contains(buf.Bytes(), []byte("secret")) {
+		t.Errorf("transcript has credentials:\n%s", buf.Bytes())
+	}
+
+	want := []struct {
+		path     string
+		status   int
+		redirect string
+	}{
+		{"/1", 302, "/2"},
+		{"/2", 301, "/3"},
+		{"/3", 307, "/file"},
+		{"/file", 200, ""},
+	}
+	dec := json.NewDecoder(&buf)
+	for _, w := range want {
+		var e harEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("%s: %v", w.path, err)
+		}
+		eu, _ := url.Parse(e.Request.URL)
+		if e.Request.Method != "GET" || eu.Path != w.path {
+			t.Errorf("request %s %s, want GET %s", e.Request.Method, e.Request.URL, w.path)
+		}
+		if e.Response == nil || e.Response.Status != w.status || e.Response.RedirectURL != w.redirect {
+			t.Errorf("%s: response %+v", w.path, e.Response)
+			continue
+		}
+		if w.status == 200 && e.Response.BodySize != 2 {
+			t.Errorf("%s: body size %d", w.path, e.Response.BodySize)
+		}
+		if e.StartedDateTime.IsZero() || e.Time < 0 {
+			t.Errorf("%s: timing %v %v", w.path, e.StartedDateTime, e.Time)
+		}
+	}
+	if dec.More() {
+		t.Error("more entries than requests")
+	}
+}
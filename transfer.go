@@ -0,0 +1,383 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// partSuffix is appended to the destination of a download while it is in progress
+const partSuffix = ".part"
+
+// transfer is the state of a download that is kept between attempts
+type transfer struct {
+	// dest is where the download was asked to go, and fileloc where it is
+	// going once the path func has seen the response
+	dest    string
+	fileloc string
+	part    string
+	spec    *RequestSpec
+	// ctx is the context the requests are made with
+	ctx context.Context
+
+	// offset is how much of the file has been written to part
+	offset int64
+	// ifRange is the validator to resume with, and total the size of the
+	// whole file or -1 if it isn't known, both from the response the part
+	// file was started from
+	ifRange      string
+	total        int64
+	acceptRanges bool
+	// http1 is set once an HTTP/2 failure has made the download fall back
+	http1 bool
+	// refreshed is set once the URL has been refreshed
+	refreshed bool
+	// proto, status and header are from the last response
+	proto  string
+	status int
+	header http.Header
+	// digest is the digest header the download was verified against
+	digest *digestCheck
+	// blocks, if set, checks the download block by block
+	blocks *blockVerifier
+	// compression counts the bytes of compressed responses
+	compression compression
+	// budget, if set, limits the retries of the batch the download is in
+	budget *retryBudget
+	// keep saves the state of the download next to part, and keeps both if
+	// it fails in a way a later run could resume from
+	keep bool
+	// progress, if set, is called with the progress of this download
+	progress func(Progress)
+	// fresh downloads the file without checking whether the one on disk is
+	// up to date
+	fresh bool
+	// checksums are the algorithms and hex encoded checksums the file must
+	// have, checked once it is in place whether it was downloaded or skipped
+	checksums [][2]string
+	// verify, if set, checks a finished download before it is renamed into
+	// place, and a file on disk before it is skipped as up to date
+	verify func(fileloc string) error
+}
+
+func newTransfer(fileloc string, spec *RequestSpec) *transfer {
+	return &transfer{
+		dest:    fileloc,
+		fileloc: fileloc,
+		part:    fileloc + partSuffix,
+		spec:    spec,
+		ctx:     context.Background(),
+	}
+}
+
+// ErrValidatorMismatch is returned when a server resumes a download with a
+// range of a file that isn't the one the download started with
+var ErrValidatorMismatch = errors.New("dl: resumed range doesn't match the file")
+
+// ifRangeValidator returns the validator from h to send as If-Range when
+// resuming: a strong ETag, or without any ETag a Last-Modified that is strong
+// because it is at least a second before the response's Date. It returns ""
+// if there isn't one, in which case a download can't be resumed safely.
+func ifRangeValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" {
+		if strings.HasPrefix(etag, "W/") {
+			return ""
+		}
+		return etag
+	}
+
+	modified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return ""
+	}
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil || date.Sub(modified) < time.Second {
+		return ""
+	}
+	return h.Get("Last-Modified")
+}
+
+// checkResumed checks that resp, a 206 to a request to resume t, is the rest
+// of the file t started with
+func checkResumed(t *transfer, resp *http.Response) error {
+	if err := checkRangeStart(resp, t.offset); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrValidatorMismatch, t.spec.URL.Redacted(), err)
+	}
+
+	var start, end, total int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		// An unknown total, "*", can't be compared
+		return nil
+	}
+	if t.total >= 0 && total != t.total {
+		return fmt.Errorf("%w: %s is now %d bytes, was %d", ErrValidatorMismatch, t.spec.URL.Redacted(), total, t.total)
+	}
+	return nil
+}
+
+// transferError is an error reading the response body, as opposed to writing it out
+type transferError struct {
+	err error
+}
+
+func (e *transferError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transferError) Unwrap() error {
+	return e.err
+}
+
+// bodyReader marks errors reading from r as transferErrors
+type bodyReader struct {
+	r io.Reader
+}
+
+func (b bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &transferError{err}
+	}
+	return n, err
+}
+
+func (d *Downloader) writeToFileFromURL(t *transfer, attempts int) error {
+	fileloc := t.fileloc
+	for attempt := 1; ; attempt++ {
+		resp, err := d.attempt(t)
+		if err == nil {
+			if t.keep {
+				d.fs.Remove(t.part + stateSuffix)
+			}
+			return nil
+		}
+
+		if !t.refreshed {
+			spec, rerr := t.spec.refresh(t.ctx, err)
+			if rerr != nil {
+				d.discardPart(t, rerr)
+				return rerr
+			}
+			if spec != nil {
+				d.log.Infof("Retrying %s with a refreshed URL\n", filepath.Base(fileloc))
+				t.spec = spec
+				t.refreshed = true
+				attempt--
+				continue
+			}
+		}
+
+		if !t.http1 && d.httpVersion == HTTP2Fallback && isHTTP2Error(err) {
+			d.log.Warnf("Retrying %s over HTTP/1.1: %v\n", filepath.Base(fileloc), err)
+			t.http1 = true
+			attempt--
+			continue
+		}
+
+		if attempt >= attempts || t.ctx.Err() != nil || !d.shouldRetry(resp, err, attempt) {
+			d.discardPart(t, err)
+			return err
+		}
+
+		if !d.retry(t, filepath.Base(fileloc), attempt, err) {
+			d.discardPart(t, err)
+			return err
+		}
+		atomic.AddInt64(&d.stats.retries, 1)
+	}
+}
+
+// attempt makes one attempt at downloading t, resuming it if possible
+func (d *Downloader) attempt(t *transfer) (*http.Response, error) {
+	req, err := d.newRequest(t.spec)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(withCompression(t.ctx, &t.compression))
+	if t.http1 {
+		req = req.WithContext(withHTTP1(req.Context()))
+	}
+
+	ranged := req.Header.Get("Range") != ""
+	if t.offset > 0 && t.acceptRanges && t.ifRange != "" && !ranged {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", t.offset))
+		req.Header.Set("If-Range", t.ifRange)
+	} else {
+		if t.offset > 0 && !ranged {
+			d.log.Infof("Can't safely resume %s, starting over\n", filepath.Base(t.fileloc))
+		}
+		t.offset = 0
+		atomic.StoreInt64(&t.compression.compressed, 0)
+		atomic.StoreInt64(&t.compression.uncompressed, 0)
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+
+		return nil, err
+	}
+	t.proto = resp.Proto
+	t.status = resp.StatusCode
+	t.header = resp.Header.Clone()
+	if err := checkStatus(resp); err != nil {
+		return resp, err
+	}
+	if err := d.validate(resp); err != nil {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	size := d.contentLength(resp.Header)
+	if size < 0 {
+		d.log.Warnf("No usable Content-Length Header for %s\n", t.spec.URL.String())
+	}
+
+	if ranged && resp.StatusCode != http.StatusPartialContent {
+		d.log.Warnf("%s ignored Range %q, writing the whole response\n", t.spec.URL.String(), req.Header.Get("Range"))
+	}
+
+	resuming := t.offset > 0 && resp.StatusCode == http.StatusPartialContent
+	if resuming {
+		if err := checkResumed(t, resp); err != nil {
+			return resp, err
+		}
+	} else if t.offset > 0 {
+		// The file changed, so If-Range got the whole of it
+		d.log.Infof("%s changed since it was partly downloaded, starting over\n", t.spec.URL.Redacted())
+	}
+	// A caller's own Range makes the response a different size than the file
+	checkSize := t.spec.ExpectedSize > 0 && !(ranged && resp.StatusCode == http.StatusPartialContent)
+	if checkSize && size >= 0 {
+		total := size
+		if resuming {
+			total += t.offset
+		}
+		if total != t.spec.ExpectedSize {
+			return resp, fmt.Errorf("%w: %s is %d bytes, expected %d", ErrSizeMismatch, t.spec.URL.Redacted(), total, t.spec.ExpectedSize)
+		}
+	}
+
+	if t.spec.MinSize > 0 && !ranged && !resuming && size >= 0 && size < t.spec.MinSize {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp, tooSmall(t.spec.URL, size, t.spec.MinSize, body)
+	}
+
+	if !resuming {
+		d.choosePath(t, resp)
+		t.offset = 0
+		t.ifRange = ifRangeValidator(resp.Header)
+		t.total = size
+		t.acceptRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+		d.saveResumeState(t)
+		if t.blocks != nil {
+			t.blocks.reset()
+		}
+	}
+
+	var out File
+	if resuming {
+		out, err = d.fs.OpenFile(t.part, os.O_WRONLY|os.O_APPEND, os.FileMode(0775))
+		if err != nil {
+
+			return resp, err
+		}
+		defer out.Close()
+
+		d.log.Infof("Resuming %s at %s (%s left)\n", filepath.Base(t.fileloc), humanize.Bytes(uint64(t.offset)), sizeString(size))
+	} else {
+		d.fs.MkdirAll(filepath.Dir(t.fileloc), os.FileMode(0775))
+		out, err = d.fs.Create(t.part)
+		if err != nil {
+
+			return resp, err
+		}
+		defer out.Close()
+
+		d.log.Infof("Downloading %s (%s)\n", filepath.Base(t.fileloc), sizeString(size))
+	}
+
+	buf := d.getBuffer()
+	defer d.putBuffer(buf)
+
+	var dst io.Writer = out
+	check := d.newDigestCheck(resp)
+	if check != nil {
+		dst = io.MultiWriter(dst, check)
+	}
+	if t.blocks != nil {
+		dst = io.MultiWriter(dst, t.blocks)
+	}
+
+	n, err := copyBuffer(dst, bodyReader{d.newMeter(d.limitReader(t.ctx, resp.Body), t, size)}, *buf)
+	t.offset += n
+	if errors.Is(err, io.ErrUnexpectedEOF) && size >= 0 {
+		// Still a transferError, so it is retried and resumed like any other
+		err = &transferError{fmt.Errorf("%w: got %d of %d bytes of %s", ErrTruncated, n, size, t.spec.URL.Redacted())}
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	if t.blocks != nil {
+		if err := t.blocks.finish(); err != nil {
+			return resp, err
+		}
+	}
+	if checkSize && t.offset != t.spec.ExpectedSize {
+		return resp, fmt.Errorf("%w: wrote %d bytes of %s, expected %d", ErrSizeMismatch, t.offset, t.spec.URL.Redacted(), t.spec.ExpectedSize)
+	}
+	if t.spec.MinSize > 0 && !ranged && t.offset < t.spec.MinSize {
+		var body []byte
+		if f, err := d.fs.OpenFile(t.part, os.O_RDONLY, 0); err == nil {
+			body, _ = ioutil.ReadAll(io.LimitReader(f, maxErrorBody))
+			f.Close()
+		}
+		return resp, tooSmall(t.spec.URL, t.offset, t.spec.MinSize, body)
+	}
+
+	if check != nil {
+		if err := check.verify(t.fileloc); err != nil {
+			return resp, err
+		}
+		t.digest = check
+	}
+
+	if err := out.Close(); err != nil {
+		return resp, err
+	}
+	if t.verify != nil {
+		if err := t.verify(t.part); err != nil {
+			return resp, err
+		}
+	}
+	return resp, d.fs.Rename(t.part, t.fileloc)
+}
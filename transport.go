@@ -0,0 +1,185 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// DefaultMaxResponseHeaderBytes is the most response header bytes a new
+// Downloader's client will read before giving up on a response
+const DefaultMaxResponseHeaderBytes = 1 << 20
+
+// DefaultMinTLSVersion is the oldest TLS version a new Downloader's client
+// will connect with
+const DefaultMinTLSVersion = tls.VersionTLS12
+
+// newTransport returns the transport a new Downloader's client starts with
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxResponseHeaderBytes = DefaultMaxResponseHeaderBytes
+	t.TLSClientConfig = &tls.Config{MinVersion: DefaultMinTLSVersion}
+	return t
+}
+
+// SetMaxResponseHeaderBytes limits how many bytes of response headers the dl
+// package will read, zero means the http package's default
+func SetMaxResponseHeaderBytes(n int64) {
+	WithMaxResponseHeaderBytes(n)(std)
+}
+
+// WithMaxResponseHeaderBytes limits how many bytes of response headers the
+// Downloader will read, so a server can't exhaust memory with huge headers.
+// Zero means the http package's default.
+func WithMaxResponseHeaderBytes(n int64) Option {
+	return func(d *Downloader) {
+		t := d.transport()
+		if t == nil {
+			return
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		t.MaxResponseHeaderBytes = n
+		if d.http1 != nil {
+			d.http1.MaxResponseHeaderBytes = n
+		}
+	}
+}
+
+// transport returns the transport of the Downloader's client so it can be
+// configured, giving the client its own copy of http.DefaultTransport if it
+// doesn't have one. It returns nil if the client uses some other RoundTripper.
+func (d *Downloader) transport() *http.Transport {
+	if d.client.Transport == nil {
+		d.client.Transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+
+	t, ok := d.client.Transport.(*http.Transport)
+	if !ok {
+		d.log.Warnf("Can't configure client transport of type %T\n", d.client.Transport)
+		return nil
+	}
+	return t
+}
+
+// SetDisableAutoGzip stops the dl package's transport from asking for and
+// transparently decompressing gzip responses, see WithDisableAutoGzip
+func SetDisableAutoGzip(disable bool) {
+	WithDisableAutoGzip(disable)(std)
+}
+
+// WithDisableAutoGzip stops the transport from asking for gzip responses and
+// transparently decompressing them, so a body the server sends compressed is
+// written to disk exactly as sent. It doesn't change DownloadAndGunzip, which
+// decompresses a gzip file itself, but it does keep a server that compresses
+// a .gz file a second time from having that layer removed before it's saved.
+func WithDisableAutoGzip(disable bool) Option {
+	return func(d *Downloader) {
+		t := d.transport()
+		if t == nil {
+			return
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		t.DisableCompression = disable
+		if d.http1 != nil {
+			d.http1.DisableCompression = disable
+		}
+	}
+}
+
+// SetTLSServerName sets the name the dl package verifies TLS certificates
+// against, see WithTLSServerName
+func SetTLSServerName(name string) {
+	WithTLSServerName(name)(std)
+}
+
+// WithTLSServerName sets the name sent in the TLS handshake and that
+// certificates are verified against, in place of the host of the URL. The
+// connection is still made to the URL's host, and the Host header is
+// unchanged, so this is for connecting to an address that serves a
+// certificate for some other name. Together with a Host header it lets an
+// HTTPS download go straight to an IP address as if it were for a name.
+//
+// The name is used for every connection, including ones made to follow a
+// redirect to another host, whose certificate then has to be valid for this
+// name too. An empty name goes back to using the URL.
+func WithTLSServerName(name string) Option {
+	return func(d *Downloader) {
+		t := d.transport()
+		if t == nil {
+			return
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		setServerName(t, name)
+		if d.http1 != nil {
+			setServerName(d.http1, name)
+		}
+	}
+}
+
+func setServerName(t *http.Transport, name string) {
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	} else {
+		t.TLSClientConfig = t.TLSClientConfig.Clone()
+	}
+	t.TLSClientConfig.ServerName = name
+}
+
+// SetMinTLSVersion sets the oldest TLS version the dl package connects with,
+// see WithMinTLSVersion
+func SetMinTLSVersion(v uint16) {
+	WithMinTLSVersion(v)(std)
+}
+
+// WithMinTLSVersion sets the oldest TLS version the Downloader connects with,
+// such as tls.VersionTLS13, so a server that can't do better is refused. The
+// default is DefaultMinTLSVersion, zero means the tls package's default.
+func WithMinTLSVersion(v uint16) Option {
+	return func(d *Downloader) {
+		t := d.transport()
+		if t == nil {
+			return
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		setMinTLSVersion(t, v)
+		if d.http1 != nil {
+			setMinTLSVersion(d.http1, v)
+		}
+	}
+}
+
+func setMinTLSVersion(t *http.Transport, v uint16) {
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	} else {
+		t.TLSClientConfig = t.TLSClientConfig.Clone()
+	}
+	t.TLSClientConfig.MinVersion = v
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMaxResponseHeaderBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Big", strings.Repeat("a", 4096))
+		w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	if _, err := New(WithMaxResponseHeaderBytes(1024)).GetBodyFromURL(u, nil, nil); err == nil {
+		t.Fatal("oversized headers were accepted")
+	}
+
+	// The default cap is well above that
+	body, err := New().GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "body" {
+		t.Fatalf("got %q", body)
+	}
+}
+
+func TestDisableAutoGzip(t *testing.T) {
+	plain := strings.Repeat("hello world\n", 1000)
+	compressed := gzipped(plain)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Compressed whether or not it was asked for
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/hello.txt")
+	dir := t.TempDir()
+
+	dest := filepath.Join(dir, "raw")
+	if _, err := New(WithDisableAutoGzip(true)).DownloadFile(dest, u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); !bytes.Equal(got, compressed) {
+		t.Fatalf("got %d bytes, want the %d gzip bytes", len(got), len(compressed))
+	}
+
+	dest = filepath.Join(dir, "decoded")
+	if _, err := New().DownloadFile(dest, u, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(dest); string(got) != plain {
+		t.Fatalf("got %d bytes, want the %d decompressed bytes", len(got), len(plain))
+	}
+}
+
+// newSNIServer starts a TLS server with httptest's certificate, which is for
+// example.com and the loopback addresses, and returns a client that trusts it
+// and a function returning the server name of the last handshake
+func newSNIServer(t *testing.T) (*httptest.Server, *http.Client, func() string) {
+	var mu sync.Mutex
+	var sni string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(h *tls.ClientHelloInfo) (*tls.Config, error) {
+		mu.Lock()
+		sni = h.ServerName
+		mu.Unlock()
+		return nil, nil
+	}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	return srv, c, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return sni
+	}
+}
+
+func TestTLSServerName(t *testing.T) {
+	srv, c, sni := newSNIServer(t)
+
+	// The certificate isn't for localhost
+	u, _ := url.Parse(srv.URL)
+	u.Host = "localhost:" + u.Port()
+	if _, err := New(WithClient(c)).GetBodyFromURL(u, nil, nil); err == nil {
+		t.Fatal("expected a certificate error for localhost")
+	}
+
+	body, err := New(WithClient(c), WithTLSServerName("example.com")).GetBodyFromURL(u, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" || sni() != "example.com" {
+		t.Fatalf("got %q with server name %q", body, sni())
+	}
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	old := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	old.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}
+	old.StartTLS()
+	defer old.Close()
+	current := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer current.Close()
+
+	get := func(srv *httptest.Server, opts ...Option) error {
+		d := New(opts...)
+		d.transport().TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+		u, _ := url.Parse(srv.URL)
+		_, err := d.GetBodyFromURL(u, nil, nil)
+		return err
+	}
+
+	if err := get(old); err == nil {
+		t.Error("connected to a TLS 1.1 server by default")
+	}
+	if err := get(old, WithMinTLSVersion(tls.VersionTLS12)); err == nil {
+		t.Error("connected to a TLS 1.1 server with a minimum of TLS 1.2")
+	}
+	if err := get(old, WithMinTLSVersion(tls.VersionTLS10)); err != nil {
+		t.Errorf("minimum of TLS 1.0: %v", err)
+	}
+	if err := get(current, WithMinTLSVersion(tls.VersionTLS12)); err != nil {
+		t.Errorf("TLS 1.2 or later server: %v", err)
+	}
+}
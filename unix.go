@@ -0,0 +1,53 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+// SetUnixSocket sends the dl package's requests for host over a Unix socket,
+// see WithUnixSocket
+func SetUnixSocket(host, path string) {
+	WithUnixSocket(host, path)(std)
+}
+
+// WithUnixSocket connects to the Unix socket at path for URLs with the host
+// host, whatever their port, so a service that only listens on a socket can
+// be reached as http://host/path with all the usual features. The host is
+// still sent in the Host header. TLS over the socket isn't supported, so the
+// URLs should be http. An empty path removes the socket for host. Idle
+// connections are closed, so none made over the old socket are reused.
+func WithUnixSocket(host, path string) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		if path == "" {
+			delete(d.unixSockets, host)
+		} else {
+			if d.unixSockets == nil {
+				d.unixSockets = make(map[string]string)
+			}
+			d.unixSockets[host] = path
+		}
+		d.mu.Unlock()
+		d.installDialer()
+		d.client.CloseIdleConnections()
+		if d.http1 != nil {
+			d.http1.CloseIdleConnections()
+		}
+	}
+}
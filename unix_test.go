@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dl.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("can't listen on a Unix socket:", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.URL.Path))
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	// Private networks being blocked doesn't stop the socket being dialed
+	d := New(WithLogger(quietLogger()), WithBlockPrivateNetworks(), WithUnixSocket("sock.invalid", socket))
+	for _, tc := range []struct {
+		url  string
+		want string
+	}{
+		{"http://sock.invalid/file", "sock.invalid /file"},
+		{"http://sock.invalid:8080/other", "sock.invalid:8080 /other"},
+	} {
+		u, _ := url.Parse(tc.url)
+		dest := filepath.Join(t.TempDir(), "file")
+		if _, err := d.Download(dest, &RequestSpec{URL: u}); err != nil {
+			t.Errorf("%s: %v", tc.url, err)
+			continue
+		}
+		if b, _ := ioutil.ReadFile(dest); string(b) != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.url, b, tc.want)
+		}
+	}
+
+	// Without the socket the host has to be looked up, and it doesn't exist
+	WithUnixSocket("sock.invalid", "")(d)
+	u, _ := url.Parse("http://sock.invalid/file")
+	if _, err := d.Download(filepath.Join(t.TempDir(), "file"), &RequestSpec{URL: u}); err == nil {
+		t.Error("downloaded without the socket")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"sync/atomic"
+)
+
+// SetUserAgents sets user agents for the dl package to take turns sending,
+// see WithUserAgents
+func SetUserAgents(uas ...string) {
+	WithUserAgents(uas...)(std)
+}
+
+// WithUserAgents sends each of uas in turn as the user agent of successive
+// requests. With a single user agent it is the same as WithUserAgent, and
+// with none the user agent set by WithUserAgent is used.
+func WithUserAgents(uas ...string) Option {
+	return func(d *Downloader) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if len(uas) == 1 {
+			d.userAgent = uas[0]
+			d.userAgents = nil
+			return
+		}
+		d.userAgents = append([]string(nil), uas...)
+	}
+}
+
+// nextUserAgent returns the user agent to send with the next request
+func (d *Downloader) nextUserAgent() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.userAgents) == 0 {
+		return d.userAgent
+	}
+	n := atomic.AddUint32(&d.uaNext, 1) - 1
+	return d.userAgents[n%uint32(len(d.userAgents))]
+}
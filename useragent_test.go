@@ -0,0 +1,60 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"testing"
+)
+
+func TestUserAgents(t *testing.T) {
+	u := newEchoUAServer(t)
+	seen := func(d *Downloader, n int) []string {
+		var uas []string
+		for i := 0; i < n; i++ {
+			body, err := d.GetBodyFromURL(u, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uas = append(uas, string(body))
+		}
+		return uas
+	}
+
+	d := New(WithUserAgents("a/1", "b/2", "c/3"))
+	got := seen(d, 5)
+	want := []string{"a/1", "b/2", "c/3", "a/1", "b/2"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("server saw %q, want %q", got, want)
+		}
+	}
+
+	WithUserAgents("only/1")(d)
+	if got := seen(d, 2); got[0] != "only/1" || got[1] != "only/1" {
+		t.Errorf("single user agent: server saw %q", got)
+	}
+
+	WithUserAgents("a/1", "b/2")(d)
+	WithUserAgent("fixed/1")(d)
+	if got := seen(d, 2); got[0] != "fixed/1" || got[1] != "fixed/1" {
+		t.Errorf("after WithUserAgent: server saw %q", got)
+	}
+}
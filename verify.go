@@ -0,0 +1,148 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when a file doesn't have the checksum it is
+// supposed to
+var ErrChecksumMismatch = errors.New("dl: checksum mismatch")
+
+// VerifyResult is the outcome of checking one file against a checksum list
+type VerifyResult struct {
+	// Name is the name of the file in the checksum list
+	Name string
+	Path string
+	// Algorithm is the hash the file was checked with
+	Algorithm string
+	// Expected is the checksum from the list and Actual the checksum of the
+	// file, which is empty if it couldn't be read
+	Expected string
+	Actual   string
+	// Err is nil if the file matched, a ChecksumMismatchError if it didn't
+	// and os.ErrNotExist if it is missing
+	Err error
+}
+
+// VerifyBatch will check the files in dir against a SHA256SUMS file, see Downloader.VerifyBatch
+func VerifyBatch(dir string, sumsURL *url.URL, headers map[string]string, cookies *[]*http.Cookie) ([]VerifyResult, error) {
+	return std.VerifyBatch(dir, sumsURL, headers, cookies)
+}
+
+// VerifyBatch will download a SHA256SUMS style file from sumsURL and check
+// every file it lists against the copy in dir. Both the sha256sum format and
+// the BSD "SHA256 (name) = sum" format are understood, and the BSD format can
+// use any hash registered with RegisterHash. There is a result for
+// every listed file, and the error is non nil if any of them are missing or
+// don't match.
+func (d *Downloader) VerifyBatch(dir string, sumsURL *url.URL, headers map[string]string, cookies *[]*http.Cookie) ([]VerifyResult, error) {
+	body, err := d.GetBodyFromURL(sumsURL, headers, cookies)
+	if err != nil {
+		return nil, err
+	}
+
+	sums, err := parseSums(body)
+	if err != nil {
+		return nil, fmt.Errorf("dl: reading %s: %w", sumsURL.Redacted(), err)
+	}
+
+	results := make([]VerifyResult, len(sums))
+	failed := 0
+	for i, s := range sums {
+		res := &results[i]
+		res.Name = s.name
+		res.Algorithm = strings.ToLower(s.algo)
+		res.Expected = s.sum
+
+		name := filepath.FromSlash(s.name)
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			res.Err = fmt.Errorf("dl: %q is outside of %s", s.name, dir)
+			failed++
+			continue
+		}
+		res.Path = filepath.Join(dir, name)
+
+		res.Actual, res.Err = d.fileHash(res.Path, s.algo)
+		if res.Err == nil && !strings.EqualFold(res.Actual, res.Expected) {
+			res.Err = &ChecksumMismatchError{Path: res.Path, Algorithm: strings.ToLower(s.algo), Expected: res.Expected, Actual: res.Actual, Source: sumsURL.Redacted()}
+		}
+		if res.Err != nil {
+			d.log.Warnf("%s failed verification: %v\n", s.name, res.Err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("dl: %d of %d files failed verification", failed, len(results))
+	}
+	return results, nil
+}
+
+type sumLine struct {
+	name string
+	algo string
+	sum  string
+}
+
+// parseSums parses the lines of a SHA256SUMS file
+func parseSums(body []byte) ([]sumLine, error) {
+	var sums []sumLine
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var s sumLine
+		if open, end := strings.Index(line, " ("), strings.LastIndex(line, ") = "); open > 0 && end > open && !strings.ContainsAny(line[:open], " \t") {
+			s = sumLine{name: line[open+len(" (") : end], algo: line[:open], sum: line[end+len(") = "):]}
+		} else {
+			i := strings.IndexAny(line, " \t")
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: malformed checksum %q", n, line)
+			}
+			name := strings.TrimLeft(line[i:], " \t")
+			s = sumLine{name: strings.TrimPrefix(name, "*"), algo: "sha256", sum: line[:i]}
+		}
+
+		h, err := newHash(s.algo)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if _, err := hex.DecodeString(s.sum); err != nil || len(s.sum) != h.Size()*2 {
+			return nil, fmt.Errorf("line %d: malformed checksum %q", n, s.sum)
+		}
+		sums = append(sums, s)
+	}
+	return sums, scanner.Err()
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Henry Slawniak <https://henry.computer/>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dl
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyBatch(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "good"), []byte("hello\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "bad"), []byte("tampered\n"), 0644)
+	sums := "# checksums\n" +
+		helloSHA256 + "  good\n" +
+		helloSHA256 + " *bad\n" +
+		"SHA256 (missing) = " + helloSHA256 + "\n" +
+		helloSHA256 + "  ../outside\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sums))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/SHA256SUMS")
+
+	res, err := New(WithLogger(quietLogger())).VerifyBatch(dir, u, nil, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(res) != 4 {
+		t.Fatalf("got %d results", len(res))
+	}
+	if res[0].Name != "good" || res[0].Err != nil || res[0].Actual != helloSHA256 {
+		t.Errorf("good: %+v", res[0])
+	}
+	var mismatch *ChecksumMismatchError
+	if !errors.As(res[1].Err, &mismatch) || !errors.Is(res[1].Err, ErrChecksumMismatch) {
+		t.Errorf("bad: %v", res[1].Err)
+	} else if mismatch.Expected != helloSHA256 || mismatch.Actual == helloSHA256 || mismatch.Path != filepath.Join(dir, "bad") {
+		t.Errorf("bad: %+v", mismatch)
+	}
+	if !errors.Is(res[2].Err, os.ErrNotExist) {
+		t.Errorf("missing: %v", res[2].Err)
+	}
+	if res[3].Err == nil || res[3].Path != "" {
+		t.Errorf("outside: %+v", res[3])
+	}
+}
+
+func TestParseSumsMalformed(t *testing.T) {
+	for _, body := range []string{
+		"nospace\n",
+		"abcd  short\n",
+		"MD6 (file) = " + helloSHA256 + "\n",
+	} {
+		if _, err := parseSums([]byte(body)); err == nil {
+			t.Errorf("parsed %q", body)
+		}
+	}
+}